@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"os"
+	"sync"
 	"time"
 
-	"github.com/TicketsBot-cloud/common/observability"
-	"github.com/TicketsBot-cloud/database"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/cli"
 	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
 	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
-	"github.com/TicketsBot-cloud/gdl/rest/request"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/discord"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/logging"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/postgres"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/resources"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/tracing"
 	"github.com/getsentry/sentry-go"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 func main() {
@@ -23,46 +29,70 @@ func main() {
 		panic(err)
 	}
 
-	if len(config.Discord.ProxyHost) > 0 {
-		request.RegisterPreRequestHook(func(_ string, req *http.Request) {
-			req.URL.Scheme = "http"
-			req.URL.Host = config.Discord.ProxyHost
-		})
-	}
-
 	// Build logger
+	redactor := logging.NewRedactor(config)
 	if len(config.SentryDsn) > 0 {
 		if err := sentry.Init(sentry.ClientOptions{
-			Dsn: config.SentryDsn,
+			Dsn:              config.SentryDsn,
+			Environment:      config.SentryEnvironment,
+			Release:          config.SentryRelease,
+			SampleRate:       config.SentrySampleRate,
+			BeforeSend:       redactor.BeforeSend,
+			EnableTracing:    config.SentryTracesSampleRate > 0,
+			TracesSampleRate: config.SentryTracesSampleRate,
 		}); err != nil {
 			panic(fmt.Errorf("sentry.Init: %w", err))
 		}
 	}
 
-	var logger *zap.Logger
-	if config.JsonLogs {
-		loggerConfig := zap.NewProductionConfig()
-		loggerConfig.Level.SetLevel(config.LogLevel)
+	loggers, err := logging.Build(config, redactor)
+	if err != nil {
+		panic(fmt.Errorf("failed to initialise zap logger: %w", err))
+	}
 
-		logger, err = loggerConfig.Build(
-			zap.AddCaller(),
-			zap.AddStacktrace(zap.ErrorLevel),
-			zap.WrapCore(observability.ZapSentryAdapter(observability.EnvironmentProduction)),
-		)
-	} else {
-		loggerConfig := zap.NewDevelopmentConfig()
-		loggerConfig.Level.SetLevel(config.LogLevel)
-		loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	logger := loggers.Root
+
+	if config.DatadogTracing {
+		if tracing.Available {
+			defer tracing.Start("discord-entitlements-db-sync")()
+		} else {
+			logger.Warn("DATADOG_TRACING is set, but this binary was built without the datadog tag")
+		}
+	}
 
-		logger, err = loggerConfig.Build(zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
+	if err := discord.Configure(config, loggers.Fetcher); err != nil {
+		logger.Fatal("Failed to configure Discord client", zap.Error(err))
 	}
 
-	if err != nil {
-		panic(fmt.Errorf("failed to initialise zap logger: %w", err))
+	if len(os.Args) > 1 {
+		if err := cli.Run(context.Background(), config, logger, os.Args[1:]); err != nil {
+			logger.Fatal("Command failed", zap.Error(err))
+		}
+
+		return
+	}
+
+	resources.Configure(logger)
+
+	if len(config.OtlpMetrics.Endpoint) > 0 {
+		shutdown, err := metrics.StartOtlp(context.Background(), config.OtlpMetrics.Endpoint, config.OtlpMetrics.Insecure, config.OtlpMetrics.Interval)
+		if err != nil {
+			logger.Fatal("Failed to start OTLP metrics exporter", zap.Error(err))
+		}
+
+		// Export the final values of a one-shot run before exiting
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			if err := shutdown(ctx); err != nil {
+				logger.Error("Failed to export OTLP metrics", zap.Error(err))
+			}
+		}()
 	}
 
 	logger.Info("Connecting to database...")
-	db, err := connectDatabase(config)
+	pool, err := postgres.Connect(config, config.DatabaseUri, loggers.Database)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 		return
@@ -70,29 +100,129 @@ func main() {
 
 	logger.Info("Database connected.")
 
-	d := daemon.NewDaemon(config, db, logger)
+	var shadowPool *pgxpool.Pool
+	if len(config.Shadow.DatabaseUri) > 0 {
+		logger.Info("Connecting to shadow database...")
+		shadowPool, err = postgres.Connect(config, config.Shadow.DatabaseUri, loggers.Database)
+		if err != nil {
+			logger.Fatal("Failed to connect to shadow database", zap.Error(err))
+			return
+		}
+
+		logger.Info("Shadow database connected.")
+	}
+
+	var replicaPool *pgxpool.Pool
+	if len(config.Replica.DatabaseUri) > 0 {
+		logger.Info("Connecting to read replica...")
+		replicaPool, err = postgres.ConnectReplica(config, config.Replica.DatabaseUri, loggers.Database)
+		if err != nil {
+			logger.Fatal("Failed to connect to read replica", zap.Error(err))
+			return
+		}
+
+		logger.Info("Read replica connected.")
+	}
+
+	daemonLoggers := loggers
+	if config.MultiApplication() {
+		daemonLoggers = loggers.With(zap.Uint64("application_id", config.Discord.ApplicationId))
+	}
+
+	d := daemon.NewDaemon(config, pool, shadowPool, replicaPool, daemonLoggers)
+	if err := d.EnsureSchema(context.Background()); err != nil {
+		logger.Fatal("Failed to create tables", zap.Error(err))
+		return
+	}
+
+	// Each additional application is synced by its own daemon, sharing the database connections. The shadow database
+	// only covers the primary application, and the admin API reaches the others through it.
+	var apps []*daemon.Daemon
+	for _, app := range config.Discord.Applications {
+		appLoggers := loggers.With(zap.Uint64("application_id", app.Id))
+		apps = append(apps, daemon.NewDaemon(config.ForApplication(app), pool, nil, replicaPool, appLoggers))
+	}
+
+	d.AttachApplications(apps)
+
 	if config.Daemon {
+		if len(config.AdminAddr) > 0 {
+			go func() {
+				if err := admin.NewServer(config, d, logger).ListenAndServe(); err != nil {
+					logger.Error("Admin server stopped", zap.Error(err))
+				}
+			}()
+		}
+
+		// Each application runs on its own RUN_FREQUENCY timer and run queue, so a slow run of one does not delay the
+		// others
+		for _, app := range apps {
+			go func() {
+				if err := app.Start(); err != nil {
+					logger.Error("Application daemon stopped", zap.Error(redactor.RedactError(err)))
+				}
+			}()
+		}
+
 		if err := d.Start(); err != nil {
-			panic(err)
+			panic(redactor.RedactError(err))
 		}
 	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), config.ExecutionTimeout)
-		defer cancel()
+		// Ensure the run's transaction and any errors are delivered before exiting
+		defer sentry.Flush(time.Second * 5)
+		defer d.FlushNotifications()
+		for _, app := range apps {
+			defer app.FlushNotifications()
+		}
+
+		defer exportMetrics(config, logger)
+
+		// The applications are run at once, each with its own EXECUTION_TIMEOUT, so that a slow application does not
+		// delay or time out the others
+		daemons := append([]*daemon.Daemon{d}, apps...)
+		errs := make([]error, len(daemons))
+
+		var wg sync.WaitGroup
+		for i, app := range daemons {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if err := runOnce(config, app); err != nil {
+					app.WriteErrorReport(err)
+					errs[i] = err
+				}
+			}()
+		}
+
+		wg.Wait()
 
-		if err := d.RunOnce(ctx); err != nil {
-			panic(err)
+		if err := errors.Join(errs...); err != nil {
+			panic(redactor.RedactError(err))
 		}
 	}
 }
 
-func connectDatabase(config config.Config) (*database.Database, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+// runOnce performs a single run of the daemon, bounded by EXECUTION_TIMEOUT
+func runOnce(config config.Config, d *daemon.Daemon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.ExecutionTimeout)
 	defer cancel()
 
-	pool, err := pgxpool.Connect(ctx, config.DatabaseUri)
-	if err != nil {
-		return nil, err
+	return d.RunOnce(ctx)
+}
+
+// exportMetrics pushes the metrics of a one-shot run to the Pushgateway and/or writes them to METRICS_FILE, as the
+// process exits before it can be scraped
+func exportMetrics(config config.Config, logger *zap.Logger) {
+	if len(config.Pushgateway.Url) > 0 {
+		if err := metrics.Push(config.Pushgateway.Url, config.Pushgateway.Job); err != nil {
+			logger.Error("Failed to push metrics to Pushgateway", zap.Error(err))
+		}
 	}
 
-	return database.NewDatabase(pool), nil
+	if len(config.MetricsFile) > 0 {
+		if err := metrics.WriteFile(config.MetricsFile); err != nil {
+			logger.Error("Failed to write metrics file", zap.String("path", config.MetricsFile), zap.Error(err))
+		}
+	}
 }
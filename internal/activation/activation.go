@@ -0,0 +1,130 @@
+package activation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Hook notifies the premium pipeline of newly created or expiring entitlements, or changes to a guild's premium, so
+// that welcome flows, feature unlocks and expiry warnings run as part of the sync
+type Hook struct {
+	url        string
+	authToken  string
+	httpClient *http.Client
+}
+
+func NewHook(url, authToken string, timeout time.Duration) *Hook {
+	return &Hook{
+		url:       url,
+		authToken: authToken,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Activation describes a newly created entitlement
+type Activation struct {
+	EntitlementId uuid.UUID  `json:"entitlement_id"`
+	DiscordId     uint64     `json:"discord_id,string"`
+	GuildId       *uint64    `json:"guild_id,string,omitempty"`
+	UserId        *uint64    `json:"user_id,string,omitempty"`
+	SkuId         uuid.UUID  `json:"sku_id"`
+	SkuLabel      string     `json:"sku_label"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+// Activated posts the activation to the hook URL, returning an error if it does not respond with a 2xx status
+func (h *Hook) Activated(ctx context.Context, activation Activation) error {
+	return h.post(ctx, activation)
+}
+
+// Expiry describes an entitlement that is about to expire without having been renewed
+type Expiry struct {
+	EntitlementId uuid.UUID `json:"entitlement_id"`
+	DiscordId     uint64    `json:"discord_id,string"`
+	GuildId       *uint64   `json:"guild_id,string,omitempty"`
+	UserId        *uint64   `json:"user_id,string,omitempty"`
+	SkuId         uuid.UUID `json:"sku_id"`
+	SkuLabel      string    `json:"sku_label"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// Expiring posts the expiry to the hook URL, returning an error if it does not respond with a 2xx status
+func (h *Hook) Expiring(ctx context.Context, expiry Expiry) error {
+	return h.post(ctx, expiry)
+}
+
+// GuildChangeEvent is how a guild's premium changed in a run
+type GuildChangeEvent string
+
+const (
+	// GuildGainedPremium is sent when entitlements were created for the guild, and none were removed
+	GuildGainedPremium GuildChangeEvent = "gained_premium"
+	// GuildLostPremium is sent when entitlements were removed from the guild, and none were created
+	GuildLostPremium GuildChangeEvent = "lost_premium"
+	// GuildTierChanged is sent when entitlements for some SKUs were created for the guild, and others removed
+	GuildTierChanged GuildChangeEvent = "tier_changed"
+)
+
+// GuildChange batches the changes that a single run made to a guild's entitlements
+type GuildChange struct {
+	RunId   uuid.UUID          `json:"run_id"`
+	GuildId uint64             `json:"guild_id,string"`
+	Event   GuildChangeEvent   `json:"event"`
+	Added   []GuildEntitlement `json:"added"`
+	Removed []GuildEntitlement `json:"removed"`
+}
+
+// GuildEntitlement is an entitlement created for, or removed from, a guild. SkuLabel is only set for created
+// entitlements.
+type GuildEntitlement struct {
+	EntitlementId uuid.UUID  `json:"entitlement_id"`
+	DiscordId     uint64     `json:"discord_id,string"`
+	SkuId         uuid.UUID  `json:"sku_id"`
+	SkuLabel      string     `json:"sku_label,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+// GuildChanged posts the change to the hook URL, returning an error if it does not respond with a 2xx status
+func (h *Hook) GuildChanged(ctx context.Context, change GuildChange) error {
+	return h.post(ctx, change)
+}
+
+func (h *Hook) post(ctx context.Context, body any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(h.authToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+h.authToken)
+	}
+
+	res, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("hook returned status %d: %s", res.StatusCode, body)
+	}
+
+	return nil
+}
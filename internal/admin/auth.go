@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// sessionCookie holds ADMIN_AUTH_TOKEN for browsers, which cannot send it as a bearer token
+const sessionCookie = "entitlements_sync_admin"
+
+// authenticate rejects requests from addresses outside ADMIN_ALLOWED_CIDRS, and requests without ADMIN_AUTH_TOKEN
+// as a bearer token, if they are configured. The client address is taken from the connection rather than any
+// forwarding headers, which could be spoofed. The health endpoints do not require the token, as load balancers
+// cannot usually send one, and nor do the dashboard and login pages, which contain no data.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.config.AdminAllowedCidrs) > 0 && !s.allowedAddr(r.RemoteAddr) {
+			s.logger.Warn("Rejected admin request from address outside ADMIN_ALLOWED_CIDRS", zap.String("remote_addr", r.RemoteAddr), zap.String("path", r.URL.Path))
+			s.writeError(w, http.StatusForbidden, errors.New("address not allowed"))
+			return
+		}
+
+		if len(s.config.AdminAuthToken) > 0 && !isHealthCheck(r) && !isPublicPage(r) && !s.authorized(r) {
+			s.logger.Warn("Rejected unauthenticated admin request", zap.String("remote_addr", r.RemoteAddr), zap.String("path", r.URL.Path))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) allowedAddr(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+
+	addr := addrPort.Addr().Unmap()
+	return slices.ContainsFunc(s.config.AdminAllowedCidrs, func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
+
+// authorized returns true if the request has ADMIN_AUTH_TOKEN as a bearer token. The session cookie set by the login
+// page is also accepted for requests that only read, so that a cross-site request cannot make changes with it.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.Method == http.MethodGet {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			token, ok = cookie.Value, true
+		}
+	}
+
+	if !ok {
+		return false
+	}
+
+	return s.validToken(token)
+}
+
+func (s *Server) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminAuthToken)) == 1
+}
+
+// accessControlled returns true if either ADMIN_AUTH_TOKEN or ADMIN_ALLOWED_CIDRS is set
+func (s *Server) accessControlled() bool {
+	return len(s.config.AdminAuthToken) > 0 || len(s.config.AdminAllowedCidrs) > 0
+}
+
+// protected refuses requests to endpoints that make changes or export data, unless access to the admin API is
+// controlled, as it would otherwise be open to anyone who can reach ADMIN_ADDR
+func (s *Server) protected(handler http.HandlerFunc) http.HandlerFunc {
+	if s.accessControlled() {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, http.StatusForbidden, errors.New("ADMIN_AUTH_TOKEN or ADMIN_ALLOWED_CIDRS must be set to use this endpoint"))
+	}
+}
@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+const testToken = "admin-token"
+
+func newTestServer(token string, cidrs ...string) *Server {
+	var cfg config.Config
+	cfg.AdminAuthToken = token
+	for _, cidr := range cidrs {
+		cfg.AdminAllowedCidrs = append(cfg.AdminAllowedCidrs, netip.MustParsePrefix(cidr))
+	}
+
+	return NewServer(cfg, nil, zap.NewNop())
+}
+
+// testHandler serves a read-only and a protected endpoint, which respond with 200
+func testHandler(s *Server) http.Handler {
+	ok := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", ok)
+	mux.HandleFunc("GET /healthz", ok)
+	mux.HandleFunc("GET /status", ok)
+	mux.HandleFunc("POST /deletions/pause", s.protected(ok))
+
+	return s.authenticate(mux)
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *Server
+		method string
+		path   string
+		bearer string
+		cookie string
+		addr   string
+		status int
+	}{
+		{name: "read without access control", server: newTestServer(""), method: http.MethodGet, path: "/status", status: http.StatusOK},
+		{name: "change without access control", server: newTestServer(""), method: http.MethodPost, path: "/deletions/pause", status: http.StatusForbidden},
+		{name: "change from allowed address", server: newTestServer("", "10.0.0.0/8"), method: http.MethodPost, path: "/deletions/pause", addr: "10.1.2.3:1234", status: http.StatusOK},
+		{name: "request from other address", server: newTestServer("", "10.0.0.0/8"), method: http.MethodGet, path: "/status", addr: "192.168.0.1:1234", status: http.StatusForbidden},
+		{name: "missing token", server: newTestServer(testToken), method: http.MethodGet, path: "/status", status: http.StatusUnauthorized},
+		{name: "wrong token", server: newTestServer(testToken), method: http.MethodPost, path: "/deletions/pause", bearer: "wrong", status: http.StatusUnauthorized},
+		{name: "change with token", server: newTestServer(testToken), method: http.MethodPost, path: "/deletions/pause", bearer: testToken, status: http.StatusOK},
+		{name: "read with cookie", server: newTestServer(testToken), method: http.MethodGet, path: "/status", cookie: testToken, status: http.StatusOK},
+		{name: "change with cookie", server: newTestServer(testToken), method: http.MethodPost, path: "/deletions/pause", cookie: testToken, status: http.StatusUnauthorized},
+		{name: "dashboard without token", server: newTestServer(testToken), method: http.MethodGet, path: "/", status: http.StatusOK},
+		{name: "health check without token", server: newTestServer(testToken), method: http.MethodGet, path: "/healthz", status: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if len(tc.addr) > 0 {
+				req.RemoteAddr = tc.addr
+			}
+
+			if len(tc.bearer) > 0 {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+
+			if len(tc.cookie) > 0 {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tc.cookie})
+			}
+
+			rec := httptest.NewRecorder()
+			testHandler(tc.server).ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		location string
+		cookie   bool
+	}{
+		{name: "valid token", token: testToken, location: "/", cookie: true},
+		{name: "invalid token", token: "wrong", location: "/login?failed"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("token="+tc.token))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rec := httptest.NewRecorder()
+			newTestServer(testToken).handleLogin(rec, req)
+
+			if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != tc.location {
+				t.Errorf("expected redirect to %s, got %d to %s", tc.location, rec.Code, rec.Header().Get("Location"))
+			}
+
+			cookies := rec.Result().Cookies()
+			if tc.cookie != (len(cookies) == 1 && cookies[0].Name == sessionCookie && cookies[0].HttpOnly) {
+				t.Errorf("unexpected cookies: %v", cookies)
+			}
+		})
+	}
+}
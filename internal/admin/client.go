@@ -0,0 +1,178 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/planfile"
+	"github.com/google/uuid"
+)
+
+// Client calls the admin API of a running daemon, for use by the CLI
+type Client struct {
+	baseUrl       string
+	authToken     string
+	applicationId uint64
+	httpClient    *http.Client
+}
+
+// NewClient creates a new Client. addr is in the same format as ADMIN_ADDR, e.g. ":8080". authToken is sent as a
+// bearer token if it is not empty, see ADMIN_AUTH_TOKEN. Requests act on the application with applicationId, or
+// DISCORD_APPLICATION_ID if it is 0, see ADMIN_APPLICATION_ID.
+func NewClient(addr, authToken string, applicationId uint64) *Client {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+
+	return &Client{
+		baseUrl:       "http://" + addr,
+		authToken:     authToken,
+		applicationId: applicationId,
+		httpClient:    &http.Client{},
+	}
+}
+
+func (c *Client) Cutover(ctx context.Context, databaseUri, replicaDatabaseUri string) error {
+	body := cutoverRequest{DatabaseUri: databaseUri, ReplicaDatabaseUri: replicaDatabaseUri}
+	return c.do(ctx, http.MethodPost, "/cutover", body, nil)
+}
+
+// ApproveQuarantine approves the quarantined deletions of the given Discord entitlement IDs, or all quarantined
+// deletions if discordIds is empty, returning the number approved
+func (c *Client) ApproveQuarantine(ctx context.Context, discordIds []uint64) (int64, error) {
+	body := approveRequest{DiscordIds: discordIds, All: len(discordIds) == 0}
+
+	var res approveResponse
+	if err := c.do(ctx, http.MethodPost, "/quarantine/approve", body, &res); err != nil {
+		return 0, err
+	}
+
+	return res.Approved, nil
+}
+
+// Retarget changes the guild that the user entitlement linked to the Discord entitlement activates
+func (c *Client) Retarget(ctx context.Context, discordId, guildId uint64) error {
+	path := fmt.Sprintf("/entitlements/%d/retarget", discordId)
+	return c.do(ctx, http.MethodPost, path, retargetRequest{GuildId: guildId}, nil)
+}
+
+// PurgeUser deletes all the stored Discord entitlements of the user, returning the number deleted
+func (c *Client) PurgeUser(ctx context.Context, userId uint64) (int64, error) {
+	var res purgeResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d/purge", userId), nil, &res); err != nil {
+		return 0, err
+	}
+
+	return res.Entitlements, nil
+}
+
+// UndoRun restores the entitlements deleted by a run, returning the number restored
+func (c *Client) UndoRun(ctx context.Context, runId uuid.UUID) (int64, error) {
+	var res undoResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/runs/%s/undo", runId), nil, &res); err != nil {
+		return 0, err
+	}
+
+	return res.Restored, nil
+}
+
+// Plan computes the changes that a run would make without applying them, returning them as a signed plan file
+func (c *Client) Plan(ctx context.Context) (planfile.File, error) {
+	var file planfile.File
+	if err := c.do(ctx, http.MethodPost, "/plan", nil, &file); err != nil {
+		return planfile.File{}, err
+	}
+
+	return file, nil
+}
+
+// ApplyPlan applies the changes in a plan file, failing if they no longer match the changes that a run would make
+func (c *Client) ApplyPlan(ctx context.Context, file planfile.File) error {
+	return c.do(ctx, http.MethodPost, "/plan/apply", file, nil)
+}
+
+// SetDeletionsPaused pauses or resumes deletions in the running daemon
+func (c *Client) SetDeletionsPaused(ctx context.Context, paused bool) error {
+	path := "/deletions/resume"
+	if paused {
+		path = "/deletions/pause"
+	}
+
+	return c.do(ctx, http.MethodPost, path, nil, nil)
+}
+
+// Export returns the JSON export of all the data held about a user or guild. key is user_id or guild_id.
+func (c *Client) Export(ctx context.Context, key string, id uint64) (json.RawMessage, error) {
+	var res json.RawMessage
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/export?%s=%d", key, id), nil, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// LintSkus returns the inconsistencies between discord_store_skus and the SKUs that Discord lists
+func (c *Client) LintSkus(ctx context.Context) (SkuLintResponse, error) {
+	var res SkuLintResponse
+	if err := c.do(ctx, http.MethodGet, "/skus/lint", nil, &res); err != nil {
+		return SkuLintResponse{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, response any) error {
+	var encoded []byte
+	if body != nil {
+		var err error
+		encoded, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.applicationId != 0 {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+
+		path += fmt.Sprintf("%sapplication_id=%d", separator, c.applicationId)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(c.authToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var parsed errorResponse
+		if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+			return fmt.Errorf("admin API returned status %d", res.StatusCode)
+		}
+
+		return fmt.Errorf("admin API returned status %d: %s", res.StatusCode, parsed.Error)
+	}
+
+	if response != nil && res.StatusCode != http.StatusNoContent {
+		return json.NewDecoder(res.Body).Decode(response)
+	}
+
+	return nil
+}
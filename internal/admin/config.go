@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"net/http"
+)
+
+type configResponse struct {
+	// Config is the effective value of each setting by environment variable, with secrets redacted
+	Config  map[string]string `json:"config"`
+	Toggles togglesResponse   `json:"toggles"`
+}
+
+type togglesResponse struct {
+	DeletionsPaused  bool    `json:"deletions_paused"`
+	DeletionsEnabled bool    `json:"deletions_enabled"`
+	DryRun           bool    `json:"dry_run"`
+	CanaryPercentage float64 `json:"canary_percentage"`
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	toggles := d.Toggles(r.Context())
+
+	s.writeJson(w, http.StatusOK, configResponse{
+		Config:  s.config.Describe(),
+		Toggles: togglesResponse(toggles),
+	})
+}
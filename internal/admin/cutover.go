@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type cutoverRequest struct {
+	DatabaseUri string `json:"database_uri"`
+	// ReplicaDatabaseUri is the read replica of the new database. If empty, the read replica is disabled.
+	ReplicaDatabaseUri string `json:"replica_database_uri,omitempty"`
+}
+
+func (s *Server) handleCutover(w http.ResponseWriter, r *http.Request) {
+	// The applications share the database, so every one of them is switched whichever is selected
+	if _, ok := s.application(w, r); !ok {
+		return
+	}
+
+	var body cutoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(body.DatabaseUri) == 0 {
+		s.writeError(w, http.StatusBadRequest, errors.New("database_uri is required"))
+		return
+	}
+
+	// Don't abort the cutover part way through if the client disconnects
+	if err := s.daemon.Cutover(context.WithoutCancel(r.Context()), body.DatabaseUri, body.ReplicaDatabaseUri); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	userId, err := optionalId(r, "user_id")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	guildId, err := optionalId(r, "guild_id")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if (userId == nil) == (guildId == nil) {
+		s.writeError(w, http.StatusBadRequest, errors.New("exactly one of user_id or guild_id is required"))
+		return
+	}
+
+	export, err := d.ExportData(r.Context(), userId, guildId)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, export)
+}
+
+func optionalId(r *http.Request, key string) (*uint64, error) {
+	value := r.URL.Query().Get(key)
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid " + key)
+	}
+
+	return &id, nil
+}
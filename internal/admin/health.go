@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+	// LastSuccessAt is the start time of the last successful full run, or null if there has not been one
+	LastSuccessAt *time.Time `json:"last_success_at"`
+	StalenessMs   int64      `json:"staleness_ms"`
+}
+
+// handleHealthz reports whether full runs are succeeding. Until the first has succeeded, the daemon is considered
+// healthy for HEALTH_STALENESS after it started.
+func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	lastSuccess, ok := s.daemon.LastFullSync()
+	since := s.daemon.StartedAt()
+	if ok {
+		since = lastSuccess
+	}
+
+	s.writeHealth(w, time.Since(since) <= s.config.HealthStaleness, lastSuccess, ok)
+}
+
+// handleReadyz reports whether the database has been synced recently. Unlike handleHealthz, the daemon is not
+// ready until a full run has succeeded.
+func (s *Server) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	lastSuccess, ok := s.daemon.LastFullSync()
+	s.writeHealth(w, ok && time.Since(lastSuccess) <= s.config.HealthStaleness, lastSuccess, ok)
+}
+
+func (s *Server) writeHealth(w http.ResponseWriter, healthy bool, lastSuccess time.Time, ok bool) {
+	res := healthResponse{
+		Status:      "ok",
+		StalenessMs: s.config.HealthStaleness.Milliseconds(),
+	}
+
+	if ok {
+		res.LastSuccessAt = &lastSuccess
+	}
+
+	status := http.StatusOK
+	if !healthy {
+		res.Status = "stale"
+		status = http.StatusServiceUnavailable
+	}
+
+	s.writeJson(w, status, res)
+}
+
+func isHealthCheck(r *http.Request) bool {
+	return r.Method == http.MethodGet && (r.URL.Path == "/healthz" || r.URL.Path == "/readyz")
+}
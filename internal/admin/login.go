@@ -0,0 +1,41 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+//go:embed static/login.html
+var loginPage []byte
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(loginPage)
+}
+
+// handleLogin sets the session cookie if the submitted token is ADMIN_AUTH_TOKEN, so that the dashboard can be used
+// from a browser
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if len(s.config.AdminAuthToken) == 0 || !s.validToken(r.PostFormValue("token")) {
+		s.logger.Warn("Rejected admin login", zap.String("remote_addr", r.RemoteAddr))
+		http.Redirect(w, r, "login?failed", http.StatusSeeOther)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.config.AdminAuthToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	http.Redirect(w, r, "./", http.StatusSeeOther)
+}
+
+func isPublicPage(r *http.Request) bool {
+	return (r.Method == http.MethodGet && r.URL.Path == "/") || r.URL.Path == "/login"
+}
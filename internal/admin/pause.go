@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"net/http"
+)
+
+func (s *Server) handlePauseDeletions(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	d.SetDeletionsPaused(true)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleResumeDeletions(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	d.SetDeletionsPaused(false)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/planfile"
+)
+
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := d.Plan(context.WithoutCancel(r.Context()))
+	if err != nil {
+		s.writeError(w, planErrorStatus(err), err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, file)
+}
+
+func (s *Server) handleApplyPlan(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	var file planfile.File
+	if err := json.NewDecoder(r.Body).Decode(&file); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := d.ApplyPlanFile(context.WithoutCancel(r.Context()), file); err != nil {
+		s.writeError(w, planErrorStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func planErrorStatus(err error) int {
+	var driftErr *daemon.PlanDriftError
+
+	switch {
+	case errors.Is(err, daemon.ErrPlanFilesDisabled), errors.Is(err, daemon.ErrPlanNotApplicable), errors.As(err, &driftErr):
+		return http.StatusConflict
+	case errors.Is(err, planfile.ErrInvalidSignature):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
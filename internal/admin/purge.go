@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+)
+
+type purgeResponse struct {
+	Entitlements int64 `json:"entitlements"`
+}
+
+func (s *Server) handlePurgeUser(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	userId, err := strconv.ParseUint(r.PathValue("user_id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("invalid user_id"))
+		return
+	}
+
+	purged, err := d.PurgeUser(context.WithoutCancel(r.Context()), userId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, daemon.ErrPurgeDisabled) {
+			status = http.StatusConflict
+		}
+
+		s.writeError(w, status, err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, purgeResponse{Entitlements: purged})
+}
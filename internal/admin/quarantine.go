@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+	"github.com/google/uuid"
+)
+
+type quarantinedDeletion struct {
+	DiscordId     uint64     `json:"discord_id,string"`
+	EntitlementId uuid.UUID  `json:"entitlement_id"`
+	QuarantinedAt time.Time  `json:"quarantined_at"`
+	ApprovedAt    *time.Time `json:"approved_at"`
+}
+
+type approveRequest struct {
+	// DiscordIds are the Discord entitlement IDs to approve the deletion of. All must be set if it is empty.
+	DiscordIds []uint64 `json:"discord_ids,omitempty"`
+	All        bool     `json:"all,omitempty"`
+}
+
+type approveResponse struct {
+	Approved int64 `json:"approved"`
+}
+
+func (s *Server) handleListQuarantine(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	deletions, err := d.ListQuarantine(r.Context())
+	if err != nil {
+		s.writeError(w, quarantineErrorStatus(err), err)
+		return
+	}
+
+	res := make([]quarantinedDeletion, len(deletions))
+	for i, deletion := range deletions {
+		res[i] = quarantinedDeletion(deletion)
+	}
+
+	s.writeJson(w, http.StatusOK, res)
+}
+
+func (s *Server) handleApproveQuarantine(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	var body approveRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Require approving everything to be explicit, rather than the default for an empty request
+	if body.All == (len(body.DiscordIds) > 0) {
+		s.writeError(w, http.StatusBadRequest, errors.New("exactly one of discord_ids or all is required"))
+		return
+	}
+
+	var discordIds []uint64
+	if !body.All {
+		discordIds = body.DiscordIds
+	}
+
+	approved, err := d.ApproveQuarantine(r.Context(), discordIds)
+	if err != nil {
+		s.writeError(w, quarantineErrorStatus(err), err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, approveResponse{Approved: approved})
+}
+
+func quarantineErrorStatus(err error) int {
+	if errors.Is(err, daemon.ErrQuarantineDisabled) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
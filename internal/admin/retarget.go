@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+)
+
+type retargetRequest struct {
+	GuildId uint64 `json:"guild_id,string"`
+}
+
+func (s *Server) handleRetarget(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	discordId, err := strconv.ParseUint(r.PathValue("discord_id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("invalid discord_id"))
+		return
+	}
+
+	var body retargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if body.GuildId == 0 {
+		s.writeError(w, http.StatusBadRequest, errors.New("guild_id is required"))
+		return
+	}
+
+	if err := d.RetargetEntitlement(context.WithoutCancel(r.Context()), discordId, body.GuildId); err != nil {
+		s.writeError(w, retargetErrorStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func retargetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, daemon.ErrRetargetDisabled):
+		return http.StatusConflict
+	case errors.Is(err, daemon.ErrEntitlementNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, daemon.ErrNotUserEntitlement):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
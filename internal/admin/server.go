@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+type Server struct {
+	config config.Config
+	daemon *daemon.Daemon
+	logger *zap.Logger
+}
+
+func NewServer(config config.Config, daemon *daemon.Daemon, logger *zap.Logger) *Server {
+	return &Server{
+		config: config,
+		daemon: daemon,
+		logger: logger,
+	}
+}
+
+func (s *Server) ListenAndServe() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("GET /login", s.handleLoginPage)
+	mux.HandleFunc("POST /login", s.handleLogin)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.HandleFunc("GET /config", s.handleConfig)
+	mux.HandleFunc("POST /cutover", s.protected(s.handleCutover))
+	mux.HandleFunc("GET /quarantine", s.handleListQuarantine)
+	mux.HandleFunc("POST /quarantine/approve", s.protected(s.handleApproveQuarantine))
+	mux.HandleFunc("POST /entitlements/{discord_id}/retarget", s.protected(s.handleRetarget))
+	mux.HandleFunc("POST /users/{user_id}/purge", s.protected(s.handlePurgeUser))
+	mux.HandleFunc("POST /runs/{run_id}/undo", s.protected(s.handleUndoRun))
+	mux.HandleFunc("POST /plan", s.protected(s.handlePlan))
+	mux.HandleFunc("POST /plan/apply", s.protected(s.handleApplyPlan))
+	mux.HandleFunc("GET /export", s.protected(s.handleExport))
+	mux.HandleFunc("GET /skus/lint", s.handleLintSkus)
+	mux.HandleFunc("POST /deletions/pause", s.protected(s.handlePauseDeletions))
+	mux.HandleFunc("POST /deletions/resume", s.protected(s.handleResumeDeletions))
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	if !s.accessControlled() {
+		s.logger.Warn("Neither ADMIN_AUTH_TOKEN nor ADMIN_ALLOWED_CIDRS is set, the admin endpoints that make changes or export data are disabled")
+	}
+
+	s.logger.Info("Starting admin server", zap.String("addr", s.config.AdminAddr))
+	return http.ListenAndServe(s.config.AdminAddr, s.authenticate(mux))
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Warn("Failed to write admin response", zap.Error(err))
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJson(w, status, errorResponse{Error: err.Error()})
+}
+
+// application returns the daemon of the application selected by the application_id query parameter, which defaults
+// to DISCORD_APPLICATION_ID. An error response is written if the application is not one that is being synced.
+func (s *Server) application(w http.ResponseWriter, r *http.Request) (*daemon.Daemon, bool) {
+	var id uint64
+	if value := r.URL.Query().Get("application_id"); len(value) > 0 {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, errors.New("invalid application_id"))
+			return nil, false
+		}
+
+		id = parsed
+	}
+
+	d, ok := s.daemon.Application(id)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("application %d is not synced by this daemon", id))
+		return nil, false
+	}
+
+	return d, true
+}
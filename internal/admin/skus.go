@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+	"github.com/google/uuid"
+)
+
+// SkuLintResponse is the report of inconsistencies between discord_store_skus and Discord, see daemon.SkuLintReport
+type SkuLintResponse struct {
+	Missing    []LintedSku `json:"missing"`
+	Stale      []LintedSku `json:"stale"`
+	Duplicates []LintedSku `json:"duplicates"`
+}
+
+// LintedSku is a Discord SKU, along with the internal SKU it is mapped to, if any
+type LintedSku struct {
+	DiscordId string `json:"discord_id"`
+	Name      string `json:"name,omitempty"`
+	Type      int    `json:"type,omitempty"`
+	SkuId     string `json:"sku_id,omitempty"`
+	Label     string `json:"label,omitempty"`
+}
+
+func newLintedSkus(skus []daemon.LintedSku) []LintedSku {
+	res := make([]LintedSku, len(skus))
+	for i, sku := range skus {
+		res[i] = LintedSku{
+			DiscordId: strconv.FormatUint(sku.DiscordId, 10),
+			Name:      sku.Name,
+			Type:      sku.Type,
+			Label:     sku.Label,
+		}
+
+		if sku.SkuId != uuid.Nil {
+			res[i].SkuId = sku.SkuId.String()
+		}
+	}
+
+	return res
+}
+
+func (s *Server) handleLintSkus(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := d.LintSkus(r.Context())
+	if err != nil {
+		var discordUnavailableErr *daemon.DiscordUnavailableError
+		if errors.As(err, &discordUnavailableErr) {
+			s.writeError(w, http.StatusBadGateway, err)
+		} else {
+			s.writeError(w, http.StatusInternalServerError, err)
+		}
+
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, SkuLintResponse{
+		Missing:    newLintedSkus(report.Missing),
+		Stale:      newLintedSkus(report.Stale),
+		Duplicates: newLintedSkus(report.Duplicates),
+	})
+}
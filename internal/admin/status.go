@@ -0,0 +1,140 @@
+package admin
+
+import (
+	_ "embed"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+)
+
+//go:embed static/index.html
+var dashboardPage []byte
+
+type statusResponse struct {
+	Runs            []runSummary `json:"runs"`
+	DeletionsPaused bool         `json:"deletions_paused"`
+	// SkuNames maps Discord SKU IDs to their names, if SKU_METADATA_ENABLED is set
+	SkuNames map[string]string `json:"sku_names"`
+	// Quarantine is null if the deletion quarantine is not enabled
+	Quarantine []quarantinedDeletion `json:"quarantine"`
+}
+
+type runSummary struct {
+	RunId                string    `json:"run_id"`
+	GuildId              string    `json:"guild_id,omitempty"`
+	UserId               string    `json:"user_id,omitempty"`
+	StartedAt            time.Time `json:"started_at"`
+	DurationMs           int64     `json:"duration_ms"`
+	Error                string    `json:"error,omitempty"`
+	ErrorClass           string    `json:"error_class,omitempty"`
+	ReadOnly             bool      `json:"read_only"`
+	DryRun               bool      `json:"dry_run"`
+	Unchanged            bool      `json:"unchanged"`
+	Fetched              int       `json:"fetched"`
+	Creations            int       `json:"creations"`
+	Refreshes            int       `json:"refreshes"`
+	Deletions            int       `json:"deletions"`
+	MissingDeletions     int       `json:"missing_deletions"`
+	BlockedDeletions     int       `json:"blocked_deletions"`
+	DeferredDeletions    int       `json:"deferred_deletions"`
+	PendingDeletions     int       `json:"pending_deletions"`
+	IgnoredDeletions     int       `json:"ignored_deletions"`
+	PausedDeletions      int       `json:"paused_deletions"`
+	QuarantinedDeletions int       `json:"quarantined_deletions"`
+	UnknownSkus          []string  `json:"unknown_skus"`
+	// Skipped is the number of entitlements that were not synced, by reason
+	Skipped map[string]int `json:"skipped"`
+}
+
+func newRunSummary(run daemon.RunSummary) runSummary {
+	unknownSkus := make([]string, len(run.UnknownSkus))
+	for i, skuId := range run.UnknownSkus {
+		unknownSkus[i] = strconv.FormatUint(skuId, 10)
+	}
+
+	skipped := make(map[string]int, len(run.Skipped))
+	for reason, count := range run.Skipped {
+		skipped[string(reason)] = count
+	}
+
+	var guildId, userId string
+	if run.GuildId != 0 {
+		guildId = strconv.FormatUint(run.GuildId, 10)
+	}
+
+	if run.UserId != 0 {
+		userId = strconv.FormatUint(run.UserId, 10)
+	}
+
+	return runSummary{
+		RunId:                run.RunId.String(),
+		StartedAt:            run.StartedAt,
+		GuildId:              guildId,
+		UserId:               userId,
+		DurationMs:           run.Duration.Milliseconds(),
+		Error:                run.Error,
+		ErrorClass:           string(run.ErrorClass),
+		ReadOnly:             run.ReadOnly,
+		DryRun:               run.DryRun,
+		Unchanged:            run.Unchanged,
+		Fetched:              run.Fetched,
+		Creations:            run.Creations,
+		Refreshes:            run.Refreshes,
+		Deletions:            run.Deletions,
+		MissingDeletions:     run.MissingDeletions,
+		BlockedDeletions:     run.BlockedDeletions,
+		DeferredDeletions:    run.DeferredDeletions,
+		PendingDeletions:     run.PendingDeletions,
+		IgnoredDeletions:     run.IgnoredDeletions,
+		PausedDeletions:      run.PausedDeletions,
+		QuarantinedDeletions: run.QuarantinedDeletions,
+		UnknownSkus:          unknownSkus,
+		Skipped:              skipped,
+	}
+}
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	runs := d.RecentRuns()
+
+	res := statusResponse{
+		Runs:            make([]runSummary, len(runs)),
+		DeletionsPaused: d.DeletionsPaused(),
+		SkuNames:        make(map[string]string),
+	}
+
+	for skuId, name := range d.SkuNames() {
+		res.SkuNames[strconv.FormatUint(skuId, 10)] = name
+	}
+
+	for i, run := range runs {
+		res.Runs[i] = newRunSummary(run)
+	}
+
+	deletions, err := d.ListQuarantine(r.Context())
+	if err != nil && !errors.Is(err, daemon.ErrQuarantineDisabled) {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err == nil {
+		res.Quarantine = make([]quarantinedDeletion, len(deletions))
+		for i, deletion := range deletions {
+			res.Quarantine[i] = quarantinedDeletion(deletion)
+		}
+	}
+
+	s.writeJson(w, http.StatusOK, res)
+}
@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+	"github.com/google/uuid"
+)
+
+type undoResponse struct {
+	Restored int64 `json:"restored"`
+}
+
+func (s *Server) handleUndoRun(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	runId, err := uuid.Parse(r.PathValue("run_id"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, errors.New("invalid run_id"))
+		return
+	}
+
+	restored, err := d.UndoRun(context.WithoutCancel(r.Context()), runId)
+	if err != nil {
+		s.writeError(w, undoErrorStatus(err), err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, undoResponse{Restored: restored})
+}
+
+func undoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, daemon.ErrUndoDisabled):
+		return http.StatusConflict
+	case errors.Is(err, daemon.ErrNothingToUndo):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,163 @@
+package backfill
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+)
+
+// ReadFile reads the entitlements from an export file. Files ending in .csv are read as CSV with a header row, using
+// the same column names as the fields of the API's entitlement object. Any other file is read as a JSON array of
+// entitlement objects, as returned by the API.
+func ReadFile(path string) ([]entitlement.Entitlement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readCsv(f)
+	}
+
+	var entitlements []entitlement.Entitlement
+	if err := json.NewDecoder(f).Decode(&entitlements); err != nil {
+		return nil, fmt.Errorf("failed to decode backfill file: %w", err)
+	}
+
+	return entitlements, nil
+}
+
+func readCsv(r io.Reader) ([]entitlement.Entitlement, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backfill header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"id", "sku_id"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("backfill file is missing the %s column", required)
+		}
+	}
+
+	var entitlements []entitlement.Entitlement
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entitlements, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		e, err := parseRecord(columns, record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		entitlements = append(entitlements, e)
+	}
+}
+
+func parseRecord(columns map[string]int, record []string) (entitlement.Entitlement, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+
+		return ""
+	}
+
+	var e entitlement.Entitlement
+	var err error
+
+	if e.Id, err = strconv.ParseUint(get("id"), 10, 64); err != nil {
+		return e, fmt.Errorf("invalid id: %w", err)
+	}
+
+	if e.SkuId, err = strconv.ParseUint(get("sku_id"), 10, 64); err != nil {
+		return e, fmt.Errorf("invalid sku_id: %w", err)
+	}
+
+	if value := get("application_id"); len(value) > 0 {
+		if e.ApplicationId, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return e, fmt.Errorf("invalid application_id: %w", err)
+		}
+	}
+
+	if e.UserId, err = optionalUint(get("user_id")); err != nil {
+		return e, fmt.Errorf("invalid user_id: %w", err)
+	}
+
+	if e.GuildId, err = optionalUint(get("guild_id")); err != nil {
+		return e, fmt.Errorf("invalid guild_id: %w", err)
+	}
+
+	if value := get("type"); len(value) > 0 {
+		entitlementType, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return e, fmt.Errorf("invalid type: %w", err)
+		}
+
+		e.Type = entitlement.EntitlementType(entitlementType)
+	}
+
+	if value := get("deleted"); len(value) > 0 {
+		if e.Deleted, err = strconv.ParseBool(value); err != nil {
+			return e, fmt.Errorf("invalid deleted: %w", err)
+		}
+	}
+
+	if e.StartsAt, err = optionalTime(get("starts_at")); err != nil {
+		return e, fmt.Errorf("invalid starts_at: %w", err)
+	}
+
+	if e.EndsAt, err = optionalTime(get("ends_at")); err != nil {
+		return e, fmt.Errorf("invalid ends_at: %w", err)
+	}
+
+	return e, nil
+}
+
+func optionalUint(value string) (*uint64, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
+
+func optionalTime(value string) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
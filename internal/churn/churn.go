@@ -0,0 +1,102 @@
+package churn
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+)
+
+// Change is the SKUs that a guild held entitlements for in each snapshot. Before is empty for gained guilds, and
+// After is empty for lost guilds.
+type Change struct {
+	GuildId uint64
+	Before  []uint64
+	After   []uint64
+}
+
+// Report is the difference in guild entitlements between two snapshots, sorted by guild ID
+type Report struct {
+	Gained     []Change
+	Lost       []Change
+	Upgraded   []Change
+	Downgraded []Change
+	// Changed holds guilds whose SKUs changed without their highest tier changing, e.g. because neither SKU is
+	// listed in the tiers passed to Compare
+	Changed []Change
+}
+
+// Compare diffs two snapshots of entitlements, as read by backfill.ReadFile. Only guild entitlements are compared,
+// and those flagged as deleted are ignored. tiers lists Discord SKU IDs from the lowest to the highest tier, and
+// determines whether a guild whose SKUs changed was upgraded or downgraded. SKUs that are not listed rank below all
+// of those that are.
+func Compare(before, after []entitlement.Entitlement, tiers []uint64) Report {
+	beforeSkus := guildSkus(before)
+	afterSkus := guildSkus(after)
+
+	rank := func(skus []uint64) int {
+		highest := 0
+		for _, skuId := range skus {
+			highest = max(highest, slices.Index(tiers, skuId)+1)
+		}
+
+		return highest
+	}
+
+	var report Report
+	for guildId, skus := range beforeSkus {
+		if _, ok := afterSkus[guildId]; !ok {
+			report.Lost = append(report.Lost, Change{GuildId: guildId, Before: skus})
+		}
+	}
+
+	for guildId, skus := range afterSkus {
+		previous, ok := beforeSkus[guildId]
+		if !ok {
+			report.Gained = append(report.Gained, Change{GuildId: guildId, After: skus})
+			continue
+		}
+
+		if slices.Equal(previous, skus) {
+			continue
+		}
+
+		change := Change{GuildId: guildId, Before: previous, After: skus}
+		switch previousRank, newRank := rank(previous), rank(skus); {
+		case newRank > previousRank:
+			report.Upgraded = append(report.Upgraded, change)
+		case newRank < previousRank:
+			report.Downgraded = append(report.Downgraded, change)
+		default:
+			report.Changed = append(report.Changed, change)
+		}
+	}
+
+	for _, changes := range []*[]Change{&report.Gained, &report.Lost, &report.Upgraded, &report.Downgraded, &report.Changed} {
+		slices.SortFunc(*changes, func(a, b Change) int {
+			return cmp.Compare(a.GuildId, b.GuildId)
+		})
+	}
+
+	return report
+}
+
+// guildSkus returns the sorted, distinct SKU IDs of each guild's entitlements
+func guildSkus(entitlements []entitlement.Entitlement) map[uint64][]uint64 {
+	skus := make(map[uint64][]uint64)
+	for _, e := range entitlements {
+		if e.GuildId == nil || e.Deleted {
+			continue
+		}
+
+		if !slices.Contains(skus[*e.GuildId], e.SkuId) {
+			skus[*e.GuildId] = append(skus[*e.GuildId], e.SkuId)
+		}
+	}
+
+	for _, guildSkus := range skus {
+		slices.Sort(guildSkus)
+	}
+
+	return skus
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+const approveUsage = "usage: approve all | approve <discord-entitlement-id>..."
+
+// approve approves quarantined deletions, so that they are applied by the next run: approve all | approve <id>...
+func approve(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(approveUsage)
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	var discordIds []uint64
+	if len(args) != 1 || args[0] != "all" {
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid discord entitlement ID %s: %w", arg, err)
+			}
+
+			discordIds = append(discordIds, id)
+		}
+	}
+
+	approved, err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).ApproveQuarantine(ctx, discordIds)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Approved quarantined deletions", zap.Int64("count", approved))
+	return nil
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+type command func(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error
+
+var commands = map[string]command{
+	"apply":            apply,
+	"approve":          approve,
+	"cutover":          cutover,
+	"export":           export,
+	"lint-skus":        lintSkus,
+	"retarget":         retarget,
+	"plan":             plan,
+	"purge-user":       purgeUser,
+	"report":           report,
+	"pause-deletions":  pauseDeletions,
+	"resume-deletions": resumeDeletions,
+	"undo":             undo,
+}
+
+// Run executes the CLI command named by the first argument
+func Run(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %s, expected one of: %s", args[0], strings.Join(commandNames(), ", "))
+	}
+
+	return cmd(ctx, config, logger, args[1:])
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+// cutover instructs the running daemon to switch to a new database: cutover <database-uri> [replica-database-uri]
+func cutover(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: cutover <database-uri> [replica-database-uri]")
+	}
+
+	var replicaDatabaseUri string
+	if len(args) == 2 {
+		replicaDatabaseUri = args[1]
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	logger.Info("Requesting database cutover")
+	if err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).Cutover(ctx, args[0], replicaDatabaseUri); err != nil {
+		return err
+	}
+
+	logger.Info("Database cutover complete")
+	return nil
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+const exportUsage = "usage: export user <user-id> | export guild <guild-id>"
+
+// export writes all the data held about a user or guild to stdout as JSON: export user <id> | export guild <id>
+func export(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 2 || (args[0] != "user" && args[0] != "guild") {
+		return errors.New(exportUsage)
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s ID %s: %w", args[0], args[1], err)
+	}
+
+	exported, err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).Export(ctx, args[0]+"_id", id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stdout.Write(exported); err != nil {
+		return err
+	}
+
+	logger.Info("Exported data", zap.String("kind", args[0]))
+	return nil
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+// lintSkus prints a report of the inconsistencies between discord_store_skus and the SKUs that Discord lists,
+// along with the SQL to fix them, failing if any SKUs are missing or stale: lint-skus
+func lintSkus(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: lint-skus")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	report, err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).LintSkus(ctx)
+	if err != nil {
+		return err
+	}
+
+	printSkuLintReport(os.Stdout, report)
+
+	logger.Info(
+		"Linted SKUs",
+		zap.Int("missing", len(report.Missing)),
+		zap.Int("stale", len(report.Stale)),
+		zap.Int("duplicates", len(report.Duplicates)),
+	)
+
+	if problems := len(report.Missing) + len(report.Stale); problems > 0 {
+		return fmt.Errorf("found %d missing or stale SKU mappings", problems)
+	}
+
+	return nil
+}
+
+func printSkuLintReport(w io.Writer, report admin.SkuLintResponse) {
+	if len(report.Missing)+len(report.Stale)+len(report.Duplicates) == 0 {
+		fmt.Fprintln(w, "discord_store_skus is consistent with Discord")
+		return
+	}
+
+	if len(report.Missing) > 0 {
+		fmt.Fprintf(w, "Missing mappings (%d): entitlements for these SKUs are skipped as unknown. Map each to an internal SKU:\n", len(report.Missing))
+		for _, sku := range report.Missing {
+			fmt.Fprintf(w, "  -- %s (type %d)\n", sku.Name, sku.Type)
+			fmt.Fprintf(w, "  INSERT INTO discord_store_skus (discord_id, sku_id) VALUES (%s, '<sku-id>');\n", sku.DiscordId)
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	if len(report.Stale) > 0 {
+		fmt.Fprintf(w, "Stale mappings (%d): Discord no longer lists these SKUs. Remove each once it has no active entitlements:\n", len(report.Stale))
+		for _, sku := range report.Stale {
+			fmt.Fprintf(w, "  -- mapped to %s (%s)\n", sku.Label, sku.SkuId)
+			fmt.Fprintf(w, "  DELETE FROM discord_store_skus WHERE discord_id = %s;\n", sku.DiscordId)
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	if len(report.Duplicates) > 0 {
+		fmt.Fprintf(w, "Duplicate mappings (%d): these SKUs share an internal SKU. Check that they are intended to grant the same premium:\n", len(report.Duplicates))
+		for _, sku := range report.Duplicates {
+			name := sku.Name
+			if len(name) == 0 {
+				name = "unlisted"
+			}
+
+			fmt.Fprintf(w, "  %s (%s) -> %s (%s)\n", sku.DiscordId, name, sku.Label, sku.SkuId)
+		}
+
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+// pauseDeletions stops the running daemon from applying deletions until they are resumed: pause-deletions
+func pauseDeletions(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	return setDeletionsPaused(ctx, config, logger, args, true)
+}
+
+// resumeDeletions allows the running daemon to apply deletions again: resume-deletions
+func resumeDeletions(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	return setDeletionsPaused(ctx, config, logger, args, false)
+}
+
+func setDeletionsPaused(ctx context.Context, config config.Config, logger *zap.Logger, args []string, paused bool) error {
+	if len(args) != 0 {
+		return errors.New("usage: pause-deletions | resume-deletions")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	if err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).SetDeletionsPaused(ctx, paused); err != nil {
+		return err
+	}
+
+	logger.Info("Changed whether deletions are paused", zap.Bool("paused", paused))
+	return nil
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/planfile"
+	"go.uber.org/zap"
+)
+
+// plan writes the changes that a run would make to a signed plan file, and prints them for review: plan <file>
+func plan(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: plan <file>")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	file, err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(args[0], encoded, 0o600); err != nil {
+		return err
+	}
+
+	printPlan(os.Stdout, file.Changes)
+
+	logger.Info("Wrote plan file", zap.String("path", args[0]))
+	return nil
+}
+
+// apply applies the changes in a plan file written by plan, failing if they have drifted: apply <file>
+func apply(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: apply <file>")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	encoded, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var file planfile.File
+	if err := json.Unmarshal(encoded, &file); err != nil {
+		return fmt.Errorf("failed to decode plan file: %w", err)
+	}
+
+	if err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).ApplyPlan(ctx, file); err != nil {
+		return err
+	}
+
+	logger.Info(
+		"Applied plan file",
+		zap.String("path", args[0]),
+		zap.Int("creations", len(file.Changes.Creations)),
+		zap.Int("deletions", len(file.Changes.Deletions)+len(file.Changes.MissingDeletions)),
+	)
+
+	return nil
+}
+
+func printPlan(w io.Writer, changes planfile.Changes) {
+	if len(changes.Creations)+len(changes.Deletions)+len(changes.MissingDeletions) == 0 {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+
+	for _, creation := range changes.Creations {
+		action := "create"
+		if creation.EntitlementId != nil {
+			action = "refresh"
+		}
+
+		expiresAt := "never"
+		if creation.ExpiresAt != nil {
+			expiresAt = creation.ExpiresAt.String()
+		}
+
+		fmt.Fprintf(w, "  %-8s %d: %s, guild %s, user %s, expires %s\n", action, creation.DiscordId, creation.SkuLabel, formatOptionalId(creation.GuildId), formatOptionalId(creation.UserId), expiresAt)
+	}
+
+	for _, deletion := range changes.Deletions {
+		fmt.Fprintf(w, "  %-8s %d: entitlement %s, deleted by Discord\n", "delete", deletion.DiscordId, deletion.EntitlementId)
+	}
+
+	for _, deletion := range changes.MissingDeletions {
+		fmt.Fprintf(w, "  %-8s %d: entitlement %s, no longer listed by Discord\n", "delete", deletion.DiscordId, deletion.EntitlementId)
+	}
+}
+
+func formatOptionalId(id *uint64) string {
+	if id == nil {
+		return "none"
+	}
+
+	return fmt.Sprint(*id)
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+// purgeUser deletes all stored entitlement data for a user, for data deletion requests: purge-user <user-id>
+func purgeUser(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: purge-user <user-id>")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	userId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user ID %s: %w", args[0], err)
+	}
+
+	purged, err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).PurgeUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Purged user", zap.Int64("entitlements", purged))
+	return nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/backfill"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/churn"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+const reportUsage = "usage: report churn <before-file> <after-file> [<tier-sku-id>...]"
+
+// report prints a report computed from entitlement snapshots: report churn <before-file> <after-file> [<sku-id>...]
+func report(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) < 3 || args[0] != "churn" {
+		return errors.New(reportUsage)
+	}
+
+	tiers := make([]uint64, len(args)-3)
+	for i, arg := range args[3:] {
+		skuId, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SKU ID %s: %w", arg, err)
+		}
+
+		tiers[i] = skuId
+	}
+
+	before, err := backfill.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[1], err)
+	}
+
+	after, err := backfill.ReadFile(args[2])
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[2], err)
+	}
+
+	report := churn.Compare(before, after, tiers)
+	printChurnReport(os.Stdout, report)
+
+	logger.Info(
+		"Computed churn report",
+		zap.Int("gained", len(report.Gained)),
+		zap.Int("lost", len(report.Lost)),
+		zap.Int("upgraded", len(report.Upgraded)),
+		zap.Int("downgraded", len(report.Downgraded)),
+		zap.Int("changed", len(report.Changed)),
+	)
+
+	return nil
+}
+
+func printChurnReport(w io.Writer, report churn.Report) {
+	sections := []struct {
+		title   string
+		changes []churn.Change
+	}{
+		{"Gained", report.Gained},
+		{"Lost", report.Lost},
+		{"Upgraded", report.Upgraded},
+		{"Downgraded", report.Downgraded},
+		{"Changed", report.Changed},
+	}
+
+	for _, section := range sections {
+		fmt.Fprintf(w, "%s (%d):\n", section.title, len(section.changes))
+		for _, change := range section.changes {
+			fmt.Fprintf(w, "  %d: %s -> %s\n", change.GuildId, formatSkus(change.Before), formatSkus(change.After))
+		}
+
+		fmt.Fprintln(w)
+	}
+}
+
+func formatSkus(skus []uint64) string {
+	if len(skus) == 0 {
+		return "none"
+	}
+
+	formatted := make([]string, len(skus))
+	for i, skuId := range skus {
+		formatted[i] = strconv.FormatUint(skuId, 10)
+	}
+
+	return strings.Join(formatted, ", ")
+}
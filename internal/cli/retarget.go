@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+// retarget changes the guild that a user's entitlement activates: retarget <discord-entitlement-id> <guild-id>
+func retarget(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: retarget <discord-entitlement-id> <guild-id>")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	discordId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid discord entitlement ID %s: %w", args[0], err)
+	}
+
+	guildId, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid guild ID %s: %w", args[1], err)
+	}
+
+	if err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).Retarget(ctx, discordId, guildId); err != nil {
+		return err
+	}
+
+	logger.Info("Retargeted entitlement", zap.Uint64("discord_id", discordId), zap.Uint64("guild_id", guildId))
+	return nil
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/admin"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// undo restores the entitlements deleted by a run from the undo log: undo <run-id>
+func undo(ctx context.Context, config config.Config, logger *zap.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: undo <run-id>")
+	}
+
+	if len(config.AdminAddr) == 0 {
+		return errors.New("ADMIN_ADDR must be set to reach the running daemon")
+	}
+
+	runId, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid run ID %s: %w", args[0], err)
+	}
+
+	restored, err := admin.NewClient(config.AdminAddr, config.AdminAuthToken, config.AdminApplicationId).UndoRun(ctx, runId)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Undid run, deletions are now paused", zap.Int64("restored", restored))
+	return nil
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Command is a request from another service, published as JSON on the command channel
+type Command struct {
+	Type CommandType `json:"type"`
+	// GuildId restricts a sync to a single guild. If 0, the whole application is synced.
+	GuildId uint64 `json:"guild_id,omitempty"`
+}
+
+type CommandType string
+
+const (
+	// CommandTypeSync requests an immediate sync
+	CommandTypeSync CommandType = "sync"
+)
+
+// Subscriber receives commands published on a Redis channel
+type Subscriber struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewSubscriber creates a new Subscriber. redisUrl is in the form redis://[user:password@]host:port/db.
+func NewSubscriber(redisUrl, channel string) (*Subscriber, error) {
+	options, err := redis.ParseURL(redisUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Subscriber{
+		client:  redis.NewClient(options),
+		channel: channel,
+	}, nil
+}
+
+// Channel returns the name of the Redis channel that commands are received on
+func (s *Subscriber) Channel() string {
+	return s.channel
+}
+
+// Run calls handle for each command received until ctx is cancelled. The subscription is re-established
+// automatically if the connection to Redis is lost. Messages that are not valid commands are passed to onInvalid
+// instead.
+func (s *Subscriber) Run(ctx context.Context, handle func(Command), onInvalid func(payload string, err error)) error {
+	pubsub := s.client.Subscribe(ctx, s.channel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed, so that a misconfiguration is reported immediately
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", s.channel, err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var command Command
+			if err := json.Unmarshal([]byte(message.Payload), &command); err != nil {
+				onInvalid(message.Payload, err)
+				continue
+			}
+
+			handle(command)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close closes the connection to Redis
+func (s *Subscriber) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Application is an additional Discord application to sync, alongside DISCORD_APPLICATION_ID
+type Application struct {
+	Id    uint64
+	Token string
+}
+
+// UnmarshalText parses an application in the form <application_id>:<token>
+func (a *Application) UnmarshalText(text []byte) error {
+	id, token, ok := strings.Cut(string(text), ":")
+	if !ok || len(token) == 0 {
+		return fmt.Errorf("invalid application, expected <application_id>:<token>")
+	}
+
+	parsed, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid application ID %q: %w", id, err)
+	}
+
+	*a = Application{Id: parsed, Token: token}
+	return nil
+}
+
+// MultiApplication returns true if DISCORD_APPLICATIONS is set, in which case the entitlements table is shared by
+// several applications and the daemon must only consider the links created for its own application
+func (c Config) MultiApplication() bool {
+	return len(c.Discord.Applications) > 0
+}
+
+// RunConnections returns the number of database connections held for the duration of the runs of every application
+// at once: each run's transaction, and its advisory lock if ADVISORY_LOCK_ENABLED is set
+func (c Config) RunConnections() int {
+	perRun := 1
+	if c.AdvisoryLock.Enabled {
+		perRun = 2
+	}
+
+	return (1 + len(c.Discord.Applications)) * perRun
+}
+
+// PrimaryApplicationId returns the application configured by DISCORD_APPLICATION_ID. Links created before
+// DISCORD_APPLICATIONS was set are attributed to it.
+func (c Config) PrimaryApplicationId() uint64 {
+	if c.primaryApplicationId != 0 {
+		return c.primaryApplicationId
+	}
+
+	return c.Discord.ApplicationId
+}
+
+// ForApplication returns a copy of the config for syncing app. The outputs that only the primary application owns,
+// such as the queue, Redis commands and the database-wide jobs, are disabled, and files are written with the
+// application ID inserted before the extension so that the applications do not overwrite each other's.
+func (c Config) ForApplication(app Application) Config {
+	c.primaryApplicationId = c.PrimaryApplicationId()
+	c.Discord.ApplicationId = app.Id
+	c.Discord.Token = app.Token
+	c.Discord.TokenFile = ""
+	c.Discord.ClientId = 0
+	c.Discord.ClientSecret = ""
+
+	c.StatusFile = applicationPath(c.StatusFile, app.Id)
+	c.ErrorReportFile = applicationPath(c.ErrorReportFile, app.Id)
+	c.DryRunReportFile = applicationPath(c.DryRunReportFile, app.Id)
+
+	c.Shadow.DatabaseUri = ""
+	c.Redis.Url = ""
+	c.Queue.Url = ""
+	c.Stats.Enabled = false
+	c.ExpiryHook.Url = ""
+
+	return c
+}
+
+// applicationPath inserts the application ID before the extension of path, unless it is unset or "-"
+func applicationPath(path string, applicationId uint64) string {
+	if len(path) == 0 || path == "-" {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), applicationId, ext)
+}
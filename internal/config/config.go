@@ -1,33 +1,351 @@
 package config
 
 import (
+	"fmt"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/notify"
 	"github.com/caarlos0/env/v11"
 	"go.uber.org/zap/zapcore"
+	"net/netip"
+	"os"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Daemon           bool          `env:"DAEMON" envDefault:"true"`
-	RunFrequency     time.Duration `env:"RUN_FREQUENCY" envDefault:"1m"`
-	ExecutionTimeout time.Duration `env:"EXECUTION_TIMEOUT" envDefault:"5m"`
+	Daemon            bool          `env:"DAEMON" envDefault:"true"`
+	RunFrequency      time.Duration `env:"RUN_FREQUENCY" envDefault:"1m"`
+	ExecutionTimeout  time.Duration `env:"EXECUTION_TIMEOUT" envDefault:"5m"`
+	AdaptiveFrequency bool          `env:"ADAPTIVE_FREQUENCY" envDefault:"true"`
+	ProfileDir        string        `env:"PROFILE_DIR"`
+	StatusFile        string        `env:"STATUS_FILE"`
+	ErrorReportFile   string        `env:"ERROR_REPORT_FILE"`
+	DryRun            bool          `env:"DRY_RUN" envDefault:"false"`
+	DryRunReportFile  string        `env:"DRY_RUN_REPORT_FILE"`
+	BackfillFile      string        `env:"BACKFILL_FILE"`
+
+	SentryDsn              string  `env:"SENTRY_DSN" secret:"true"`
+	SentryEnvironment      string  `env:"SENTRY_ENVIRONMENT"`
+	SentryRelease          string  `env:"SENTRY_RELEASE"`
+	SentrySampleRate       float64 `env:"SENTRY_SAMPLE_RATE" envDefault:"1.0"`
+	SentryTracesSampleRate float64 `env:"SENTRY_TRACES_SAMPLE_RATE" envDefault:"0"`
+	DatadogTracing         bool    `env:"DATADOG_TRACING" envDefault:"false"`
 
-	SentryDsn string        `env:"SENTRY_DSN"`
 	JsonLogs  bool          `env:"JSON_LOGS" envDefault:"false"`
+	LogFormat string        `env:"LOG_FORMAT"`
 	LogLevel  zapcore.Level `env:"LOG_LEVEL" envDefault:"info"`
 
+	ComponentLogLevels struct {
+		Fetcher    *zapcore.Level `env:"FETCHER"`
+		Reconciler *zapcore.Level `env:"RECONCILER"`
+		Database   *zapcore.Level `env:"DATABASE"`
+	} `envPrefix:"LOG_LEVEL_"`
+
+	LogHashUserIds bool   `env:"LOG_HASH_USER_IDS" envDefault:"false"`
+	LogHashKey     string `env:"LOG_HASH_KEY" secret:"true"`
+
 	Discord struct {
 		ApplicationId uint64 `env:"APPLICATION_ID"`
-		Token         string `env:"TOKEN"`
+		Token         string `env:"TOKEN" secret:"true"`
+		TokenFile     string `env:"TOKEN_FILE"`
 		ProxyHost     string `env:"PROXY_HOST"`
+
+		// ClientId and ClientSecret authenticate with the OAuth2 client credentials grant instead of Token, if
+		// ClientSecret is set. ClientId defaults to ApplicationId.
+		ClientId     uint64 `env:"CLIENT_ID"`
+		ClientSecret string `env:"CLIENT_SECRET" secret:"true"`
+		OauthScope   string `env:"OAUTH_SCOPE" envDefault:"applications.entitlements"`
+
+		// Applications are synced alongside ApplicationId, each with its own sync loop
+		Applications []Application `env:"APPLICATIONS" secret:"true"`
+
+		UserAgent    string            `env:"USER_AGENT"`
+		ExtraHeaders map[string]string `env:"EXTRA_HEADERS" secret:"true"`
+
+		// ProxyTls configures mutual TLS to the proxy. When a client certificate is set, the proxy is connected to over
+		// HTTPS instead of plain HTTP.
+		ProxyTls struct {
+			CertFile   string `env:"CERT_FILE"`
+			KeyFile    string `env:"KEY_FILE"`
+			CaFile     string `env:"CA_FILE"`
+			ServerName string `env:"SERVER_NAME"`
+		} `envPrefix:"PROXY_TLS_"`
+
+		// Http tunes the transport used for all Discord (or proxy) requests
+		Http struct {
+			Timeout               time.Duration `env:"TIMEOUT" envDefault:"3s"`
+			DialTimeout           time.Duration `env:"DIAL_TIMEOUT" envDefault:"3s"`
+			TlsHandshakeTimeout   time.Duration `env:"TLS_HANDSHAKE_TIMEOUT" envDefault:"3s"`
+			ResponseHeaderTimeout time.Duration `env:"RESPONSE_HEADER_TIMEOUT" envDefault:"0s"`
+			KeepAlive             time.Duration `env:"KEEP_ALIVE" envDefault:"30s"`
+			IdleConnTimeout       time.Duration `env:"IDLE_CONN_TIMEOUT" envDefault:"90s"`
+			MaxIdleConnsPerHost   int           `env:"MAX_IDLE_CONNS_PER_HOST" envDefault:"4"`
+			Http2                 bool          `env:"HTTP2" envDefault:"true"`
+		} `envPrefix:"HTTP_"`
+
+		// Retry is the policy for retrying requests to list entitlements that fail with a transient error
+		Retry struct {
+			Attempts  int           `env:"ATTEMPTS" envDefault:"3"`
+			BaseDelay time.Duration `env:"BASE_DELAY" envDefault:"1s"`
+			MaxDelay  time.Duration `env:"MAX_DELAY" envDefault:"15s"`
+		} `envPrefix:"RETRY_"`
 	} `envPrefix:"DISCORD_"`
 
-	DatabaseUri string `env:"DATABASE_URI"`
+	ConfigAge struct {
+		Identity     string `env:"IDENTITY" secret:"true"`
+		IdentityFile string `env:"IDENTITY_FILE"`
+	} `envPrefix:"CONFIG_AGE_"`
+
+	DatabaseUri                string        `env:"DATABASE_URI" secret:"true"`
+	DatabaseTargetSessionAttrs string        `env:"DATABASE_TARGET_SESSION_ATTRS"`
+	DatabaseHealthCheckPeriod  time.Duration `env:"DATABASE_HEALTH_CHECK_PERIOD" envDefault:"15s"`
+	StoreBackend               StoreBackend  `env:"STORE_BACKEND" envDefault:"ticketsbot"`
+
+	SlowQueryThreshold time.Duration `env:"SLOW_QUERY_THRESHOLD" envDefault:"5s"`
+	SlowQueryExplain   bool          `env:"SLOW_QUERY_EXPLAIN" envDefault:"false"`
+
+	HttpDebug          bool `env:"HTTP_DEBUG" envDefault:"false"`
+	HttpDebugBodyLimit int  `env:"HTTP_DEBUG_BODY_LIMIT" envDefault:"1024"`
+
+	Shadow struct {
+		DatabaseUri string `env:"DATABASE_URI" secret:"true"`
+	} `envPrefix:"SHADOW_"`
+
+	Replica struct {
+		DatabaseUri string        `env:"DATABASE_URI" secret:"true"`
+		MaxLag      time.Duration `env:"MAX_LAG" envDefault:"30s"`
+	} `envPrefix:"REPLICA_"`
+
+	Bootstrap                bool           `env:"BOOTSTRAP" envDefault:"false"`
+	DeletionsPaused          bool           `env:"DELETIONS_PAUSED" envDefault:"false"`
+	DeletedEntitlementPolicy DeletionPolicy `env:"DELETED_ENTITLEMENT_POLICY" envDefault:"delete"`
+	MissingEntitlementPolicy DeletionPolicy `env:"MISSING_ENTITLEMENT_POLICY" envDefault:"delete"`
+	DeletionGracePeriod      time.Duration  `env:"DELETION_GRACE_PERIOD" envDefault:"24h"`
+
+	OwnerlessEntitlementPolicy OwnerlessPolicy `env:"OWNERLESS_ENTITLEMENT_POLICY" envDefault:"skip"`
+	StrictMode                 bool            `env:"STRICT_MODE" envDefault:"false"`
+
+	MaxRemovalsThreshold  int            `env:"MAX_REMOVALS_THRESHOLD" envDefault:"100"`
+	SkuRemovalThresholds  map[uint64]int `env:"SKU_REMOVAL_THRESHOLDS"`
+	MaxDeletionsPerRun    int            `env:"MAX_DELETIONS_PER_RUN" envDefault:"0"`
+	MaxCreationsThreshold int            `env:"MAX_CREATIONS_THRESHOLD" envDefault:"0"`
+	ReconcileConcurrency  int            `env:"RECONCILE_CONCURRENCY" envDefault:"4"`
+
+	WriteRateLimit float64 `env:"WRITE_RATE_LIMIT" envDefault:"0"`
+	WriteRateBurst int     `env:"WRITE_RATE_BURST" envDefault:"10"`
+
+	DbRetry struct {
+		Attempts  int           `env:"ATTEMPTS" envDefault:"3"`
+		BaseDelay time.Duration `env:"BASE_DELAY" envDefault:"500ms"`
+		MaxDelay  time.Duration `env:"MAX_DELAY" envDefault:"10s"`
+	} `envPrefix:"DB_RETRY_"`
+
+	PaginationAttempts int `env:"PAGINATION_ATTEMPTS" envDefault:"2"`
+
+	CountCheck struct {
+		Enabled   bool `env:"ENABLED" envDefault:"false"`
+		Tolerance int  `env:"TOLERANCE" envDefault:"0"`
+	} `envPrefix:"COUNT_CHECK_"`
+
+	SkuCacheTtl        time.Duration   `env:"SKU_CACHE_TTL" envDefault:"10m"`
+	UnknownSkuCacheTtl time.Duration   `env:"UNKNOWN_SKU_CACHE_TTL" envDefault:"5m"`
+	SkuTargetSource    SkuTargetSource `env:"SKU_TARGET_SOURCE" envDefault:"none"`
+
+	Redis struct {
+		Url            string `env:"URL" secret:"true"`
+		CommandChannel string `env:"COMMAND_CHANNEL" envDefault:"entitlements-sync:commands"`
+	} `envPrefix:"REDIS_"`
+
+	Queue struct {
+		Url  string `env:"URL" secret:"true"`
+		Name string `env:"NAME" envDefault:"entitlements-sync-runs"`
+	} `envPrefix:"QUEUE_"`
+
+	SkuMetadata struct {
+		Enabled         bool          `env:"ENABLED" envDefault:"false"`
+		RefreshInterval time.Duration `env:"REFRESH_INTERVAL" envDefault:"1h"`
+	} `envPrefix:"SKU_METADATA_"`
+
+	SkuListener struct {
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+	} `envPrefix:"SKU_LISTENER_"`
+
+	Gateway struct {
+		Enabled    bool `env:"ENABLED" envDefault:"false"`
+		ShardCount int  `env:"SHARD_COUNT" envDefault:"1"`
+	} `envPrefix:"GATEWAY_"`
+
+	SyncTestEntitlements bool     `env:"SYNC_TEST_ENTITLEMENTS" envDefault:"true"`
+	SkipEntitlementTypes []uint16 `env:"SKIP_ENTITLEMENT_TYPES"`
+	SkipGuildIds         []uint64 `env:"SKIP_GUILD_IDS"`
+	SkipNotStarted       bool     `env:"SKIP_NOT_STARTED" envDefault:"false"`
+	SkuPrecedence        []uint64 `env:"SKU_PRECEDENCE"`
+
+	RunLease struct {
+		Enabled  bool          `env:"ENABLED" envDefault:"false"`
+		Duration time.Duration `env:"DURATION" envDefault:"10m"`
+	} `envPrefix:"RUN_LEASE_"`
+
+	AdvisoryLock struct {
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+	} `envPrefix:"ADVISORY_LOCK_"`
+
+	PlanFile struct {
+		SigningKey string `env:"SIGNING_KEY" secret:"true"`
+	} `envPrefix:"PLAN_"`
 
-	MaxRemovalsThreshold int `env:"MAX_REMOVALS_THRESHOLD" envDefault:"100"`
+	SnapshotReuse struct {
+		Enabled bool          `env:"ENABLED" envDefault:"false"`
+		MaxAge  time.Duration `env:"MAX_AGE" envDefault:"15m"`
+	} `envPrefix:"SNAPSHOT_REUSE_"`
+
+	UndoLog struct {
+		Enabled   bool          `env:"ENABLED" envDefault:"false"`
+		Retention time.Duration `env:"RETENTION" envDefault:"720h"`
+	} `envPrefix:"UNDO_LOG_"`
+
+	StableIds struct {
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+	} `envPrefix:"STABLE_IDS_"`
+
+	RenewalEvents struct {
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+	} `envPrefix:"RENEWAL_EVENTS_"`
+
+	Stats struct {
+		Enabled bool          `env:"ENABLED" envDefault:"false"`
+		Periods []StatsPeriod `env:"PERIODS" envDefault:"month"`
+	} `envPrefix:"STATS_"`
+
+	DeadLetter struct {
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+	} `envPrefix:"DEAD_LETTER_"`
+
+	DeletionQuarantine struct {
+		Enabled   bool `env:"ENABLED" envDefault:"false"`
+		Threshold int  `env:"THRESHOLD" envDefault:"5"`
+	} `envPrefix:"DELETION_QUARANTINE_"`
+
+	ShardIndex int `env:"SHARD_INDEX" envDefault:"0"`
+	ShardCount int `env:"SHARD_COUNT" envDefault:"1"`
+
+	Retarget struct {
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+	} `envPrefix:"RETARGET_"`
+
+	UserPurge struct {
+		Enabled bool   `env:"ENABLED" envDefault:"false"`
+		HashKey string `env:"HASH_KEY" secret:"true"`
+	} `envPrefix:"USER_PURGE_"`
+
+	ActivationHook struct {
+		Url       string        `env:"URL"`
+		AuthToken string        `env:"AUTH_TOKEN" secret:"true"`
+		Timeout   time.Duration `env:"TIMEOUT" envDefault:"5s"`
+	} `envPrefix:"ACTIVATION_HOOK_"`
+
+	ExpiryHook struct {
+		Url       string        `env:"URL"`
+		AuthToken string        `env:"AUTH_TOKEN" secret:"true"`
+		Timeout   time.Duration `env:"TIMEOUT" envDefault:"5s"`
+		Window    time.Duration `env:"WINDOW" envDefault:"72h"`
+	} `envPrefix:"EXPIRY_HOOK_"`
+
+	GuildHook struct {
+		Url       string        `env:"URL"`
+		AuthToken string        `env:"AUTH_TOKEN" secret:"true"`
+		Timeout   time.Duration `env:"TIMEOUT" envDefault:"5s"`
+	} `envPrefix:"GUILD_HOOK_"`
+
+	UnknownSkuEscalation struct {
+		WarnAfter   int `env:"WARN_AFTER" envDefault:"3"`
+		ErrorAfter  int `env:"ERROR_AFTER" envDefault:"10"`
+		NotifyAfter int `env:"NOTIFY_AFTER" envDefault:"30"`
+	} `envPrefix:"UNKNOWN_SKU_"`
+
+	AdminAddr         string         `env:"ADMIN_ADDR"`
+	AdminAuthToken    string         `env:"ADMIN_AUTH_TOKEN" secret:"true"`
+	AdminAllowedCidrs []netip.Prefix `env:"ADMIN_ALLOWED_CIDRS"`
+	HealthStaleness   time.Duration  `env:"HEALTH_STALENESS" envDefault:"15m"`
+	// AdminApplicationId is the application that CLI commands act on, see DISCORD_APPLICATIONS
+	AdminApplicationId uint64 `env:"ADMIN_APPLICATION_ID"`
+
+	Pushgateway struct {
+		Url string `env:"URL"`
+		Job string `env:"JOB" envDefault:"entitlements_sync"`
+	} `envPrefix:"PUSHGATEWAY_"`
+
+	MetricsFile string `env:"METRICS_FILE"`
+
+	OtlpMetrics struct {
+		Endpoint string        `env:"ENDPOINT"`
+		Insecure bool          `env:"INSECURE" envDefault:"false"`
+		Interval time.Duration `env:"INTERVAL" envDefault:"30s"`
+	} `envPrefix:"OTLP_METRICS_"`
+
+	Flags struct {
+		OfrepUrl  string `env:"OFREP_URL"`
+		AuthToken string `env:"AUTH_TOKEN" secret:"true"`
+	} `envPrefix:"FLAGS_"`
+
+	Slack struct {
+		WebhookUrl  string          `env:"WEBHOOK_URL" secret:"true"`
+		MinSeverity notify.Severity `env:"MIN_SEVERITY" envDefault:"warning"`
+	} `envPrefix:"SLACK_"`
+
+	Teams struct {
+		WebhookUrl  string          `env:"WEBHOOK_URL" secret:"true"`
+		MinSeverity notify.Severity `env:"MIN_SEVERITY" envDefault:"warning"`
+	} `envPrefix:"TEAMS_"`
+
+	NotifyWebhook struct {
+		Url         string          `env:"URL" secret:"true"`
+		MinSeverity notify.Severity `env:"MIN_SEVERITY" envDefault:"warning"`
+	} `envPrefix:"NOTIFY_WEBHOOK_"`
+
+	// primaryApplicationId is the application configured by DISCORD_APPLICATION_ID, set by ForApplication
+	primaryApplicationId uint64
 }
 
 func LoadFromEnv() (Config, error) {
 	var config Config
-	err := env.Parse(&config)
-	return config, err
+	if err := env.Parse(&config); err != nil {
+		return Config{}, err
+	}
+
+	if err := config.decryptSecrets(); err != nil {
+		return Config{}, err
+	}
+
+	if len(config.BackfillFile) > 0 && config.Daemon {
+		return Config{}, fmt.Errorf("BACKFILL_FILE cannot be used in daemon mode")
+	}
+
+	if len(config.Discord.TokenFile) > 0 {
+		token, err := os.ReadFile(config.Discord.TokenFile)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read DISCORD_TOKEN_FILE: %w", err)
+		}
+
+		config.Discord.Token = strings.TrimSpace(string(token))
+	}
+
+	if len(config.Discord.ClientSecret) > 0 && config.Gateway.Enabled {
+		return Config{}, fmt.Errorf("GATEWAY_ENABLED requires a bot token, and cannot be used with DISCORD_CLIENT_SECRET")
+	}
+
+	for _, app := range config.Discord.Applications {
+		if app.Id == config.Discord.ApplicationId {
+			return Config{}, fmt.Errorf("DISCORD_APPLICATIONS must not include DISCORD_APPLICATION_ID %d", app.Id)
+		}
+	}
+
+	if config.ShardCount < 1 {
+		return Config{}, fmt.Errorf("SHARD_COUNT must be at least 1, got %d", config.ShardCount)
+	}
+
+	if config.ShardIndex < 0 || config.ShardIndex >= config.ShardCount {
+		return Config{}, fmt.Errorf("SHARD_INDEX must be between 0 and SHARD_COUNT-1, got %d", config.ShardIndex)
+	}
+
+	return config, nil
 }
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// encryptedPrefix marks a setting whose value is encrypted with age, e.g. age:<base64 ciphertext>
+const encryptedPrefix = "age:"
+
+// decryptSecrets replaces the value of each setting tagged secret that is encrypted with age with its plaintext,
+// using the identities from CONFIG_AGE_IDENTITY_FILE or CONFIG_AGE_IDENTITY
+func (c *Config) decryptSecrets() error {
+	var identities []age.Identity
+	loadIdentities := func() ([]age.Identity, error) {
+		if identities != nil {
+			return identities, nil
+		}
+
+		var keys io.Reader
+		switch {
+		case len(c.ConfigAge.IdentityFile) > 0:
+			f, err := os.Open(c.ConfigAge.IdentityFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CONFIG_AGE_IDENTITY_FILE: %w", err)
+			}
+
+			defer f.Close()
+			keys = f
+		case len(c.ConfigAge.Identity) > 0:
+			keys = strings.NewReader(c.ConfigAge.Identity)
+		default:
+			return nil, errors.New("CONFIG_AGE_IDENTITY_FILE or CONFIG_AGE_IDENTITY must be set to decrypt encrypted settings")
+		}
+
+		parsed, err := age.ParseIdentities(keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age identities: %w", err)
+		}
+
+		identities = parsed
+		return identities, nil
+	}
+
+	return decryptStruct(reflect.ValueOf(c).Elem(), "", loadIdentities)
+}
+
+func decryptStruct(v reflect.Value, prefix string, loadIdentities func() ([]age.Identity, error)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct && field.Tag.Get("envPrefix") != "" {
+			if err := decryptStruct(value, prefix+field.Tag.Get("envPrefix"), loadIdentities); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if field.Tag.Get("secret") != "true" || field.Type.Kind() != reflect.String || !strings.HasPrefix(value.String(), encryptedPrefix) {
+			continue
+		}
+
+		identities, err := loadIdentities()
+		if err != nil {
+			return err
+		}
+
+		plaintext, err := decryptValue(strings.TrimPrefix(value.String(), encryptedPrefix), identities)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", prefix+field.Tag.Get("env"), err)
+		}
+
+		value.SetString(plaintext)
+	}
+
+	return nil
+}
+
+func decryptValue(encoded string, identities []age.Identity) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("invalid base64: %w", err)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(plaintext)), nil
+}
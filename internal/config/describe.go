@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Describe returns the effective value of each setting, keyed by its environment variable, in the same format that
+// the variable is parsed from. Settings tagged secret are redacted if they are set.
+func (c Config) Describe() map[string]string {
+	values := make(map[string]string)
+	describeStruct(reflect.ValueOf(c), "", values)
+	return values
+}
+
+func describeStruct(v reflect.Value, prefix string, values map[string]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Type.Kind() == reflect.Struct && field.Tag.Get("envPrefix") != "" {
+			describeStruct(value, prefix+field.Tag.Get("envPrefix"), values)
+			continue
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+
+		formatted := formatValue(value)
+		if field.Tag.Get("secret") == "true" && len(formatted) > 0 {
+			formatted = redacted
+		}
+
+		values[prefix+name] = formatted
+	}
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+
+		return strings.Join(items, ",")
+	case reflect.Map:
+		items := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			items = append(items, formatValue(iter.Key())+":"+formatValue(iter.Value()))
+		}
+
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeletionPolicy is how entitlements that should no longer exist are removed from the database
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the entitlement in the same run that it is found to have been removed
+	DeletionPolicyDelete DeletionPolicy = "delete"
+	// DeletionPolicyGrace deletes the entitlement once it has been removed for DELETION_GRACE_PERIOD
+	DeletionPolicyGrace DeletionPolicy = "grace"
+	// DeletionPolicyIgnore never deletes the entitlement
+	DeletionPolicyIgnore DeletionPolicy = "ignore"
+)
+
+func (p *DeletionPolicy) UnmarshalText(text []byte) error {
+	switch policy := DeletionPolicy(strings.ToLower(string(text))); policy {
+	case DeletionPolicyDelete, DeletionPolicyGrace, DeletionPolicyIgnore:
+		*p = policy
+	default:
+		return fmt.Errorf("unknown deletion policy %s, expected one of: delete, grace, ignore", text)
+	}
+
+	return nil
+}
+
+// OwnerlessPolicy is how entitlements listed by Discord with neither a guild nor a user are handled
+type OwnerlessPolicy string
+
+const (
+	// OwnerlessPolicySkip skips the entitlement, counting it in the skipped metric
+	OwnerlessPolicySkip OwnerlessPolicy = "skip"
+	// OwnerlessPolicyError fails the run without applying any changes
+	OwnerlessPolicyError OwnerlessPolicy = "error"
+	// OwnerlessPolicyDeadLetter skips the entitlement and records it in the entitlement_dead_letters table
+	OwnerlessPolicyDeadLetter OwnerlessPolicy = "dead_letter"
+)
+
+func (p *OwnerlessPolicy) UnmarshalText(text []byte) error {
+	switch policy := OwnerlessPolicy(strings.ToLower(string(text))); policy {
+	case OwnerlessPolicySkip, OwnerlessPolicyError, OwnerlessPolicyDeadLetter:
+		*p = policy
+	default:
+		return fmt.Errorf("unknown ownerless entitlement policy %s, expected one of: skip, error, dead_letter", text)
+	}
+
+	return nil
+}
+
+// StoreBackend is the schema that entitlements are synced into
+type StoreBackend string
+
+const (
+	// StoreBackendTicketsBot writes to the tables of the TicketsBot database, which must already exist
+	StoreBackendTicketsBot StoreBackend = "ticketsbot"
+	// StoreBackendStandalone creates the tables that the sync needs if they do not exist, for use without the rest
+	// of the TicketsBot database
+	StoreBackendStandalone StoreBackend = "standalone"
+)
+
+func (b *StoreBackend) UnmarshalText(text []byte) error {
+	switch backend := StoreBackend(strings.ToLower(string(text))); backend {
+	case StoreBackendTicketsBot, StoreBackendStandalone:
+		*b = backend
+	default:
+		return fmt.Errorf("unknown store backend %s, expected one of: ticketsbot, standalone", text)
+	}
+
+	return nil
+}
+
+// StatsPeriod is a period that aggregate subscription stats are computed over
+type StatsPeriod string
+
+const (
+	// StatsPeriodWeek is a calendar week in UTC, starting on Monday
+	StatsPeriodWeek StatsPeriod = "week"
+	// StatsPeriodMonth is a calendar month in UTC
+	StatsPeriodMonth StatsPeriod = "month"
+)
+
+func (p *StatsPeriod) UnmarshalText(text []byte) error {
+	switch period := StatsPeriod(strings.ToLower(string(text))); period {
+	case StatsPeriodWeek, StatsPeriodMonth:
+		*p = period
+	default:
+		return fmt.Errorf("unknown stats period %s, expected one of: week, month", text)
+	}
+
+	return nil
+}
+
+// SkuTargetSource is where the flags of each SKU, which determine whether its entitlements belong to a guild or a
+// user, are read from
+type SkuTargetSource string
+
+const (
+	// SkuTargetSourceNone does not read SKU flags, and stores both the guild and user of each entitlement
+	SkuTargetSourceNone SkuTargetSource = "none"
+	// SkuTargetSourceDiscord reads SKU flags from the Discord API
+	SkuTargetSourceDiscord SkuTargetSource = "discord"
+	// SkuTargetSourceDatabase reads SKU flags from the discord_sku_flags table
+	SkuTargetSourceDatabase SkuTargetSource = "database"
+)
+
+func (s *SkuTargetSource) UnmarshalText(text []byte) error {
+	switch source := SkuTargetSource(strings.ToLower(string(text))); source {
+	case SkuTargetSourceNone, SkuTargetSourceDiscord, SkuTargetSourceDatabase:
+		*s = source
+	default:
+		return fmt.Errorf("unknown SKU target source %s, expected one of: none, discord, database", text)
+	}
+
+	return nil
+}
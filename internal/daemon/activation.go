@@ -0,0 +1,39 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/activation"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"go.uber.org/zap"
+)
+
+func newActivationHook(config config.Config) *activation.Hook {
+	if len(config.ActivationHook.Url) == 0 {
+		return nil
+	}
+
+	return activation.NewHook(config.ActivationHook.Url, config.ActivationHook.AuthToken, config.ActivationHook.Timeout)
+}
+
+// notifyActivations calls the activation hook for each newly created entitlement. It must only be called once the
+// entitlements have been committed, so that the premium pipeline can read them. Failures are logged rather than
+// failing the run, as the entitlements have already been granted.
+func (d *Daemon) notifyActivations(ctx context.Context, activations []activation.Activation) {
+	if d.activationHook == nil {
+		return
+	}
+
+	for _, activation := range activations {
+		if err := d.activationHook.Activated(ctx, activation); err != nil {
+			metrics.ActivationHookFailures.WithLabelValues(d.applicationLabel).Inc()
+			fields := d.identityFields(activation.DiscordId, 0, activation.GuildId, activation.UserId)
+			d.logger.Error("Failed to call activation hook", append(fields, zap.String("entitlement_id", activation.EntitlementId.String()), zap.Error(err))...)
+
+			continue
+		}
+
+		d.logger.Debug("Called activation hook", d.identityFields(activation.DiscordId, 0, activation.GuildId, activation.UserId)...)
+	}
+}
@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// advisoryLockKey derives the key of the advisory lock from the lease name, so that shards and applications do not
+// contend for the same lock
+func (d *Daemon) advisoryLockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(d.leaseName()))
+	return int64(h.Sum64())
+}
+
+// acquireAdvisoryLock takes a session-level Postgres advisory lock, so that only one of several replicas of the
+// daemon runs at a time. The lock is held on a connection taken out of the pool for the duration of the run, and so
+// is released by Postgres if the process dies. If another instance holds the lock, ok is false.
+func (d *Daemon) acquireAdvisoryLock(ctx context.Context) (release func(), ok bool, err error) {
+	conn, err := d.db().pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := d.advisoryLockKey()
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1);", key).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, err
+	}
+
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	release = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+		defer cancel()
+
+		// If the lock cannot be released, the connection is closed rather than returned to the pool, as the lock is
+		// held until the session ends
+		if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1);", key); err != nil {
+			d.logger.Warn("Failed to release advisory lock, closing connection", zap.Error(err))
+			_ = conn.Conn().Close(ctx)
+		}
+
+		conn.Release()
+	}
+
+	return release, true, nil
+}
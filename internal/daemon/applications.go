@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	//go:embed sql/applications_schema.sql
+	applicationsSchema string
+
+	//go:embed sql/list_app_links_page.sql
+	listAppLinksPageQuery string
+
+	//go:embed sql/list_unstaged_app_links.sql
+	listUnstagedAppLinksQuery string
+)
+
+// tagApplications records the application that each link was created by in discord_entitlement_applications, when
+// DISCORD_APPLICATIONS is set. Links are never moved between applications, so existing tags are left as they are.
+func (d *Daemon) tagApplications(ctx context.Context, tx pgx.Tx, links []link) error {
+	if !d.config.MultiApplication() || len(links) == 0 {
+		return nil
+	}
+
+	return d.db().store.TagApplications(ctx, tx, links, d.config.Discord.ApplicationId)
+}
+
+// queryLinksPage fetches a page of links after the given Discord ID. When DISCORD_APPLICATIONS is set, only the
+// links of this application are included, so that the links of the other applications are not mistaken for
+// entitlements that Discord no longer lists.
+func (d *Daemon) queryLinksPage(ctx context.Context, tx pgx.Tx, after uint64) (pgx.Rows, error) {
+	if !d.config.MultiApplication() {
+		return tx.Query(ctx, listLinksPageQuery, after, linkPageSize)
+	}
+
+	return tx.Query(ctx, listAppLinksPageQuery, after, linkPageSize, d.config.PrimaryApplicationId(), d.config.Discord.ApplicationId)
+}
+
+// queryUnstagedLinks fetches the links of entitlements missing from staged_entitlements, up to limit per SKU, with
+// the same restriction to this application's links as queryLinksPage
+func (d *Daemon) queryUnstagedLinks(ctx context.Context, tx pgx.Tx, limit int) (pgx.Rows, error) {
+	if !d.config.MultiApplication() {
+		return tx.Query(ctx, listUnstagedLinksQuery, limit, d.config.ShardCount, d.config.ShardIndex)
+	}
+
+	return tx.Query(
+		ctx,
+		listUnstagedAppLinksQuery,
+		limit,
+		d.config.ShardCount,
+		d.config.ShardIndex,
+		d.config.PrimaryApplicationId(),
+		d.config.Discord.ApplicationId,
+	)
+}
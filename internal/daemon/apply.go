@@ -0,0 +1,267 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/activation"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// applyPlan writes the planned changes to the database. Changes for each SKU are applied concurrently by up to
+// RECONCILE_CONCURRENCY workers shared by all the applications, each in its own transaction, after which missing
+// entitlements are deleted in tx.
+// The entitlements that were newly created are returned.
+func (d *Daemon) applyPlan(ctx context.Context, tx pgx.Tx, p plan) ([]activation.Activation, error) {
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(max(d.config.ReconcileConcurrency, 1))
+
+	var (
+		mu          sync.Mutex
+		activations []activation.Activation
+	)
+	for skuId, part := range p.partitionBySku() {
+		group.Go(func() error {
+			if err := d.workers.Acquire(groupCtx, 1); err != nil {
+				return err
+			}
+			defer d.workers.Release(1)
+
+			return d.applyPartition(groupCtx, skuId, part, func(created []activation.Activation) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				activations = append(activations, created...)
+			})
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	if len(p.MissingDeletions) == 0 {
+		return activations, nil
+	}
+
+	ids := make([]uuid.UUID, len(p.MissingDeletions))
+	for i, deletion := range p.MissingDeletions {
+		d.logger.Info("Deleting missing entitlement", append(d.deletionFields(deletion), zap.String("entitlement_id", deletion.EntitlementId.String()))...)
+		ids[i] = deletion.EntitlementId
+	}
+
+	var deleted int64
+	batchSize := d.writeBatchSize(len(ids))
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		if err := d.throttleWrites(ctx, len(batch)); err != nil {
+			return nil, err
+		}
+
+		if err := d.recordUndo(ctx, tx, batch); err != nil {
+			return nil, err
+		}
+
+		count, err := d.db().store.DeleteEntitlements(ctx, tx, batch)
+		if err != nil {
+			d.logger.Error("Failed to delete entitlements", zap.Int("count", len(batch)), zap.Error(err))
+			return nil, wrapDbError(err)
+		}
+
+		deleted += count
+	}
+
+	d.logger.Debug("Deleted missing entitlements", zap.Int64("count", deleted))
+
+	return activations, nil
+}
+
+// sizeWorkers limits the SKUs reconciled at once to RECONCILE_CONCURRENCY, shared between this daemon and the
+// attached applications. The limit is lowered if the pool does not have a connection for every worker once the run
+// of each application holds its own, as a run waiting on a connection held by another would never finish.
+func (d *Daemon) sizeWorkers() {
+	workers := max(d.config.ReconcileConcurrency, 1)
+	maxConns := d.db().pool.Config().MaxConns
+	available := int(maxConns) - d.config.RunConnections()
+
+	if available < workers {
+		fields := []zap.Field{zap.Int32("pool_max_conns", maxConns), zap.Int("run_connections", d.config.RunConnections()), zap.Int("reconcile_concurrency", workers)}
+		if available < 1 {
+			d.logger.Warn("pool_max_conns is too small for every application to run at once, runs may time out waiting for a connection", fields...)
+		} else {
+			d.logger.Warn("pool_max_conns is too small for RECONCILE_CONCURRENCY, reconciling fewer SKUs at once", append(fields, zap.Int("workers", available))...)
+		}
+
+		workers = max(available, 1)
+	}
+
+	d.workers = semaphore.NewWeighted(int64(workers))
+	for _, app := range d.applications {
+		app.workers = d.workers
+	}
+}
+
+// applyPartition applies the changes for a single SKU in its own transaction. Deletions of entitlements flagged as
+// deleted are applied first, so that a replacement entitlement for the same guild, user and SKU is not removed.
+// onCommit is called with the newly created entitlements once the transaction has been committed.
+func (d *Daemon) applyPartition(ctx context.Context, skuId uuid.UUID, part *partition, onCommit func([]activation.Activation)) error {
+	logger := d.logger.With(zap.String("internal_sku_id", skuId.String()))
+
+	tx, err := d.beginRunTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer rollback(tx)
+
+	deletionIds := make([]uuid.UUID, len(part.Deletions))
+	for i, deletion := range part.Deletions {
+		deletionIds[i] = deletion.EntitlementId
+	}
+
+	if err := d.recordUndo(ctx, tx, deletionIds); err != nil {
+		return err
+	}
+
+	for _, deletion := range part.Deletions {
+		logger.Info("Found deleted entitlement", append(d.deletionFields(deletion), zap.String("entitlement_id", deletion.EntitlementId.String()))...)
+
+		if err := d.throttleWrites(ctx, 1); err != nil {
+			return err
+		}
+
+		if err := d.db().store.DeleteEntitlement(ctx, tx, deletion.EntitlementId); err != nil {
+			logger.Error("Failed to delete entitlement", zap.Error(err))
+			return wrapDbError(err)
+		}
+	}
+
+	previousIds, err := d.previousEntitlementIds(ctx, tx, part.Creations)
+	if err != nil {
+		logger.Error("Failed to read previous entitlement IDs", zap.Error(err))
+		return err
+	}
+
+	expiries, err := d.currentExpiries(ctx, tx, part.Creations)
+	if err != nil {
+		logger.Error("Failed to read entitlement expiries", zap.Error(err))
+		return err
+	}
+
+	links := make([]link, 0, len(part.Creations))
+	var (
+		activations []activation.Activation
+		renewals    []renewal
+	)
+	for _, creation := range part.Creations {
+		entitlement := creation.Entitlement
+		fields := d.identityFields(entitlement.Id, entitlement.SkuId, creation.GuildId, creation.UserId)
+
+		if err := d.throttleWrites(ctx, 1); err != nil {
+			return err
+		}
+
+		var created model.Entitlement
+		violation, err := d.withSavepoint(ctx, tx, func(tx pgx.Tx) error {
+			var err error
+			created, err = d.createEntitlement(ctx, tx, creation, previousIds[entitlement.Id])
+			if err != nil {
+				logger.Error("Failed to create entitlement", append(fields, zap.Error(err))...)
+				return err
+			}
+
+			// The owners of an existing entitlement can change when the SKU's target is resolved, in which case the
+			// upsert creates a new row, and the row it replaces must be removed, unless nothing is to be deleted
+			if creation.Linked && created.Id != creation.EntitlementId && !d.config.Bootstrap {
+				logger.Info("Replacing entitlement with changed owners", append(fields, zap.String("entitlement_id", creation.EntitlementId.String()))...)
+
+				if err := d.recordUndo(ctx, tx, []uuid.UUID{creation.EntitlementId}); err != nil {
+					return err
+				}
+
+				if err := d.db().store.DeleteEntitlement(ctx, tx, creation.EntitlementId); err != nil {
+					logger.Error("Failed to delete replaced entitlement", append(fields, zap.Error(err))...)
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return wrapDbError(err)
+		}
+
+		if violation != nil {
+			logger.Warn("Dead-lettering entitlement that violates a constraint", append(fields, zap.Error(violation))...)
+
+			if err := d.deadLetter(ctx, tx, creation, violation); err != nil {
+				logger.Error("Failed to record dead letter", append(fields, zap.Error(err))...)
+				return wrapDbError(err)
+			}
+
+			continue
+		}
+
+		links = append(links, link{DiscordId: entitlement.Id, EntitlementId: created.Id})
+
+		if renewal, ok := renewalOf(creation, created, expiries); ok {
+			renewals = append(renewals, renewal)
+		}
+
+		if !creation.Linked {
+			activations = append(activations, activation.Activation{
+				EntitlementId: created.Id,
+				DiscordId:     entitlement.Id,
+				GuildId:       creation.GuildId,
+				UserId:        creation.UserId,
+				SkuId:         creation.Sku.Id,
+				SkuLabel:      creation.Sku.Label,
+				ExpiresAt:     entitlement.EndsAt,
+			})
+		}
+
+		logger.Debug("Created entitlement", append(fields, zap.String("entitlement_id", created.Id.String()), zap.Timep("expires_at", created.ExpiresAt))...)
+	}
+
+	// Link entitlements to discord IDs
+	if err := d.db().store.InsertLinks(ctx, tx, links); err != nil {
+		logger.Error("Failed to link entitlements", zap.Int("count", len(links)), zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.tagApplications(ctx, tx, links); err != nil {
+		logger.Error("Failed to tag entitlements with their application", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.recordEntitlementIds(ctx, tx, links); err != nil {
+		logger.Error("Failed to record entitlement IDs", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.clearDeadLetters(ctx, tx, links); err != nil {
+		return wrapDbError(err)
+	}
+
+	if err := d.recordRenewals(ctx, tx, renewals); err != nil {
+		logger.Error("Failed to record renewals", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return wrapDbError(err)
+	}
+
+	metrics.Renewals.WithLabelValues(d.applicationLabel).Add(float64(len(renewals)))
+
+	onCommit(activations)
+	d.notifyActivations(ctx, activations)
+
+	return nil
+}
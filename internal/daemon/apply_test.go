@@ -0,0 +1,367 @@
+package daemon
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	testDiscordSkuId = 1000
+	testGuildId      = 2000
+)
+
+var testSku = model.Sku{Id: uuid.MustParse("00000000-0000-0000-0000-000000000001"), Label: "premium"}
+
+func newTestDaemon(cfg config.Config, s store.EntitlementStore) *Daemon {
+	d := &Daemon{
+		config:           cfg,
+		logger:           zap.NewNop(),
+		workers:          semaphore.NewWeighted(int64(max(cfg.ReconcileConcurrency, 1))),
+		writeLimiter:     newWriteLimiter(cfg),
+		applicationLabel: "test",
+	}
+
+	d.dbs.Store(&databases{store: s})
+	return d
+}
+
+func newTestStore() *store.Memory {
+	s := store.NewMemory()
+	s.AddSku(testDiscordSkuId, testSku)
+	return s
+}
+
+func testCreation(discordId uint64, sku model.Sku, expiresAt *time.Time) plannedCreation {
+	guildId := uint64(testGuildId)
+	return plannedCreation{
+		Entitlement: entitlement.Entitlement{Id: discordId, SkuId: testDiscordSkuId, GuildId: &guildId, EndsAt: expiresAt},
+		Sku:         sku,
+		GuildId:     &guildId,
+	}
+}
+
+func testEntitlement(guildId uint64, expiresAt *time.Time) model.Entitlement {
+	return model.Entitlement{
+		Id:        uuid.New(),
+		GuildId:   &guildId,
+		SkuId:     testSku.Id,
+		Source:    model.EntitlementSourceDiscord,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// applyTestPlan applies p as a run would, committing the transaction that missing entitlements are deleted in
+func applyTestPlan(d *Daemon, p plan) error {
+	ctx := context.Background()
+
+	tx, err := d.beginRunTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer rollback(tx)
+
+	if _, err := d.applyPlan(ctx, tx, p); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func TestApplyPlan(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	renewedAt := expiresAt.AddDate(0, 1, 0)
+	existing := testEntitlement(testGuildId, &expiresAt)
+
+	// otherSku is not mapped in the store, so creating an entitlement for it violates the foreign key
+	otherSku := model.Sku{Id: uuid.MustParse("00000000-0000-0000-0000-000000000002"), Label: "unmapped"}
+	secondSku := model.Sku{Id: uuid.MustParse("00000000-0000-0000-0000-000000000003"), Label: "whitelabel"}
+	stale := testEntitlement(testGuildId, nil)
+	stale.SkuId = otherSku.Id
+
+	tests := []struct {
+		name    string
+		config  func(*config.Config)
+		seed    func(*store.Memory)
+		plan    plan
+		wantErr bool
+		check   func(*testing.T, *store.Memory)
+	}{
+		{
+			name: "creates and links new entitlement",
+			plan: plan{Creations: []plannedCreation{testCreation(1, testSku, &expiresAt)}},
+			check: func(t *testing.T, s *store.Memory) {
+				id, ok := s.Links()[1]
+				if !ok {
+					t.Fatal("entitlement was not linked")
+				}
+
+				created, ok := s.Entitlements()[id]
+				if !ok {
+					t.Fatalf("linked entitlement %s does not exist", id)
+				}
+
+				if created.SkuId != testSku.Id || created.GuildId == nil || *created.GuildId != testGuildId {
+					t.Errorf("created %+v, want guild %d and SKU %s", created, testGuildId, testSku.Id)
+				}
+			},
+		},
+		{
+			name: "refreshes expiry of linked entitlement in place",
+			config: func(cfg *config.Config) {
+				cfg.RenewalEvents.Enabled = true
+			},
+			seed: func(s *store.Memory) {
+				s.AddEntitlement(1, existing)
+			},
+			plan: plan{Creations: []plannedCreation{func() plannedCreation {
+				creation := testCreation(1, testSku, &renewedAt)
+				creation.Linked = true
+				creation.EntitlementId = existing.Id
+				return creation
+			}()}},
+			check: func(t *testing.T, s *store.Memory) {
+				entitlements := s.Entitlements()
+				if len(entitlements) != 1 {
+					t.Fatalf("got %d entitlements, want 1", len(entitlements))
+				}
+
+				refreshed := entitlements[existing.Id]
+				if refreshed.ExpiresAt == nil || !refreshed.ExpiresAt.Equal(renewedAt) {
+					t.Errorf("expires at %v, want %v", refreshed.ExpiresAt, renewedAt)
+				}
+
+				if renewals := s.Renewals(); len(renewals) != 1 || renewals[0].PreviousExpiresAt != expiresAt {
+					t.Errorf("got renewals %+v, want one from %v", renewals, expiresAt)
+				}
+			},
+		},
+		{
+			name: "deletes flagged entitlement and records it in undo log",
+			config: func(cfg *config.Config) {
+				cfg.UndoLog.Enabled = true
+			},
+			seed: func(s *store.Memory) {
+				s.AddEntitlement(1, existing)
+			},
+			plan: plan{Deletions: []plannedDeletion{{DiscordId: 1, EntitlementId: existing.Id, SkuId: testSku.Id}}},
+			check: func(t *testing.T, s *store.Memory) {
+				if _, ok := s.Entitlements()[existing.Id]; ok {
+					t.Error("entitlement was not deleted")
+				}
+
+				if _, ok := s.Links()[1]; ok {
+					t.Error("link was not removed with entitlement")
+				}
+
+				undo := s.UndoLog()
+				if len(undo) != 1 || undo[0].DiscordId != 1 || undo[0].Entitlement.Id != existing.Id {
+					t.Errorf("got undo log %+v, want entitlement %s of Discord ID 1", undo, existing.Id)
+				}
+			},
+		},
+		{
+			name: "recreates reappearing entitlement with its previous ID",
+			config: func(cfg *config.Config) {
+				cfg.StableIds.Enabled = true
+			},
+			seed: func(s *store.Memory) {
+				ctx := context.Background()
+				tx, _ := s.BeginTx(ctx)
+				_ = s.RecordEntitlementIds(ctx, tx, []store.Link{{DiscordId: 1, EntitlementId: existing.Id}})
+				_ = tx.Commit(ctx)
+			},
+			plan: plan{Creations: []plannedCreation{testCreation(1, testSku, &expiresAt)}},
+			check: func(t *testing.T, s *store.Memory) {
+				if id := s.Links()[1]; id != existing.Id {
+					t.Errorf("linked to %s, want previous ID %s", id, existing.Id)
+				}
+			},
+		},
+		{
+			name: "applies each SKU in its own partition",
+			config: func(cfg *config.Config) {
+				cfg.ReconcileConcurrency = 2
+			},
+			seed: func(s *store.Memory) {
+				s.AddSku(testDiscordSkuId+1, secondSku)
+			},
+			plan: plan{Creations: []plannedCreation{testCreation(1, testSku, nil), testCreation(2, secondSku, nil)}},
+			check: func(t *testing.T, s *store.Memory) {
+				if links := s.Links(); len(links) != 2 {
+					t.Errorf("got %d links, want one for each SKU", len(links))
+				}
+			},
+		},
+		{
+			name: "rolls back partition that fails",
+			seed: func(s *store.Memory) {
+				s.AddEntitlement(2, stale)
+			},
+			plan: plan{
+				Creations: []plannedCreation{testCreation(1, otherSku, nil)},
+				Deletions: []plannedDeletion{{DiscordId: 2, EntitlementId: stale.Id, SkuId: otherSku.Id}},
+			},
+			wantErr: true,
+			check: func(t *testing.T, s *store.Memory) {
+				if _, ok := s.Entitlements()[stale.Id]; !ok {
+					t.Error("deletion in failed partition was not rolled back")
+				}
+			},
+		},
+		{
+			name: "dead-letters creation that violates constraint",
+			config: func(cfg *config.Config) {
+				cfg.DeadLetter.Enabled = true
+			},
+			plan: plan{Creations: []plannedCreation{testCreation(1, otherSku, nil), testCreation(2, testSku, nil)}},
+			check: func(t *testing.T, s *store.Memory) {
+				letter, ok := s.DeadLetters()[1]
+				if !ok {
+					t.Fatal("creation was not dead-lettered")
+				}
+
+				if letter.SkuId != otherSku.Id || !strings.Contains(letter.Cause, "foreign key") {
+					t.Errorf("got dead letter %+v, want SKU %s and foreign key violation", letter, otherSku.Id)
+				}
+
+				links := s.Links()
+				if _, ok := links[1]; ok {
+					t.Error("dead-lettered entitlement was linked")
+				}
+
+				if _, ok := links[2]; !ok {
+					t.Error("entitlement alongside dead letter was not created")
+				}
+			},
+		},
+		{
+			name: "clears dead letter once entitlement is written",
+			config: func(cfg *config.Config) {
+				cfg.DeadLetter.Enabled = true
+			},
+			seed: func(s *store.Memory) {
+				ctx := context.Background()
+				tx, _ := s.BeginTx(ctx)
+				_ = s.InsertDeadLetter(ctx, tx, store.DeadLetter{DiscordId: 1, SkuId: testSku.Id, Cause: "previous failure"})
+				_ = tx.Commit(ctx)
+			},
+			plan: plan{Creations: []plannedCreation{testCreation(1, testSku, nil)}},
+			check: func(t *testing.T, s *store.Memory) {
+				if letters := s.DeadLetters(); len(letters) != 0 {
+					t.Errorf("got dead letters %+v, want none", letters)
+				}
+			},
+		},
+		{
+			name:    "fails run on constraint violation without dead letters",
+			plan:    plan{Creations: []plannedCreation{testCreation(1, otherSku, nil)}},
+			wantErr: true,
+			check: func(t *testing.T, s *store.Memory) {
+				if letters := s.DeadLetters(); len(letters) != 0 {
+					t.Errorf("got dead letters %+v, want none", letters)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config
+			if tt.config != nil {
+				tt.config(&cfg)
+			}
+
+			s := newTestStore()
+			if tt.seed != nil {
+				tt.seed(s)
+			}
+
+			err := applyTestPlan(newTestDaemon(cfg, s), tt.plan)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyPlan returned %v, want error %t", err, tt.wantErr)
+			}
+
+			tt.check(t, s)
+		})
+	}
+}
+
+// batchRecordingStore records the batches that missing entitlements are deleted in
+type batchRecordingStore struct {
+	*store.Memory
+	batches []int
+}
+
+func (s *batchRecordingStore) DeleteEntitlements(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (int64, error) {
+	s.batches = append(s.batches, len(ids))
+	return s.Memory.DeleteEntitlements(ctx, tx, ids)
+}
+
+func TestMissingDeletionBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		missing     int
+		rateLimit   float64
+		burst       int
+		wantBatches []int
+	}{
+		{
+			name:        "unthrottled deletes in one statement",
+			missing:     5,
+			wantBatches: []int{5},
+		},
+		{
+			name:        "throttled deletes in batches of burst",
+			missing:     5,
+			rateLimit:   1000,
+			burst:       2,
+			wantBatches: []int{2, 2, 1},
+		},
+		{
+			name:        "nothing missing",
+			wantBatches: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config
+			cfg.WriteRateLimit = tt.rateLimit
+			cfg.WriteRateBurst = tt.burst
+
+			s := &batchRecordingStore{Memory: newTestStore()}
+
+			var p plan
+			for i := range tt.missing {
+				entitlement := testEntitlement(uint64(testGuildId+i), nil)
+				s.AddEntitlement(uint64(i), entitlement)
+				p.MissingDeletions = append(p.MissingDeletions, plannedDeletion{DiscordId: uint64(i), EntitlementId: entitlement.Id})
+			}
+
+			if err := applyTestPlan(newTestDaemon(cfg, s), p); err != nil {
+				t.Fatalf("applyPlan failed: %v", err)
+			}
+
+			if !slices.Equal(s.batches, tt.wantBatches) {
+				t.Errorf("deleted in batches %v, want %v", s.batches, tt.wantBatches)
+			}
+
+			if remaining := len(s.Entitlements()); remaining != 0 {
+				t.Errorf("%d missing entitlements were not deleted", remaining)
+			}
+		})
+	}
+}
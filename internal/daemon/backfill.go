@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/backfill"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"go.uber.org/zap"
+)
+
+// readBackfill reads the entitlements from BACKFILL_FILE in place of listing them from Discord. Entitlements of other
+// applications, and those that have already ended, are dropped, matching what the API would list.
+func (d *Daemon) readBackfill() ([]entitlement.Entitlement, error) {
+	entitlements, err := backfill.ReadFile(d.config.BackfillFile)
+	if err != nil {
+		return nil, err
+	}
+
+	read := len(entitlements)
+	now := time.Now()
+	filtered := entitlements[:0]
+	for _, e := range entitlements {
+		if e.ApplicationId != 0 && e.ApplicationId != d.config.Discord.ApplicationId {
+			continue
+		}
+
+		if e.EndsAt != nil && e.EndsAt.Before(now) {
+			continue
+		}
+
+		filtered = append(filtered, e)
+	}
+
+	d.fetchLogger.Info(
+		"Read entitlements from backfill file",
+		zap.String("path", d.config.BackfillFile),
+		zap.Int("read", read),
+		zap.Int("active", len(filtered)),
+	)
+
+	return filtered, nil
+}
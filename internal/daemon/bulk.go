@@ -0,0 +1,20 @@
+package daemon
+
+import (
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/google/uuid"
+)
+
+// link maps a Discord entitlement ID to the ID of the entitlement in the entitlements table
+type link = store.Link
+
+// uuidArray converts ids into a form that can be encoded as a uuid[] parameter. pgtype treats uuid.UUID as a
+// nested array when encoding a slice of them, so the raw bytes must be passed instead.
+func uuidArray(ids []uuid.UUID) [][16]byte {
+	raw := make([][16]byte, len(ids))
+	for i, id := range ids {
+		raw[i] = id
+	}
+
+	return raw
+}
@@ -0,0 +1,44 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/commands"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+func newCommandSubscriber(config config.Config) (*commands.Subscriber, error) {
+	if len(config.Redis.Url) == 0 {
+		return nil, nil
+	}
+
+	return commands.NewSubscriber(config.Redis.Url, config.Redis.CommandChannel)
+}
+
+// listenCommands handles commands published by other services on the Redis command channel until ctx is cancelled
+func (d *Daemon) listenCommands(ctx context.Context) {
+	d.logger.Info("Listening for commands", zap.String("channel", d.commands.Channel()))
+
+	err := d.commands.Run(ctx, d.handleCommand, func(payload string, err error) {
+		d.logger.Warn("Received invalid command", zap.String("payload", payload), zap.Error(err))
+	})
+	if err != nil && ctx.Err() == nil {
+		d.logger.Error("Stopped listening for commands", zap.Error(err))
+	}
+}
+
+func (d *Daemon) handleCommand(command commands.Command) {
+	switch command.Type {
+	case commands.CommandTypeSync:
+		if command.GuildId == 0 {
+			d.logger.Info("Sync requested, triggering run")
+			d.Trigger()
+		} else {
+			d.logger.Info("Guild sync requested", zap.Uint64("guild_id", command.GuildId))
+			d.requestScopedSync(runScope{GuildId: command.GuildId})
+		}
+	default:
+		d.logger.Warn("Received unknown command", zap.String("type", string(command.Type)))
+	}
+}
@@ -0,0 +1,202 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/postgres"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// databases are the connections that a daemon reads from and writes to, which are switched together on cutover
+type databases struct {
+	pool        *pgxpool.Pool
+	store       store.EntitlementStore
+	shadowPool  *pgxpool.Pool
+	shadowStore store.EntitlementStore
+	// replicaPool and replicaStore are the read replica, if REPLICA_DATABASE_URI is set
+	replicaPool  *pgxpool.Pool
+	replicaStore store.EntitlementStore
+}
+
+// db returns the databases that the daemon is currently connected to. Runs hold runMu, so see the same databases
+// throughout, but anything else should call db once and use the result, as a cutover may switch them in between.
+func (d *Daemon) db() *databases {
+	return d.dbs.Load()
+}
+
+// setDatabases switches the daemon to dbs, invalidating everything that was cached from the previous database
+func (d *Daemon) setDatabases(dbs *databases) {
+	d.dbs.Store(dbs)
+
+	d.skuCache.invalidate()
+	d.skuMetadata.invalidate()
+	d.snapshot.invalidate()
+}
+
+// close closes every pool in dbs
+func (dbs *databases) close() {
+	for _, pool := range []*pgxpool.Pool{dbs.pool, dbs.shadowPool, dbs.replicaPool} {
+		if pool != nil {
+			pool.Close()
+		}
+	}
+}
+
+// AttachApplications attaches the daemons of the additional applications that share this daemon's databases, so
+// that they are switched over with it on cutover. The databases are only closed once all of them have switched.
+// The applications also share this daemon's RECONCILE_CONCURRENCY workers and WRITE_RATE_LIMIT, so that neither the
+// number of SKUs reconciled at once nor the rate of writes grows with the number of applications.
+func (d *Daemon) AttachApplications(apps []*Daemon) {
+	d.applications = apps
+	for _, app := range apps {
+		app.writeLimiter = d.writeLimiter
+	}
+
+	d.sizeWorkers()
+}
+
+// Application returns the daemon that syncs the application with the given ID, which is either this daemon or one of
+// its attached applications. An ID of 0 selects this daemon.
+func (d *Daemon) Application(id uint64) (*Daemon, bool) {
+	if id == 0 || id == d.config.Discord.ApplicationId {
+		return d, true
+	}
+
+	for _, app := range d.applications {
+		if app.config.Discord.ApplicationId == id {
+			return app, true
+		}
+	}
+
+	return nil, false
+}
+
+// Cutover switches the database that entitlements are synchronised into, for this daemon and any attached
+// applications. Any in-flight runs are drained first, and no further runs start until the cutover has finished. A
+// final sync is performed against the current database, and then against the new database before switching to it,
+// so that no entitlements are dropped or duplicated during the transition. If any sync against the new database
+// fails, every daemon stays on the current database.
+//
+// The read replica is switched to replicaDatabaseUri, or disabled if it is empty, as the current replica follows the
+// current database. Shadow comparison is disabled, as the shadow database is typically the one being cut over to.
+func (d *Daemon) Cutover(ctx context.Context, databaseUri, replicaDatabaseUri string) error {
+	daemons := append([]*Daemon{d}, d.applications...)
+
+	d.logger.Info("Starting database cutover, draining runs", zap.Int("applications", len(daemons)))
+	for _, daemon := range daemons {
+		daemon.runMu.Lock()
+		defer daemon.runMu.Unlock()
+	}
+
+	d.logger.Info("Runs drained, performing final sync against current database")
+	for _, daemon := range daemons {
+		if err := daemon.finalSync(ctx); err != nil {
+			return fmt.Errorf("final sync of application %d against current database failed: %w", daemon.config.Discord.ApplicationId, err)
+		}
+	}
+
+	next, err := d.connectDatabases(databaseUri, replicaDatabaseUri)
+	if err != nil {
+		return err
+	}
+
+	current := d.switchDatabases(daemons, next)
+	rollback := func() {
+		d.restoreDatabases(daemons, current)
+		next.close()
+	}
+
+	if err := d.EnsureSchema(ctx); err != nil {
+		rollback()
+		return fmt.Errorf("failed to create tables in new database, staying on current database: %w", err)
+	}
+
+	d.logger.Info("New database connected, performing final sync against new database")
+	for _, daemon := range daemons {
+		if err := daemon.finalSync(ctx); err != nil {
+			rollback()
+			return fmt.Errorf("final sync of application %d against new database failed, staying on current database: %w", daemon.config.Discord.ApplicationId, err)
+		}
+	}
+
+	// The attached applications share this daemon's databases, so they are closed once every daemon has switched
+	current[0].close()
+	for _, daemon := range daemons {
+		daemon.resetSkuListener()
+	}
+
+	d.logger.Info("Database cutover complete, resuming runs", zap.Bool("replica", next.replicaPool != nil))
+	return nil
+}
+
+// switchDatabases switches each of daemons to next, returning the databases that each was connected to
+func (d *Daemon) switchDatabases(daemons []*Daemon, next *databases) []*databases {
+	current := make([]*databases, len(daemons))
+	for i, daemon := range daemons {
+		current[i] = daemon.db()
+		daemon.setDatabases(next)
+	}
+
+	d.sizeWorkers()
+	return current
+}
+
+// restoreDatabases switches each of daemons back to the databases returned for it by switchDatabases
+func (d *Daemon) restoreDatabases(daemons []*Daemon, current []*databases) {
+	for i, daemon := range daemons {
+		daemon.setDatabases(current[i])
+	}
+
+	d.sizeWorkers()
+}
+
+// connectDatabases connects to the database being cut over to, and its read replica if replicaDatabaseUri is set
+func (d *Daemon) connectDatabases(databaseUri, replicaDatabaseUri string) (*databases, error) {
+	d.logger.Info("Connecting to new database...")
+	pool, err := postgres.Connect(d.config, databaseUri, d.dbLogger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to new database: %w", err)
+	}
+
+	dbs := &databases{
+		pool:  pool,
+		store: store.New(d.config.StoreBackend, pool),
+	}
+
+	if len(replicaDatabaseUri) > 0 {
+		d.logger.Info("Connecting to new read replica...")
+		replicaPool, err := postgres.ConnectReplica(d.config, replicaDatabaseUri, d.dbLogger)
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("failed to connect to new read replica: %w", err)
+		}
+
+		dbs.replicaPool, dbs.replicaStore = replicaPool, store.New(d.config.StoreBackend, replicaPool)
+	}
+
+	return dbs, nil
+}
+
+// finalSync performs one of the runs of a cutover, holding the advisory lock and run lease if enabled so that it
+// does not overlap a run of another instance. A cutover cannot go ahead without its final sync, so another instance
+// holding the lock or lease fails it rather than skipping the run.
+func (d *Daemon) finalSync(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, d.config.ExecutionTimeout)
+	defer cancel()
+
+	ran, err := d.tryRunWithLease(ctx)
+	if err != nil {
+		d.logger.Error("Failed to run", zap.Error(err))
+		return err
+	}
+
+	if !ran {
+		return errors.New("another instance is running, try again once it has finished")
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/sync/semaphore"
+)
+
+// newLazyPool creates a pool that never connects unless it is used, for tests that only need its configuration
+func newLazyPool(t *testing.T, maxConns int) *pgxpool.Pool {
+	t.Helper()
+
+	poolConfig, err := pgxpool.ParseConfig(fmt.Sprintf("postgres://localhost/entitlements?pool_max_conns=%d", maxConns))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poolConfig.LazyConnect = true
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// workerCount returns the number of workers that can be acquired from workers at once
+func workerCount(workers *semaphore.Weighted) int {
+	count := 0
+	for workers.TryAcquire(1) {
+		count++
+	}
+
+	workers.Release(int64(count))
+	return count
+}
+
+func TestSwitchDatabases(t *testing.T) {
+	tests := []struct {
+		name            string
+		concurrency     int
+		currentMaxConns int
+		nextMaxConns    int
+		// wantWorkers is the number of workers once switched, which is restored to wantRestoredWorkers
+		wantWorkers         int
+		wantRestoredWorkers int
+	}{
+		{
+			name:                "keeps RECONCILE_CONCURRENCY when both pools are large enough",
+			concurrency:         4,
+			currentMaxConns:     10,
+			nextMaxConns:        10,
+			wantWorkers:         4,
+			wantRestoredWorkers: 4,
+		},
+		{
+			name:                "lowers workers for smaller new pool",
+			concurrency:         4,
+			currentMaxConns:     10,
+			nextMaxConns:        4,
+			wantWorkers:         2,
+			wantRestoredWorkers: 4,
+		},
+		{
+			name:                "keeps one worker when new pool is exhausted by runs",
+			concurrency:         4,
+			currentMaxConns:     10,
+			nextMaxConns:        2,
+			wantWorkers:         1,
+			wantRestoredWorkers: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config
+			cfg.ReconcileConcurrency = tt.concurrency
+			cfg.Discord.ApplicationId = 1
+			cfg.Discord.Applications = []config.Application{{Id: 2, Token: "token"}}
+
+			current := &databases{pool: newLazyPool(t, tt.currentMaxConns), store: store.NewMemory()}
+			appCurrent := &databases{pool: current.pool, store: store.NewMemory()}
+			next := &databases{pool: newLazyPool(t, tt.nextMaxConns), store: store.NewMemory()}
+
+			d := newTestDaemon(cfg, current.store)
+			d.dbs.Store(current)
+			app := newTestDaemon(cfg.ForApplication(cfg.Discord.Applications[0]), appCurrent.store)
+			app.dbs.Store(appCurrent)
+			d.AttachApplications([]*Daemon{app})
+
+			d.skuCache.reset()
+			d.skuCache.skus[1] = model.Sku{Label: "cached"}
+
+			daemons := []*Daemon{d, app}
+			previous := d.switchDatabases(daemons, next)
+
+			for _, daemon := range daemons {
+				if daemon.db() != next {
+					t.Errorf("application %d was not switched", daemon.config.Discord.ApplicationId)
+				}
+			}
+
+			if len(d.skuCache.skus) != 0 {
+				t.Error("SKU cache was not invalidated")
+			}
+
+			if app.workers != d.workers {
+				t.Error("workers are not shared with the application")
+			}
+
+			if workers := workerCount(d.workers); workers != tt.wantWorkers {
+				t.Errorf("got %d workers once switched, want %d", workers, tt.wantWorkers)
+			}
+
+			d.restoreDatabases(daemons, previous)
+
+			if d.db() != current || app.db() != appCurrent {
+				t.Error("applications were not restored to their own databases")
+			}
+
+			if workers := workerCount(d.workers); workers != tt.wantRestoredWorkers {
+				t.Errorf("got %d workers once restored, want %d", workers, tt.wantRestoredWorkers)
+			}
+		})
+	}
+}
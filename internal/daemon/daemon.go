@@ -2,58 +2,199 @@ package daemon
 
 import (
 	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/TicketsBot-cloud/common/collections"
-	"github.com/TicketsBot-cloud/common/model"
-	"github.com/TicketsBot-cloud/common/utils"
-	"github.com/TicketsBot-cloud/database"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/activation"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/commands"
 	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
-	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
-	"github.com/TicketsBot-cloud/gdl/rest"
-	"github.com/google/uuid"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/flags"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/logging"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/notify"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/queue"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/TicketsBot-cloud/gdl/gateway"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
 )
 
 type Daemon struct {
 	config config.Config
-	db     *database.Database
-	logger *zap.Logger
+	// dbs are the databases the daemon is connected to, which are replaced on cutover, see db
+	dbs         atomic.Pointer[databases]
+	logger      *zap.Logger
+	fetchLogger *zap.Logger
+	dbLogger    *zap.Logger
+	redactor    *logging.Redactor
+
+	// runMu is held for the duration of each run, and while the database is being switched over
+	runMu sync.Mutex
+	// applications are the daemons of the additional applications sharing this daemon's databases, see
+	// AttachApplications
+	applications []*Daemon
+	// workers limits the SKUs reconciled at once, and is shared with the attached applications, see sizeWorkers
+	workers *semaphore.Weighted
+	// applicationLabel is the application label of the metrics recorded by the daemon
+	applicationLabel string
+
+	// clientCredentials is set if DISCORD_CLIENT_SECRET is, in which case it is used instead of token
+	clientCredentials *clientCredentials
+
+	token       *tokenSource
+	history     runHistory
+	unknownSkus unknownSkuTracker
+	skuCache    skuCache
+	skuTargets  skuTargetCache
+	skuMetadata skuMetadata
+	stats       statsJob
+	snapshot    fetchSnapshot
+	// purgedUsers are the hashes of users whose data has been purged, guarded by runMu
+	purgedUsers map[string]struct{}
+	notifier    notify.Notifier
+	flags       *flags.Client
+	notifyWg    sync.WaitGroup
+	// deletionsPaused is initialised from DELETIONS_PAUSED, and can be changed with SetDeletionsPaused
+	deletionsPaused atomic.Bool
+
+	activationHook *activation.Hook
+	expiryHook     *activation.Hook
+	guildHook      *activation.Hook
+	writeLimiter   *rate.Limiter
+
+	// skuListenerReset makes the SKU listener reconnect, see resetSkuListener
+	skuListenerReset chan struct{}
+	commands         *commands.Subscriber
+	queue            *queue.Consumer
+	// runs holds the runs waiting to start in daemon mode
+	runs *runQueue
+
+	// shards are the gateway shards if GATEWAY_ENABLED is set, which are replaced when the bot token changes
+	shardsMu sync.Mutex
+	shards   *gateway.ShardManager
+
+	startedAt time.Time
+	// intervalStretched is true if the interval between scheduled runs was last stretched, see runInterval
+	intervalStretched bool
 }
 
-func NewDaemon(config config.Config, db *database.Database, logger *zap.Logger) *Daemon {
-	return &Daemon{
+// NewDaemon creates a new Daemon. shadowPool is optional, and when provided, the reconciliation is also performed
+// read-only against it after each run to report any divergence from the primary database. replicaPool is also
+// optional, and when provided, is used for reads that do not need to see the primary's latest writes.
+func NewDaemon(config config.Config, pool, shadowPool, replicaPool *pgxpool.Pool, loggers *logging.Loggers) *Daemon {
+	var shadowStore store.EntitlementStore
+	if shadowPool != nil {
+		shadowStore = store.New(config.StoreBackend, shadowPool)
+	}
+
+	var replicaStore store.EntitlementStore
+	if replicaPool != nil {
+		replicaStore = store.New(config.StoreBackend, replicaPool)
+	}
+
+	d := &Daemon{
 		config: config,
-		db:     db,
-		logger: logger,
+
+		logger:      loggers.Reconciler,
+		fetchLogger: loggers.Fetcher,
+		dbLogger:    loggers.Database,
+		redactor:    loggers.Redactor,
+		token:       newTokenSource(config.Discord.TokenFile, config.Discord.Token, loggers.Redactor),
+		notifier:    newNotifier(config),
+		flags:       newFlagsClient(config),
+
+		clientCredentials: newClientCredentials(config, loggers.Redactor),
+
+		activationHook: newActivationHook(config),
+		expiryHook:     newExpiryHook(config),
+		guildHook:      newGuildHook(config),
+		writeLimiter:   newWriteLimiter(config),
+
+		workers:          semaphore.NewWeighted(int64(max(config.ReconcileConcurrency, 1))),
+		applicationLabel: strconv.FormatUint(config.Discord.ApplicationId, 10),
+		skuListenerReset: make(chan struct{}, 1),
+		queue:            newQueueConsumer(config),
+		runs:             newRunQueue(),
+
+		startedAt: time.Now(),
+	}
+
+	subscriber, err := newCommandSubscriber(config)
+	if err != nil {
+		d.logger.Error("Invalid REDIS_URL, commands will not be received", zap.Error(err))
+	} else {
+		d.commands = subscriber
 	}
+
+	d.dbs.Store(&databases{
+		pool:         pool,
+		store:        store.New(config.StoreBackend, pool),
+		shadowPool:   shadowPool,
+		shadowStore:  shadowStore,
+		replicaPool:  replicaPool,
+		replicaStore: replicaStore,
+	})
+
+	d.deletionsPaused.Store(config.DeletionsPaused)
+	return d
 }
 
 func (d *Daemon) Start() error {
 	d.logger.Info("Starting daemon", zap.Duration("frequency", d.config.RunFrequency))
+	d.checkFrequency()
+	if d.config.Bootstrap {
+		d.logger.Warn("Bootstrap mode is enabled, entitlements will be created and linked but never deleted")
+	}
+
 	ctx := context.Background()
 
-	timer := time.NewTimer(d.config.RunFrequency)
+	go d.processRuns(ctx)
+	go d.listenSignals(ctx)
+
+	if d.config.SkuListener.Enabled {
+		go d.listenSkuChanges(ctx)
+	}
+
+	if d.commands != nil {
+		go d.listenCommands(ctx)
+	}
+
+	if d.queue != nil {
+		go d.consumeQueue(ctx)
+	}
+
+	if d.config.Gateway.Enabled {
+		d.listenGateway()
+	}
+
+	timer := time.NewTimer(d.runInterval())
 	defer timer.Stop()
 
 	for {
 		select {
 		case <-timer.C:
-			start := time.Now()
-			if err := d.doRun(ctx, d.config.ExecutionTimeout); err != nil {
-				d.logger.Error("Failed to run", zap.Error(err))
-			}
-
-			d.logger.Info("Run completed", zap.Duration("duration", time.Since(start)))
-
-			timer.Reset(d.config.RunFrequency)
 		case <-ctx.Done():
 			d.logger.Info("Shutting down daemon")
 			return nil
 		}
+
+		// Errors are logged by processRuns
+		_ = d.enqueueRun(ctx, true, runPriorityScheduled)
+
+		timer.Reset(d.runInterval())
 	}
 }
 
+// Trigger queues a full run in daemon mode, rather than waiting for RUN_FREQUENCY. If a full run is already waiting
+// to start, the trigger is coalesced into it.
+func (d *Daemon) Trigger() {
+	d.runs.submit(context.Background(), runScope{}, true, runPriorityTriggered)
+}
+
 func (d *Daemon) doRun(ctx context.Context, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -62,159 +203,52 @@ func (d *Daemon) doRun(ctx context.Context, timeout time.Duration) error {
 }
 
 func (d *Daemon) RunOnce(ctx context.Context) error {
-	d.logger.Debug("Running synchronisation")
-
-	start := time.Now()
-	defer func() {
-		duration := time.Now().Sub(start)
-		if duration > (d.config.ExecutionTimeout / 2.0) {
-			d.logger.Warn("Execution took more than 50% of the timeout", zap.Duration("duration", duration))
-		}
-	}()
-
-	activeEntitlements, err := d.fetchEntitlements(ctx)
-	if err != nil {
-		d.logger.Error("Failed to fetch entitlements", zap.Error(err))
-		return err
-	}
-
-	d.logger.Debug("Fetched entitlements", zap.Int("count", len(activeEntitlements)))
-
-	skuCache := make(map[uint64]model.Sku)
-	unknownSkus := collections.NewSet[uint64]()
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
 
-	tx, err := d.db.BeginTx(ctx)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
-		defer cancel()
-
-		tx.Rollback(ctx)
-	}()
-
-	for _, entitlement := range activeEntitlements {
-		if unknownSkus.Contains(entitlement.SkuId) {
-			d.logger.Debug("Skipping unknown SKU", zap.Uint64("sku_id", entitlement.SkuId))
-			continue
-		}
-
-		sku, ok := skuCache[entitlement.SkuId]
-		if !ok {
-			tmp, err := d.db.DiscordStoreSkus.GetSku(ctx, entitlement.SkuId)
-			if err != nil {
-				d.logger.Error("Failed to get SKU ID", zap.Uint64("sku_id", entitlement.SkuId), zap.Error(err))
-				return err
-			}
-
-			if tmp == nil {
-				unknownSkus.Add(entitlement.SkuId)
-				d.logger.Debug("Sku not found in discord_store_skus", zap.Uint64("discord_id", entitlement.SkuId))
-				continue
-			}
-
-			sku = *tmp
-			skuCache[entitlement.SkuId] = sku
-		}
-
-		if entitlement.Deleted {
-			entitlementId, err := d.db.DiscordEntitlements.GetEntitlementId(ctx, tx, entitlement.Id)
-			if err != nil {
-				d.logger.Error("Failed to get entitlement ID", zap.Uint64("discord_id", entitlement.Id), zap.Error(err))
-				return err
-			}
-
-			if entitlementId != nil {
-				d.logger.Info("Found deleted entitlement", zap.Uint64("discord_id", entitlement.Id), zap.String("entitlement_id", entitlementId.String()))
-
-				if err := d.db.Entitlements.DeleteById(ctx, tx, *entitlementId); err != nil {
-					d.logger.Error("Failed to delete entitlement", zap.Error(err))
-					return err
-				}
-			}
+	return d.runWithLease(ctx)
+}
 
-			continue
-		}
+// runWithLease performs a run, taking the advisory lock and run lease first if enabled. runMu must be held.
+func (d *Daemon) runWithLease(ctx context.Context) error {
+	_, err := d.tryRunWithLease(ctx)
+	return err
+}
 
-		created, err := d.db.Entitlements.Create(ctx, tx, entitlement.GuildId, entitlement.UserId, sku.Id, model.EntitlementSourceDiscord, entitlement.EndsAt)
+// tryRunWithLease performs a run as runWithLease does, returning false if it was skipped because another instance
+// holds the advisory lock or run lease. runMu must be held.
+func (d *Daemon) tryRunWithLease(ctx context.Context) (bool, error) {
+	if d.config.AdvisoryLock.Enabled {
+		release, ok, err := d.acquireAdvisoryLock(ctx)
 		if err != nil {
-			d.logger.Error("Failed to create entitlement", zap.Error(err))
-			return err
+			d.logger.Error("Failed to acquire advisory lock", zap.Error(err))
+			return false, err
 		}
 
-		// Link entitlement to discord ID
-		if err := d.db.DiscordEntitlements.Create(ctx, tx, entitlement.Id, created.Id); err != nil {
-			d.logger.Error("Failed to link entitlement", zap.Error(err))
-			return err
+		if !ok {
+			d.logger.Info("Another instance holds the advisory lock, skipping")
+			metrics.RunsSkipped.WithLabelValues(d.applicationLabel, "advisory_lock").Inc()
+			return false, nil
 		}
 
-		d.logger.Debug("Created entitlement", zap.Uint64("discord_id", entitlement.Id), zap.Any("entitlement", created))
-	}
-
-	// Delete missing entitlements (e.g. test entitlements)
-	allEntitlements, err := d.db.DiscordEntitlements.ListAll(ctx, tx)
-	if err != nil {
-		d.logger.Error("Failed to list all discord entitlements", zap.Error(err))
-		return err
-	}
-
-	activeEntitlementsSet := collections.NewSet[uint64]()
-	for _, entitlement := range activeEntitlements {
-		activeEntitlementsSet.Add(entitlement.Id)
+		defer release()
 	}
 
-	toDelete := make([]uuid.UUID, 0)
-	for discordId, entitlementId := range allEntitlements {
-		if !activeEntitlementsSet.Contains(discordId) {
-			toDelete = append(toDelete, entitlementId)
+	if d.config.RunLease.Enabled {
+		release, ok, err := d.acquireLease(ctx)
+		if err != nil {
+			d.logger.Error("Failed to acquire run lease", zap.Error(err))
+			return false, err
 		}
-	}
-
-	if len(toDelete) >= d.config.MaxRemovalsThreshold {
-		d.logger.Error("MAX_REMOVALS_THRESHOLD exceeded, not deleting entitlements", zap.Int("count", len(toDelete)), zap.Int("threshold", d.config.MaxRemovalsThreshold))
-	} else {
-		for _, entitlementId := range toDelete {
-			d.logger.Info("Deleting missing entitlement", zap.String("entitlement_id", entitlementId.String()))
 
-			if err := d.db.Entitlements.DeleteById(ctx, tx, entitlementId); err != nil {
-				d.logger.Error("Failed to delete entitlement", zap.Error(err))
-				return err
-			}
+		if !ok {
+			d.logger.Info("Another run is in progress, skipping")
+			metrics.RunsSkipped.WithLabelValues(d.applicationLabel, "run_lease").Inc()
+			return false, nil
 		}
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (d *Daemon) fetchEntitlements(ctx context.Context) ([]entitlement.Entitlement, error) {
-	return d.nextPage(ctx, 0, nil)
-}
-
-const pageLimit = 100
-
-func (d *Daemon) nextPage(ctx context.Context, afterId uint64, entitlements []entitlement.Entitlement) ([]entitlement.Entitlement, error) {
-	d.logger.Debug("Fetching page of entitlements", zap.Uint64("after", afterId), zap.Int("limit", pageLimit), zap.Int("total", len(entitlements)))
 
-	fetched, err := rest.ListEntitlements(ctx, d.config.Discord.Token, nil, d.config.Discord.ApplicationId, rest.EntitlementQueryOptions{
-		After:         utils.Ptr(afterId),
-		Limit:         utils.Ptr(pageLimit),
-		ExcludedEnded: utils.Ptr(true),
-	})
-	if err != nil {
-		return nil, err
+		defer release()
 	}
 
-	entitlements = append(entitlements, fetched...)
-
-	if len(fetched) < pageLimit {
-		return entitlements, nil
-	} else {
-		return d.nextPage(ctx, fetched[len(fetched)-1].Id, entitlements)
-	}
+	return true, d.runOnce(ctx)
 }
@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// isConstraintViolation returns whether err was caused by an integrity constraint violation, such as a unique or
+// foreign key violation, which will not succeed if retried
+func isConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && len(pgErr.Code) == 5 && pgErr.Code[:2] == "23"
+}
+
+// withSavepoint calls f in a savepoint of tx if DEAD_LETTER_ENABLED is set, so that a constraint violation can be
+// rolled back without aborting tx. If f fails with a constraint violation, it is rolled back and returned as
+// violation, to be recorded with deadLetter. Any other error is returned as err, and leaves tx aborted.
+func (d *Daemon) withSavepoint(ctx context.Context, tx pgx.Tx, f func(tx pgx.Tx) error) (violation error, err error) {
+	if !d.config.DeadLetter.Enabled {
+		return nil, f(tx)
+	}
+
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f(savepoint); err != nil {
+		if !isConstraintViolation(err) {
+			return nil, err
+		}
+
+		if err := savepoint.Rollback(ctx); err != nil {
+			return nil, err
+		}
+
+		return err, nil
+	}
+
+	return nil, savepoint.Commit(ctx)
+}
+
+// deadLetter records a creation that failed with a constraint violation in the entitlement_dead_letters table, so
+// that it can be investigated without failing the rest of the run
+func (d *Daemon) deadLetter(ctx context.Context, tx pgx.Tx, creation plannedCreation, cause error) error {
+	metrics.DeadLetters.WithLabelValues(d.applicationLabel).Inc()
+
+	return d.db().store.InsertDeadLetter(ctx, tx, store.DeadLetter{
+		DiscordId: creation.Entitlement.Id,
+		SkuId:     creation.Sku.Id,
+		GuildId:   creation.GuildId,
+		UserId:    creation.UserId,
+		Cause:     cause.Error(),
+	})
+}
+
+// errNoOwner is recorded as the cause of dead letters for entitlements with neither a guild nor a user
+var errNoOwner = errors.New("entitlement has neither a guild nor a user")
+
+// deadLettersEnabled returns true if the entitlement_dead_letters table is in use
+func (d *Daemon) deadLettersEnabled() bool {
+	return d.config.DeadLetter.Enabled || d.config.OwnerlessEntitlementPolicy == config.OwnerlessPolicyDeadLetter
+}
+
+// deadLetterOwnerless records the entitlements with neither a guild nor a user in the entitlement_dead_letters
+// table, if OWNERLESS_ENTITLEMENT_POLICY is dead_letter
+func (d *Daemon) deadLetterOwnerless(ctx context.Context, tx pgx.Tx, p plan) error {
+	if d.config.OwnerlessEntitlementPolicy != config.OwnerlessPolicyDeadLetter {
+		return nil
+	}
+
+	for _, creation := range p.Ownerless {
+		if err := d.deadLetter(ctx, tx, creation, errNoOwner); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clearDeadLetters removes the dead letters for the Discord entitlements that have since been written successfully
+func (d *Daemon) clearDeadLetters(ctx context.Context, tx pgx.Tx, links []link) error {
+	if !d.deadLettersEnabled() || len(links) == 0 {
+		return nil
+	}
+
+	discordIds := make([]uint64, len(links))
+	for i, link := range links {
+		discordIds[i] = link.DiscordId
+	}
+
+	if err := d.db().store.ClearDeadLetters(ctx, tx, discordIds); err != nil {
+		d.logger.Error("Failed to clear dead letters", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
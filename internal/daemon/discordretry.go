@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+	"go.uber.org/zap"
+)
+
+// retryDiscord calls f until it succeeds, returns an error that is not retryable, or DISCORD_RETRY_ATTEMPTS attempts
+// have been made. Attempts are separated by an exponential backoff with full jitter, as for database retries.
+func (d *Daemon) retryDiscord(ctx context.Context, f func() error) error {
+	attempts := max(d.config.Discord.Retry.Attempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || attempt >= attempts || !isRetryableDiscordError(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := backoff(attempt, d.config.Discord.Retry.BaseDelay, d.config.Discord.Retry.MaxDelay)
+		d.fetchLogger.Warn(
+			"Discord request failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", attempts),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		metrics.DiscordRetries.WithLabelValues(d.applicationLabel, discordStatus(err)).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// isRetryableDiscordError returns true if err may not recur if the request is made again: a server error, a rate
+// limit, or a failure to get a response at all. Other client errors, such as an invalid token (401) or missing
+// access (403), are permanent.
+func isRetryableDiscordError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var restErr request.RestError
+	if !errors.As(err, &restErr) {
+		return true
+	}
+
+	return restErr.IsServerError() || restErr.StatusCode == http.StatusTooManyRequests
+}
+
+// isDiscordAuthError returns true if Discord rejected the token, or the token lacks access to the application
+func isDiscordAuthError(err error) bool {
+	var restErr request.RestError
+	return errors.As(err, &restErr) && (restErr.StatusCode == http.StatusUnauthorized || restErr.StatusCode == http.StatusForbidden)
+}
+
+// discordStatus returns the HTTP status of a failed Discord request for use as a metric label, or "error" if no
+// response was received
+func discordStatus(err error) string {
+	var restErr request.RestError
+	if errors.As(err, &restErr) {
+		return strconv.Itoa(restErr.StatusCode)
+	}
+
+	return "error"
+}
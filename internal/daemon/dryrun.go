@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/planfile"
+	"go.uber.org/zap"
+)
+
+// dryRunReport is the diff that a dry run would have applied, see DRY_RUN_REPORT_FILE
+type dryRunReport struct {
+	RunId     string    `json:"run_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Creations are entitlements that are not stored yet
+	Creations []planfile.Creation `json:"creations"`
+	// Refreshes are entitlements that are already stored, which would be upserted to refresh their expiry
+	Refreshes        []planfile.Creation `json:"refreshes"`
+	Deletions        []planfile.Deletion `json:"deletions"`
+	MissingDeletions []planfile.Deletion `json:"missing_deletions"`
+	// Withheld is the number of deletions that would not be applied by this run, by reason
+	Withheld map[string]int `json:"withheld"`
+}
+
+// reportDryRun logs each change that the plan would make, and writes them to DRY_RUN_REPORT_FILE if set
+func (d *Daemon) reportDryRun(ctx context.Context, p plan) {
+	changes := p.fileChanges()
+
+	runId, _ := RunIdFromContext(ctx)
+	report := dryRunReport{
+		RunId:            runId.String(),
+		CreatedAt:        time.Now().UTC(),
+		Creations:        make([]planfile.Creation, 0),
+		Refreshes:        make([]planfile.Creation, 0),
+		Deletions:        changes.Deletions,
+		MissingDeletions: changes.MissingDeletions,
+		Withheld: map[string]int{
+			"blocked":     p.BlockedDeletions,
+			"deferred":    p.DeferredDeletions,
+			"pending":     len(p.Pending),
+			"ignored":     p.IgnoredDeletions,
+			"paused":      p.PausedDeletions,
+			"quarantined": len(p.Quarantined),
+		},
+	}
+
+	for _, creation := range changes.Creations {
+		if creation.EntitlementId == nil {
+			report.Creations = append(report.Creations, creation)
+		} else {
+			report.Refreshes = append(report.Refreshes, creation)
+		}
+	}
+
+	for _, creation := range p.Creations {
+		if !creation.Linked {
+			d.logger.Info("Dry run: would create entitlement", append(d.entitlementFields(creation.Entitlement), zap.String("internal_sku_id", creation.Sku.Id.String()))...)
+		}
+	}
+
+	for _, deletion := range p.Deletions {
+		d.logger.Info("Dry run: would delete entitlement", append(d.deletionFields(deletion), zap.String("entitlement_id", deletion.EntitlementId.String()))...)
+	}
+
+	for _, deletion := range p.MissingDeletions {
+		d.logger.Info("Dry run: would delete missing entitlement", append(d.deletionFields(deletion), zap.String("entitlement_id", deletion.EntitlementId.String()))...)
+	}
+
+	path := d.config.DryRunReportFile
+	if len(path) == 0 {
+		return
+	}
+
+	if path == "-" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			d.logger.Warn("Failed to write dry run report", zap.Error(err))
+		}
+
+		return
+	}
+
+	if err := writeFileAtomic(path, report); err != nil {
+		d.logger.Warn("Failed to write dry run report", zap.String("path", path), zap.Error(err))
+	}
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errorReport describes a failed one-shot run, see ERROR_REPORT_FILE
+type errorReport struct {
+	RunId      string    `json:"run_id,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error"`
+	ErrorClass string    `json:"error_class"`
+	Retryable  bool      `json:"retryable"`
+	// Phase is empty if the run failed before fetching, e.g. while acquiring the run lease
+	Phase string `json:"phase,omitempty"`
+	// ChangesMayBeApplied is true if the run failed while writing, after the changes for some SKUs may have been
+	// committed
+	ChangesMayBeApplied bool `json:"changes_may_be_applied"`
+
+	Fetched          int            `json:"fetched"`
+	PlannedCreations int            `json:"planned_creations"`
+	PlannedRefreshes int            `json:"planned_refreshes"`
+	PlannedDeletions int            `json:"planned_deletions"`
+	Skipped          map[string]int `json:"skipped,omitempty"`
+}
+
+// retryable reports whether a run that failed with an error of this class may succeed if retried unchanged
+func (c ErrorClass) retryable() bool {
+	switch c {
+	case ErrorClassDiscordUnavailable, ErrorClassTimeout, ErrorClassDbConflict, ErrorClassPagination, ErrorClassCountMismatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// WriteErrorReport writes a report of the one-shot run that failed with err to ERROR_REPORT_FILE, or to stderr if it
+// is "-"
+func (d *Daemon) WriteErrorReport(err error) {
+	path := d.config.ErrorReportFile
+	if len(path) == 0 {
+		return
+	}
+
+	report := errorReport{
+		Error:      d.redactor.Redact(err.Error()),
+		ErrorClass: string(Classify(err)),
+		Retryable:  Classify(err).retryable(),
+	}
+
+	// The run is only recorded if it started, and not if e.g. the run lease could not be acquired
+	if summary, ok := d.history.latest(); ok && summary.Error == err.Error() {
+		report.RunId = summary.RunId.String()
+		report.StartedAt = summary.StartedAt
+		report.DurationMs = summary.Duration.Milliseconds()
+		report.Phase = summary.Phase
+		report.ChangesMayBeApplied = summary.Phase == phaseReconcile || summary.Phase == phaseCommit
+		report.Fetched = summary.Fetched
+		report.PlannedCreations = summary.Creations
+		report.PlannedRefreshes = summary.Refreshes
+		report.PlannedDeletions = summary.Deletions + summary.MissingDeletions
+
+		if len(summary.Skipped) > 0 {
+			report.Skipped = make(map[string]int, len(summary.Skipped))
+			for reason, count := range summary.Skipped {
+				report.Skipped[string(reason)] = count
+			}
+		}
+	}
+
+	if path == "-" {
+		if err := json.NewEncoder(os.Stderr).Encode(report); err != nil {
+			d.logger.Warn("Failed to write error report", zap.Error(err))
+		}
+
+		return
+	}
+
+	if err := writeFileAtomic(path, report); err != nil {
+		d.logger.Warn("Failed to write error report", zap.String("path", path), zap.Error(err))
+	}
+}
@@ -0,0 +1,212 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/jackc/pgconn"
+)
+
+type ErrorClass string
+
+const (
+	ErrorClassDiscordUnavailable ErrorClass = "discord_unavailable"
+	ErrorClassDiscordAuth        ErrorClass = "discord_auth"
+	ErrorClassUnknownSku         ErrorClass = "unknown_sku"
+	ErrorClassThresholdExceeded  ErrorClass = "threshold_exceeded"
+	ErrorClassDbConflict         ErrorClass = "db_conflict"
+	ErrorClassTimeout            ErrorClass = "timeout"
+	ErrorClassMalformed          ErrorClass = "malformed_entitlement"
+	ErrorClassAnomaly            ErrorClass = "anomaly"
+	ErrorClassPlanDrift          ErrorClass = "plan_drift"
+	ErrorClassPagination         ErrorClass = "pagination_inconsistent"
+	ErrorClassCountMismatch      ErrorClass = "count_mismatch"
+	ErrorClassOther              ErrorClass = "other"
+)
+
+// DiscordUnavailableError is returned when entitlements could not be fetched from Discord
+type DiscordUnavailableError struct {
+	Err error
+}
+
+func (e *DiscordUnavailableError) Error() string {
+	return fmt.Sprintf("discord unavailable: %v", e.Err)
+}
+
+func (e *DiscordUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownSkuError is recorded when an entitlement references a SKU that is not mapped in discord_store_skus
+type UnknownSkuError struct {
+	SkuId uint64
+}
+
+func (e *UnknownSkuError) Error() string {
+	return fmt.Sprintf("unknown SKU %d", e.SkuId)
+}
+
+// ThresholdExceededError is recorded when a safety threshold prevents changes from being applied
+type ThresholdExceededError struct {
+	Threshold string
+	Count     int
+	Limit     int
+}
+
+func (e *ThresholdExceededError) Error() string {
+	return fmt.Sprintf("%s exceeded: %d >= %d", e.Threshold, e.Count, e.Limit)
+}
+
+// DbConflictError is returned when a write conflicts with a concurrent transaction or an existing row
+type DbConflictError struct {
+	Err error
+}
+
+func (e *DbConflictError) Error() string {
+	return fmt.Sprintf("database conflict: %v", e.Err)
+}
+
+func (e *DbConflictError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a run does not complete within EXECUTION_TIMEOUT
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out: %v", e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// MalformedEntitlementError is returned when Discord lists an entitlement that cannot be synced, and
+// OWNERLESS_ENTITLEMENT_POLICY is error
+type MalformedEntitlementError struct {
+	DiscordId uint64
+	Count     int
+}
+
+func (e *MalformedEntitlementError) Error() string {
+	return fmt.Sprintf("%d entitlements have neither a guild nor a user, including %d", e.Count, e.DiscordId)
+}
+
+// PaginationError is returned when the pages of entitlements listed by Discord are inconsistent, e.g. because
+// entitlements were created or removed while they were being paged through
+type PaginationError struct {
+	// Page is the number of the inconsistent page, starting from 1
+	Page int
+	// DiscordId is the ID that was repeated or out of order
+	DiscordId uint64
+	// After is the ID that the entitlement should have followed
+	After uint64
+}
+
+func (e *PaginationError) Error() string {
+	return fmt.Sprintf("inconsistent pagination: page %d listed entitlement %d after %d", e.Page, e.DiscordId, e.After)
+}
+
+// CountMismatchError is returned when a second listing of entitlements does not find as many as the first, see
+// COUNT_CHECK_ENABLED
+type CountMismatchError struct {
+	Listed    int
+	Recounted int
+}
+
+func (e *CountMismatchError) Error() string {
+	return fmt.Sprintf("entitlement count mismatch: listed %d, recounted %d", e.Listed, e.Recounted)
+}
+
+// DiscordAuthError is returned when Discord rejects the token (401), or the token lacks access to the application
+// (403). Unlike DiscordUnavailableError, it will not resolve itself if the run is retried.
+type DiscordAuthError struct {
+	Err error
+}
+
+func (e *DiscordAuthError) Error() string {
+	return fmt.Sprintf("discord rejected the token: %v", e.Err)
+}
+
+func (e *DiscordAuthError) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the class of err, for use as a metric label
+func Classify(err error) ErrorClass {
+	var (
+		discordUnavailableErr *DiscordUnavailableError
+		discordAuthErr        *DiscordAuthError
+		unknownSkuErr         *UnknownSkuError
+		thresholdExceededErr  *ThresholdExceededError
+		dbConflictErr         *DbConflictError
+		timeoutErr            *TimeoutError
+		malformedErr          *MalformedEntitlementError
+		anomalyErr            *AnomalyError
+		planDriftErr          *PlanDriftError
+		paginationErr         *PaginationError
+		countMismatchErr      *CountMismatchError
+	)
+
+	// Timeouts are checked first, as they can also surface as a failed Discord request or database query
+	switch {
+	case errors.As(err, &timeoutErr), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &paginationErr):
+		return ErrorClassPagination
+	case errors.As(err, &countMismatchErr):
+		return ErrorClassCountMismatch
+	case errors.As(err, &discordAuthErr):
+		return ErrorClassDiscordAuth
+	case errors.As(err, &discordUnavailableErr):
+		return ErrorClassDiscordUnavailable
+	case errors.As(err, &unknownSkuErr):
+		return ErrorClassUnknownSku
+	case errors.As(err, &thresholdExceededErr):
+		return ErrorClassThresholdExceeded
+	case errors.As(err, &dbConflictErr), isDbConflict(err):
+		return ErrorClassDbConflict
+	case errors.As(err, &malformedErr):
+		return ErrorClassMalformed
+	case errors.As(err, &anomalyErr):
+		return ErrorClassAnomaly
+	case errors.As(err, &planDriftErr):
+		return ErrorClassPlanDrift
+	default:
+		return ErrorClassOther
+	}
+}
+
+// wrapDbError wraps err in a DbConflictError if it was caused by a conflicting transaction or row
+func wrapDbError(err error) error {
+	if isDbConflict(err) {
+		return &DbConflictError{Err: err}
+	}
+
+	return err
+}
+
+func isDbConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	switch pgErr.Code {
+	case "40001", // serialization_failure
+		"40P01", // deadlock_detected
+		"23505", // unique_violation
+		"55P03": // lock_not_available
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *Daemon) recordError(err error) {
+	metrics.Errors.WithLabelValues(d.applicationLabel, string(Classify(err))).Inc()
+}
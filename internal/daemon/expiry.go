@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/activation"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/list_expiring_entitlements.sql
+	listExpiringEntitlementsQuery string
+
+	//go:embed sql/insert_expiry_notification.sql
+	insertExpiryNotificationQuery string
+)
+
+func newExpiryHook(config config.Config) *activation.Hook {
+	if len(config.ExpiryHook.Url) == 0 {
+		return nil
+	}
+
+	return activation.NewHook(config.ExpiryHook.Url, config.ExpiryHook.AuthToken, config.ExpiryHook.Timeout)
+}
+
+// notifyExpiring calls the expiry hook for each synced entitlement that expires within EXPIRY_HOOK_WINDOW, once per
+// expiry. An entitlement that is renewed has a new expiry, so is notified again if it comes within the window again.
+// Failures are logged rather than failing the run, and are retried by the next run.
+func (d *Daemon) notifyExpiring(ctx context.Context) {
+	if d.expiryHook == nil {
+		return
+	}
+
+	expiries, err := d.listExpiring(ctx)
+	if err != nil {
+		d.logger.Error("Failed to list expiring entitlements", zap.Error(err))
+		return
+	}
+
+	for _, expiry := range expiries {
+		fields := append(d.identityFields(expiry.DiscordId, 0, expiry.GuildId, expiry.UserId), zap.String("entitlement_id", expiry.EntitlementId.String()))
+
+		if err := d.expiryHook.Expiring(ctx, expiry); err != nil {
+			metrics.ExpiryHookFailures.WithLabelValues(d.applicationLabel).Inc()
+			d.logger.Error("Failed to call expiry hook", append(fields, zap.Error(err))...)
+
+			continue
+		}
+
+		if _, err := d.db().pool.Exec(ctx, insertExpiryNotificationQuery, expiry.EntitlementId, expiry.ExpiresAt); err != nil {
+			d.logger.Error("Failed to record expiry notification", append(fields, zap.Error(err))...)
+			continue
+		}
+
+		d.logger.Debug("Called expiry hook", append(fields, zap.Time("expires_at", expiry.ExpiresAt))...)
+	}
+}
+
+func (d *Daemon) listExpiring(ctx context.Context) ([]activation.Expiry, error) {
+	rows, err := d.db().pool.Query(ctx, listExpiringEntitlementsQuery, d.config.ExpiryHook.Window.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var expiries []activation.Expiry
+	for rows.Next() {
+		var expiry activation.Expiry
+		if err := rows.Scan(
+			&expiry.EntitlementId,
+			&expiry.DiscordId,
+			&expiry.GuildId,
+			&expiry.UserId,
+			&expiry.SkuId,
+			&expiry.SkuLabel,
+			&expiry.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+
+		expiries = append(expiries, expiry)
+	}
+
+	return expiries, rows.Err()
+}
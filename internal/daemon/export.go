@@ -0,0 +1,243 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	//go:embed sql/export_entitlements.sql
+	exportEntitlementsQuery string
+
+	//go:embed sql/export_quarantine.sql
+	exportQuarantineQuery string
+
+	//go:embed sql/export_pending_deletions.sql
+	exportPendingDeletionsQuery string
+
+	//go:embed sql/export_guild_overrides.sql
+	exportGuildOverridesQuery string
+
+	//go:embed sql/export_undo_log.sql
+	exportUndoLogQuery string
+
+	//go:embed sql/export_renewals.sql
+	exportRenewalsQuery string
+
+	//go:embed sql/export_user_purge.sql
+	exportUserPurgeQuery string
+)
+
+// Export is all the data that the sync holds about a user or guild. It is serialised as-is by the admin API.
+type Export struct {
+	UserId           *uint64               `json:"user_id,string,omitempty"`
+	GuildId          *uint64               `json:"guild_id,string,omitempty"`
+	ExportedAt       time.Time             `json:"exported_at"`
+	Entitlements     []ExportedEntitlement `json:"entitlements"`
+	Quarantined      []ExportedQuarantine  `json:"quarantined_deletions,omitempty"`
+	PendingDeletions []ExportedPending     `json:"pending_deletions,omitempty"`
+	GuildOverrides   []ExportedOverride    `json:"guild_overrides,omitempty"`
+	UndoLog          []ExportedUndo        `json:"undo_log,omitempty"`
+	Renewals         []ExportedRenewal     `json:"renewals,omitempty"`
+	Purge            *ExportedPurge        `json:"purge,omitempty"`
+}
+
+type ExportedEntitlement struct {
+	Id        uuid.UUID  `json:"id"`
+	GuildId   *uint64    `json:"guild_id,string"`
+	UserId    *uint64    `json:"user_id,string"`
+	SkuId     uuid.UUID  `json:"sku_id"`
+	SkuLabel  string     `json:"sku_label"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// DiscordId is the Discord entitlement that the entitlement is synced from, if it is still linked
+	DiscordId *uint64 `json:"discord_id,string"`
+}
+
+type ExportedQuarantine struct {
+	DiscordId     uint64     `json:"discord_id,string"`
+	EntitlementId uuid.UUID  `json:"entitlement_id"`
+	QuarantinedAt time.Time  `json:"quarantined_at"`
+	ApprovedAt    *time.Time `json:"approved_at"`
+}
+
+type ExportedPending struct {
+	DiscordId     uint64    `json:"discord_id,string"`
+	EntitlementId uuid.UUID `json:"entitlement_id"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+}
+
+type ExportedOverride struct {
+	DiscordId uint64    `json:"discord_id,string"`
+	GuildId   uint64    `json:"guild_id,string"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportedUndo is a deleted entitlement held in the undo log
+type ExportedUndo struct {
+	RunId         uuid.UUID  `json:"run_id"`
+	EntitlementId uuid.UUID  `json:"entitlement_id"`
+	DiscordId     *uint64    `json:"discord_id,string"`
+	GuildId       *uint64    `json:"guild_id,string"`
+	UserId        *uint64    `json:"user_id,string"`
+	SkuId         uuid.UUID  `json:"sku_id"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	DeletedAt     time.Time  `json:"deleted_at"`
+	RestoredAt    *time.Time `json:"restored_at"`
+}
+
+type ExportedRenewal struct {
+	RunId             uuid.UUID `json:"run_id"`
+	EntitlementId     uuid.UUID `json:"entitlement_id"`
+	DiscordId         uint64    `json:"discord_id,string"`
+	GuildId           *uint64   `json:"guild_id,string"`
+	UserId            *uint64   `json:"user_id,string"`
+	SkuId             uuid.UUID `json:"sku_id"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	RenewedAt         time.Time `json:"renewed_at"`
+}
+
+type ExportedPurge struct {
+	PurgedAt     time.Time `json:"purged_at"`
+	Entitlements int       `json:"entitlements"`
+}
+
+// ExportData collects all the data held about the user or guild, exactly one of which must be set. Only entitlements
+// synced from Discord are included.
+func (d *Daemon) ExportData(ctx context.Context, userId, guildId *uint64) (Export, error) {
+	if (userId == nil) == (guildId == nil) {
+		return Export{}, errors.New("exactly one of user ID or guild ID is required")
+	}
+
+	// Prevent the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	tx, err := d.db().pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return Export{}, err
+	}
+
+	defer rollback(tx)
+
+	export := Export{
+		UserId:       userId,
+		GuildId:      guildId,
+		ExportedAt:   time.Now(),
+		Entitlements: make([]ExportedEntitlement, 0),
+	}
+
+	rows, err := tx.Query(ctx, exportEntitlementsQuery, userId, guildId, model.EntitlementSourceDiscord)
+	if err != nil {
+		return Export{}, err
+	}
+
+	var entitlementIds []uuid.UUID
+	var discordIds []uint64
+	for rows.Next() {
+		var e ExportedEntitlement
+		if err := rows.Scan(&e.Id, &e.GuildId, &e.UserId, &e.SkuId, &e.SkuLabel, &e.ExpiresAt, &e.DiscordId); err != nil {
+			rows.Close()
+			return Export{}, err
+		}
+
+		export.Entitlements = append(export.Entitlements, e)
+		entitlementIds = append(entitlementIds, e.Id)
+		if e.DiscordId != nil {
+			discordIds = append(discordIds, *e.DiscordId)
+		}
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Export{}, err
+	}
+
+	if d.config.DeletionQuarantine.Enabled && len(entitlementIds) > 0 {
+		export.Quarantined, err = collectRows(ctx, tx, exportQuarantineQuery, func(rows pgx.Rows) (ExportedQuarantine, error) {
+			var q ExportedQuarantine
+			return q, rows.Scan(&q.DiscordId, &q.EntitlementId, &q.QuarantinedAt, &q.ApprovedAt)
+		}, uuidArray(entitlementIds))
+		if err != nil {
+			return Export{}, err
+		}
+	}
+
+	if d.gracePeriodEnabled() && len(entitlementIds) > 0 {
+		export.PendingDeletions, err = collectRows(ctx, tx, exportPendingDeletionsQuery, func(rows pgx.Rows) (ExportedPending, error) {
+			var p ExportedPending
+			return p, rows.Scan(&p.DiscordId, &p.EntitlementId, &p.FirstSeenAt)
+		}, uuidArray(entitlementIds))
+		if err != nil {
+			return Export{}, err
+		}
+	}
+
+	if d.config.Retarget.Enabled && len(discordIds) > 0 {
+		export.GuildOverrides, err = collectRows(ctx, tx, exportGuildOverridesQuery, func(rows pgx.Rows) (ExportedOverride, error) {
+			var o ExportedOverride
+			return o, rows.Scan(&o.DiscordId, &o.GuildId, &o.UpdatedAt)
+		}, discordIds)
+		if err != nil {
+			return Export{}, err
+		}
+	}
+
+	if d.config.UndoLog.Enabled {
+		export.UndoLog, err = collectRows(ctx, tx, exportUndoLogQuery, func(rows pgx.Rows) (ExportedUndo, error) {
+			var u ExportedUndo
+			return u, rows.Scan(&u.RunId, &u.EntitlementId, &u.DiscordId, &u.GuildId, &u.UserId, &u.SkuId, &u.ExpiresAt, &u.DeletedAt, &u.RestoredAt)
+		}, userId, guildId, model.EntitlementSourceDiscord)
+		if err != nil {
+			return Export{}, err
+		}
+	}
+
+	if d.config.RenewalEvents.Enabled {
+		export.Renewals, err = collectRows(ctx, tx, exportRenewalsQuery, func(rows pgx.Rows) (ExportedRenewal, error) {
+			var r ExportedRenewal
+			return r, rows.Scan(&r.RunId, &r.EntitlementId, &r.DiscordId, &r.GuildId, &r.UserId, &r.SkuId, &r.PreviousExpiresAt, &r.ExpiresAt, &r.RenewedAt)
+		}, userId, guildId)
+		if err != nil {
+			return Export{}, err
+		}
+	}
+
+	if d.config.UserPurge.Enabled && userId != nil {
+		var purge ExportedPurge
+		if err := tx.QueryRow(ctx, exportUserPurgeQuery, d.purgeHash(*userId)).Scan(&purge.PurgedAt, &purge.Entitlements); err == nil {
+			export.Purge = &purge
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return Export{}, err
+		}
+	}
+
+	return export, nil
+}
+
+func collectRows[T any](ctx context.Context, tx pgx.Tx, query string, scan func(pgx.Rows) (T, error), args ...any) ([]T, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, item)
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,169 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/utils"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"go.uber.org/zap"
+)
+
+const pageLimit = 100
+
+// fetchEntitlements lists all the application's entitlements, along with the hash of each page if
+// SNAPSHOT_REUSE_ENABLED is set. If the pages are inconsistent, the listing is started again from the first page, up
+// to PAGINATION_ATTEMPTS times.
+func (d *Daemon) fetchEntitlements(ctx context.Context) ([]entitlement.Entitlement, []pageHash, error) {
+	attempts := max(d.config.PaginationAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		entitlements, hashes, err := d.listEntitlements(ctx)
+
+		var paginationErr *PaginationError
+		if !errors.As(err, &paginationErr) || attempt >= attempts {
+			return entitlements, hashes, err
+		}
+
+		d.fetchLogger.Warn(
+			"Entitlement pages were inconsistent, listing again",
+			zap.Int("page", paginationErr.Page),
+			zap.Uint64("discord_id", paginationErr.DiscordId),
+			zap.Uint64("after", paginationErr.After),
+			zap.Int("attempt", attempt),
+		)
+		metrics.PaginationRefetches.WithLabelValues(d.applicationLabel).Inc()
+	}
+}
+
+// listEntitlements pages through the application's entitlements once
+func (d *Daemon) listEntitlements(ctx context.Context) ([]entitlement.Entitlement, []pageHash, error) {
+	pager := d.newEntitlementPager(0)
+	pager.scope, _ = runScopeFromContext(ctx)
+
+	var entitlements []entitlement.Entitlement
+	for {
+		page, err := pager.Next(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if page == nil {
+			return entitlements, pager.hashes, nil
+		}
+
+		entitlements = append(entitlements, page...)
+	}
+}
+
+// entitlementPager iterates over the application's entitlements a page at a time, in ascending ID order
+type entitlementPager struct {
+	d     *Daemon
+	after uint64
+	// scope restricts the entitlements listed to a single guild or user, if set
+	scope runScope
+	pages int
+	done  bool
+	// hashes are the hashes of the pages fetched so far, if SNAPSHOT_REUSE_ENABLED is set
+	hashes []pageHash
+}
+
+// newEntitlementPager creates a pager that starts after the entitlement with the given ID, e.g. the Cursor of a
+// previous pager. Use 0 to start from the beginning.
+func (d *Daemon) newEntitlementPager(after uint64) *entitlementPager {
+	return &entitlementPager{
+		d:     d,
+		after: after,
+	}
+}
+
+// Next fetches the next page of entitlements, returning nil once all pages have been fetched. ctx is checked before
+// each request, so that a cancelled run stops between pages rather than only when a request fails.
+func (p *entitlementPager) Next(ctx context.Context) ([]entitlement.Entitlement, error) {
+	if p.done {
+		return nil, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	options := rest.EntitlementQueryOptions{
+		After:         utils.Ptr(p.after),
+		Limit:         utils.Ptr(pageLimit),
+		ExcludedEnded: utils.Ptr(true),
+	}
+
+	if p.scope.GuildId != 0 {
+		options.GuildId = utils.Ptr(p.scope.GuildId)
+	}
+
+	if p.scope.UserId != 0 {
+		options.UserId = utils.Ptr(p.scope.UserId)
+	}
+
+	var (
+		fetched  []entitlement.Entitlement
+		duration time.Duration
+	)
+	err := p.d.retryDiscord(ctx, func() error {
+		start := time.Now()
+
+		authorization, err := p.d.authorization(ctx)
+		if err != nil {
+			return err
+		}
+
+		fetched, err = rest.ListEntitlements(ctx, authorization, nil, p.d.config.Discord.ApplicationId, options)
+		duration = time.Since(start)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.FetchPageDuration.WithLabelValues(p.d.applicationLabel).Observe(duration.Seconds())
+	p.pages++
+
+	p.d.fetchLogger.Debug(
+		"Fetched page of entitlements",
+		zap.Uint64("after", p.after),
+		zap.Int("page", p.pages),
+		zap.Int("count", len(fetched)),
+		zap.Duration("duration", duration),
+	)
+
+	if len(fetched) < pageLimit {
+		p.done = true
+	}
+
+	if len(fetched) == 0 {
+		return nil, nil
+	}
+
+	// Entitlements are listed in ascending ID order after the cursor, so an ID that does not follow the previous one
+	// means that the listing has shifted between pages
+	previous := p.after
+	for _, e := range fetched {
+		if e.Id <= previous {
+			return nil, &PaginationError{Page: p.pages, DiscordId: e.Id, After: previous}
+		}
+
+		previous = e.Id
+	}
+
+	if p.d.config.SnapshotReuse.Enabled {
+		p.hashes = append(p.hashes, hashPage(fetched))
+	}
+
+	p.after = fetched[len(fetched)-1].Id
+	return fetched, nil
+}
+
+// Cursor returns the ID of the last entitlement fetched, from which a new pager can resume
+func (p *entitlementPager) Cursor() uint64 {
+	return p.after
+}
@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/flags"
+	"go.uber.org/zap"
+)
+
+const (
+	flagDeletionsEnabled = "entitlements-sync.deletions-enabled"
+	flagDryRun           = "entitlements-sync.dry-run"
+	flagCanaryPercentage = "entitlements-sync.canary-percentage"
+)
+
+// runFlags holds the feature flags evaluated at the start of each run
+type runFlags struct {
+	DeletionsEnabled bool
+	DryRun           bool
+	// CanaryPercentage is the percentage of entitlements, by Discord ID, that changes are applied to
+	CanaryPercentage float64
+}
+
+var defaultRunFlags = runFlags{
+	DeletionsEnabled: true,
+	DryRun:           false,
+	CanaryPercentage: 100,
+}
+
+func newFlagsClient(config config.Config) *flags.Client {
+	if len(config.Flags.OfrepUrl) == 0 {
+		return nil
+	}
+
+	return flags.NewClient(config.Flags.OfrepUrl, config.Flags.AuthToken)
+}
+
+// evaluateFlags evaluates the feature flags for a run. If a flag cannot be evaluated, its default is used.
+func (d *Daemon) evaluateFlags(ctx context.Context) runFlags {
+	if d.flags == nil {
+		res := defaultRunFlags
+		res.DryRun = d.config.DryRun
+		return res
+	}
+
+	evalCtx := flags.EvaluationContext{
+		"targetingKey":   strconv.FormatUint(d.config.Discord.ApplicationId, 10),
+		"application_id": strconv.FormatUint(d.config.Discord.ApplicationId, 10),
+		"shard_index":    d.config.ShardIndex,
+	}
+
+	res := defaultRunFlags
+
+	var err error
+	if res.DeletionsEnabled, err = d.flags.Bool(ctx, flagDeletionsEnabled, defaultRunFlags.DeletionsEnabled, evalCtx); err != nil {
+		d.logger.Warn("Failed to evaluate feature flag, using default", zap.String("flag", flagDeletionsEnabled), zap.Error(err))
+	}
+
+	if res.DryRun, err = d.flags.Bool(ctx, flagDryRun, defaultRunFlags.DryRun, evalCtx); err != nil {
+		d.logger.Warn("Failed to evaluate feature flag, using default", zap.String("flag", flagDryRun), zap.Error(err))
+	}
+
+	if res.CanaryPercentage, err = d.flags.Float(ctx, flagCanaryPercentage, defaultRunFlags.CanaryPercentage, evalCtx); err != nil {
+		d.logger.Warn("Failed to evaluate feature flag, using default", zap.String("flag", flagCanaryPercentage), zap.Error(err))
+	}
+
+	// The flag cannot turn off a dry run required by DRY_RUN
+	res.DryRun = res.DryRun || d.config.DryRun
+
+	d.logger.Debug(
+		"Evaluated feature flags",
+		zap.Bool("deletions_enabled", res.DeletionsEnabled),
+		zap.Bool("dry_run", res.DryRun),
+		zap.Float64("canary_percentage", res.CanaryPercentage),
+	)
+
+	return res
+}
+
+// applyFlags removes the changes from the plan that are disabled by the feature flags
+func (d *Daemon) applyFlags(p plan, flags runFlags) plan {
+	if !flags.DeletionsEnabled {
+		if len(p.Deletions) > 0 || len(p.MissingDeletions) > 0 {
+			d.logger.Info("Deletions are disabled by feature flag", zap.Int("deletions", len(p.Deletions)), zap.Int("missing_deletions", len(p.MissingDeletions)))
+		}
+
+		p.Deletions = nil
+		p.MissingDeletions = nil
+	}
+
+	if flags.CanaryPercentage < 100 {
+		// Changes are bucketed by Discord ID, so that the same entitlements are included while the percentage is
+		// unchanged, and are still included as it increases
+		inCanary := func(discordId uint64) bool {
+			return float64(discordId%10000) < flags.CanaryPercentage*100
+		}
+
+		creations := p.Creations[:0:0]
+		for _, creation := range p.Creations {
+			if inCanary(creation.Entitlement.Id) {
+				creations = append(creations, creation)
+			}
+		}
+
+		excluded := len(p.Creations) - len(creations)
+		p.Creations = creations
+
+		filter := func(deletions []plannedDeletion) []plannedDeletion {
+			var kept []plannedDeletion
+			for _, deletion := range deletions {
+				if inCanary(deletion.DiscordId) {
+					kept = append(kept, deletion)
+				} else {
+					excluded++
+				}
+			}
+
+			return kept
+		}
+
+		p.Deletions = filter(p.Deletions)
+		p.MissingDeletions = filter(p.MissingDeletions)
+
+		d.logger.Info("Applying changes to canary percentage of entitlements", zap.Float64("percentage", flags.CanaryPercentage), zap.Int("excluded", excluded))
+	}
+
+	return p
+}
+
+// Toggles are the runtime switches that affect which changes a run applies
+type Toggles struct {
+	DeletionsPaused  bool
+	DeletionsEnabled bool
+	DryRun           bool
+	CanaryPercentage float64
+}
+
+// Toggles returns the current runtime switches, evaluating the feature flags as a run starting now would
+func (d *Daemon) Toggles(ctx context.Context) Toggles {
+	flags := d.evaluateFlags(ctx)
+
+	return Toggles{
+		DeletionsPaused:  d.DeletionsPaused(),
+		DeletionsEnabled: flags.DeletionsEnabled,
+		DryRun:           flags.DryRun,
+		CanaryPercentage: flags.CanaryPercentage,
+	}
+}
@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"slices"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// defaultRunFrequency is used in place of a RUN_FREQUENCY that is not positive, which would start runs back to back
+const defaultRunFrequency = time.Minute
+
+// runInterval returns how long to wait after a scheduled run before starting the next. If full runs are typically
+// taking longer than RUN_FREQUENCY, the interval is stretched to the median duration of the recent ones, so that the
+// database is not kept busy with runs continuously.
+func (d *Daemon) runInterval() time.Duration {
+	frequency := d.config.RunFrequency
+	if frequency <= 0 {
+		frequency = defaultRunFrequency
+	}
+
+	interval := frequency
+	if d.config.AdaptiveFrequency {
+		if typical, ok := d.history.typicalDuration(); ok && typical > frequency {
+			interval = typical
+		}
+	}
+
+	stretched := interval > frequency
+	if stretched && !d.intervalStretched {
+		d.logger.Warn(
+			"Runs are taking longer than RUN_FREQUENCY, stretching the interval between runs",
+			zap.Duration("frequency", frequency),
+			zap.Duration("interval", interval),
+		)
+	} else if !stretched && d.intervalStretched {
+		d.logger.Info("Runs are taking less than RUN_FREQUENCY again, restoring the interval between runs", zap.Duration("frequency", frequency))
+	}
+
+	d.intervalStretched = stretched
+	metrics.RunInterval.WithLabelValues(d.applicationLabel).Set(interval.Seconds())
+
+	return interval
+}
+
+// checkFrequency warns about values of RUN_FREQUENCY that runs cannot keep up with
+func (d *Daemon) checkFrequency() {
+	if d.config.RunFrequency <= 0 {
+		d.logger.Warn("RUN_FREQUENCY must be positive, using the default", zap.Duration("frequency", d.config.RunFrequency), zap.Duration("default", defaultRunFrequency))
+		return
+	}
+
+	if d.config.RunFrequency < d.config.ExecutionTimeout {
+		d.logger.Warn(
+			"RUN_FREQUENCY is shorter than EXECUTION_TIMEOUT, the interval between runs will be stretched if they take longer than RUN_FREQUENCY",
+			zap.Duration("frequency", d.config.RunFrequency),
+			zap.Duration("execution_timeout", d.config.ExecutionTimeout),
+			zap.Bool("adaptive_frequency", d.config.AdaptiveFrequency),
+		)
+	}
+}
+
+// typicalDuration returns the median duration of the recent full runs that did not fail
+func (h *runHistory) typicalDuration() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var durations []time.Duration
+	for _, run := range h.runs {
+		if len(run.Error) == 0 && run.GuildId == 0 && run.UserId == 0 {
+			durations = append(durations, run.Duration)
+		}
+	}
+
+	if len(durations) == 0 {
+		return 0, false
+	}
+
+	slices.Sort(durations)
+	return durations[len(durations)/2], true
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestRunInterval(t *testing.T) {
+	tests := []struct {
+		name          string
+		frequency     time.Duration
+		adaptive      bool
+		runs          []RunSummary
+		wantInterval  time.Duration
+		wantStretched bool
+	}{
+		{
+			name:         "uses RUN_FREQUENCY without history",
+			frequency:    time.Minute,
+			adaptive:     true,
+			wantInterval: time.Minute,
+		},
+		{
+			name:         "uses default for non-positive RUN_FREQUENCY",
+			frequency:    0,
+			wantInterval: defaultRunFrequency,
+		},
+		{
+			name:      "stretches to median of slow runs",
+			frequency: time.Minute,
+			adaptive:  true,
+			runs: []RunSummary{
+				{Duration: time.Minute * 2},
+				{Duration: time.Minute * 5},
+				{Duration: time.Minute * 3},
+			},
+			wantInterval:  time.Minute * 3,
+			wantStretched: true,
+		},
+		{
+			name:      "does not stretch without ADAPTIVE_FREQUENCY",
+			frequency: time.Minute,
+			runs: []RunSummary{
+				{Duration: time.Minute * 5},
+			},
+			wantInterval: time.Minute,
+		},
+		{
+			name:      "does not shorten for fast runs",
+			frequency: time.Minute,
+			adaptive:  true,
+			runs: []RunSummary{
+				{Duration: time.Second},
+			},
+			wantInterval: time.Minute,
+		},
+		{
+			name:      "ignores failed and scoped runs",
+			frequency: time.Minute,
+			adaptive:  true,
+			runs: []RunSummary{
+				{Duration: time.Minute * 10, Error: "timed out"},
+				{Duration: time.Minute * 10, GuildId: 1},
+				{Duration: time.Second * 30},
+			},
+			wantInterval: time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config.Config
+			cfg.RunFrequency = tt.frequency
+			cfg.AdaptiveFrequency = tt.adaptive
+
+			d := &Daemon{config: cfg, logger: zap.NewNop(), applicationLabel: "test"}
+			for _, run := range tt.runs {
+				d.history.record(run)
+			}
+
+			if interval := d.runInterval(); interval != tt.wantInterval {
+				t.Errorf("got interval %v, want %v", interval, tt.wantInterval)
+			}
+
+			if d.intervalStretched != tt.wantStretched {
+				t.Errorf("got stretched %t, want %t", d.intervalStretched, tt.wantStretched)
+			}
+		})
+	}
+}
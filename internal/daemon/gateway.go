@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/gdl/cache"
+	"github.com/TicketsBot-cloud/gdl/gateway"
+	"github.com/TicketsBot-cloud/gdl/gateway/payloads/events"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/TicketsBot-cloud/gdl/rest/ratelimit"
+	"go.uber.org/zap"
+)
+
+const (
+	gatewayEventCreate = "create"
+	gatewayEventUpdate = "update"
+	gatewayEventDelete = "delete"
+)
+
+// listenGateway connects to the Discord Gateway and syncs entitlements as they are created, updated and deleted,
+// rather than waiting for the next run. No intents are requested, as entitlement events are always sent, and nothing
+// is cached. Shards reconnect by themselves if disconnected, and any events missed in the meantime are picked up by
+// the periodic runs.
+func (d *Daemon) listenGateway() {
+	d.shardsMu.Lock()
+	defer d.shardsMu.Unlock()
+
+	shardCount := max(d.config.Gateway.ShardCount, 1)
+
+	manager := gateway.NewShardManager(d.token.get(), gateway.ShardOptions{
+		ShardCount: gateway.ShardCount{
+			Total:   shardCount,
+			Lowest:  0,
+			Highest: shardCount,
+		},
+		CacheFactory:   cache.MemoryCacheFactory(cache.CacheOptions{}),
+		RateLimitStore: ratelimit.NewMemoryStore(),
+	})
+
+	manager.RegisterListeners(
+		func(_ *gateway.Shard, e *events.EntitlementCreate) {
+			d.handleEntitlementEvent(gatewayEventCreate, e.Entitlement)
+		},
+		func(_ *gateway.Shard, e *events.EntitlementUpdate) {
+			d.handleEntitlementEvent(gatewayEventUpdate, e.Entitlement)
+		},
+		func(_ *gateway.Shard, e *events.EntitlementDelete) {
+			d.handleEntitlementEvent(gatewayEventDelete, e.Entitlement)
+		},
+	)
+
+	d.logger.Info("Connecting to gateway", zap.Int("shard_count", shardCount))
+	manager.Connect()
+	d.shards = manager
+}
+
+// reconnectGateway disconnects the shards identified with the previous bot token, and connects new ones with the
+// current token. The gateway is always identified with the bot token, as OAuth2 access tokens cannot identify.
+func (d *Daemon) reconnectGateway() {
+	d.shardsMu.Lock()
+	previous := d.shards
+	d.shardsMu.Unlock()
+
+	if previous == nil {
+		return
+	}
+
+	d.logger.Info("Discord token changed, reconnecting to gateway")
+	for _, shard := range previous.Shards {
+		if err := shard.Kill(); err != nil {
+			d.logger.Warn("Failed to disconnect gateway shard", zap.Int("shard_id", shard.ShardId), zap.Error(err))
+		}
+	}
+
+	d.listenGateway()
+}
+
+// handleEntitlementEvent queues a sync for the owner of an entitlement received from the gateway. A scoped run does
+// not see entitlements that Discord no longer lists, so deletions trigger a full run instead.
+func (d *Daemon) handleEntitlementEvent(eventType string, e entitlement.Entitlement) {
+	if e.ApplicationId != d.config.Discord.ApplicationId {
+		return
+	}
+
+	metrics.GatewayEvents.WithLabelValues(d.applicationLabel, eventType).Inc()
+
+	fields := append(d.entitlementFields(e), zap.String("event", eventType))
+
+	if eventType == gatewayEventDelete {
+		d.logger.Info("Entitlement deleted, triggering run", fields...)
+		d.Trigger()
+		return
+	}
+
+	var scope runScope
+	switch {
+	case e.GuildId != nil:
+		scope.GuildId = *e.GuildId
+	case e.UserId != nil:
+		scope.UserId = *e.UserId
+	default:
+		d.logger.Warn("Received entitlement with neither a guild nor a user, triggering run", fields...)
+		d.Trigger()
+		return
+	}
+
+	d.logger.Info("Received entitlement event, syncing", fields...)
+	d.requestScopedSync(scope)
+}
@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/list_pending_deletions.sql
+	listPendingDeletionsQuery string
+
+	//go:embed sql/insert_pending_deletions.sql
+	insertPendingDeletionsQuery string
+
+	//go:embed sql/clear_pending_deletions.sql
+	clearPendingDeletionsQuery string
+)
+
+func (d *Daemon) gracePeriodEnabled() bool {
+	return d.config.DeletedEntitlementPolicy == config.DeletionPolicyGrace ||
+		d.config.MissingEntitlementPolicy == config.DeletionPolicyGrace
+}
+
+// deferDeletions withholds the planned deletions subject to the grace policy until the entitlement has been removed
+// for DELETION_GRACE_PERIOD. Withheld deletions are moved to p.Pending, to be written to the pending_deletions table
+// by syncPendingDeletions, which records when each was first seen.
+func (d *Daemon) deferDeletions(ctx context.Context, tx pgx.Tx, p *plan) error {
+	if !d.gracePeriodEnabled() {
+		return nil
+	}
+
+	var candidates []plannedDeletion
+	if d.config.DeletedEntitlementPolicy == config.DeletionPolicyGrace {
+		candidates = append(candidates, p.Deletions...)
+	}
+
+	if d.config.MissingEntitlementPolicy == config.DeletionPolicyGrace {
+		candidates = append(candidates, p.MissingDeletions...)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	discordIds := make([]uint64, len(candidates))
+	for i, deletion := range candidates {
+		discordIds[i] = deletion.DiscordId
+	}
+
+	rows, err := tx.Query(ctx, listPendingDeletionsQuery, discordIds, d.config.DeletionGracePeriod.Seconds())
+	if err != nil {
+		return err
+	}
+
+	elapsed := make(map[uint64]uuid.UUID)
+	for rows.Next() {
+		var (
+			link    link
+			expired bool
+		)
+
+		if err := rows.Scan(&link.DiscordId, &link.EntitlementId, &expired); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if expired {
+			elapsed[link.DiscordId] = link.EntitlementId
+		}
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	split := func(deletions []plannedDeletion, policy config.DeletionPolicy) []plannedDeletion {
+		if policy != config.DeletionPolicyGrace {
+			return deletions
+		}
+
+		var kept []plannedDeletion
+		for _, deletion := range deletions {
+			if entitlementId, ok := elapsed[deletion.DiscordId]; ok && entitlementId == deletion.EntitlementId {
+				kept = append(kept, deletion)
+			} else {
+				p.Pending = append(p.Pending, deletion)
+			}
+		}
+
+		return kept
+	}
+
+	p.Deletions = split(p.Deletions, d.config.DeletedEntitlementPolicy)
+	p.MissingDeletions = split(p.MissingDeletions, d.config.MissingEntitlementPolicy)
+
+	if len(p.Pending) > 0 {
+		d.logger.Debug(
+			"Deferring deletions until the grace period has elapsed",
+			zap.Int("count", len(p.Pending)),
+			zap.Duration("grace_period", d.config.DeletionGracePeriod),
+		)
+	}
+
+	return nil
+}
+
+// syncPendingDeletions records when each pending deletion was first seen, and removes entries for entitlements that
+// have since been deleted, or that Discord lists as active again
+func (d *Daemon) syncPendingDeletions(ctx context.Context, tx pgx.Tx, p plan, activeEntitlements []entitlement.Entitlement) error {
+	if !d.gracePeriodEnabled() {
+		return nil
+	}
+
+	if len(p.Pending) > 0 {
+		discordIds := make([]uint64, len(p.Pending))
+		entitlementIds := make([]uuid.UUID, len(p.Pending))
+		for i, deletion := range p.Pending {
+			discordIds[i] = deletion.DiscordId
+			entitlementIds[i] = deletion.EntitlementId
+		}
+
+		if _, err := tx.Exec(ctx, insertPendingDeletionsQuery, discordIds, uuidArray(entitlementIds)); err != nil {
+			return err
+		}
+	}
+
+	active := make([]uint64, 0, len(activeEntitlements))
+	for _, entitlement := range activeEntitlements {
+		if !entitlement.Deleted {
+			active = append(active, entitlement.Id)
+		}
+	}
+
+	_, err := tx.Exec(ctx, clearPendingDeletionsQuery, active)
+	return err
+}
@@ -0,0 +1,202 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"slices"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/activation"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+//go:embed sql/list_entitlement_guilds.sql
+var listEntitlementGuildsQuery string
+
+func newGuildHook(config config.Config) *activation.Hook {
+	if len(config.GuildHook.Url) == 0 {
+		return nil
+	}
+
+	return activation.NewHook(config.GuildHook.Url, config.GuildHook.AuthToken, config.GuildHook.Timeout)
+}
+
+// removedGuildEntitlement is a guild entitlement that the plan deletes
+type removedGuildEntitlement struct {
+	GuildId   uint64
+	SkuId     uuid.UUID
+	ExpiresAt *time.Time
+}
+
+// lookupRemovedGuilds reads the guild of each entitlement that p deletes, if GUILD_HOOK_URL is set. It must be called
+// before the plan is applied, as the guild of a missing entitlement is not known once its row has been deleted.
+// Entitlements that belong to a user are not included.
+func (d *Daemon) lookupRemovedGuilds(ctx context.Context, tx pgx.Tx, p plan) (map[uuid.UUID]removedGuildEntitlement, error) {
+	if d.guildHook == nil || len(p.Deletions)+len(p.MissingDeletions) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(p.Deletions)+len(p.MissingDeletions))
+	for _, deletions := range [][]plannedDeletion{p.Deletions, p.MissingDeletions} {
+		for _, deletion := range deletions {
+			ids = append(ids, deletion.EntitlementId)
+		}
+	}
+
+	rows, err := tx.Query(ctx, listEntitlementGuildsQuery, uuidArray(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	removed := make(map[uuid.UUID]removedGuildEntitlement)
+	for rows.Next() {
+		var (
+			id          uuid.UUID
+			entitlement removedGuildEntitlement
+		)
+
+		if err := rows.Scan(&id, &entitlement.GuildId, &entitlement.SkuId, &entitlement.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		removed[id] = entitlement
+	}
+
+	return removed, rows.Err()
+}
+
+// guildChanges batches the newly created entitlements and the removed guild entitlements by guild, in order of guild
+// ID. Guilds whose entitlements were only replaced by ones for the same SKUs are left out, as their premium is
+// unchanged.
+func guildChanges(runId uuid.UUID, activations []activation.Activation, p plan, removed map[uuid.UUID]removedGuildEntitlement) []activation.GuildChange {
+	byGuild := make(map[uint64]*activation.GuildChange)
+	get := func(guildId uint64) *activation.GuildChange {
+		change, ok := byGuild[guildId]
+		if !ok {
+			change = &activation.GuildChange{RunId: runId, GuildId: guildId}
+			byGuild[guildId] = change
+		}
+
+		return change
+	}
+
+	for _, created := range activations {
+		if created.GuildId == nil {
+			continue
+		}
+
+		change := get(*created.GuildId)
+		change.Added = append(change.Added, activation.GuildEntitlement{
+			EntitlementId: created.EntitlementId,
+			DiscordId:     created.DiscordId,
+			SkuId:         created.SkuId,
+			SkuLabel:      created.SkuLabel,
+			ExpiresAt:     created.ExpiresAt,
+		})
+	}
+
+	for _, deletions := range [][]plannedDeletion{p.Deletions, p.MissingDeletions} {
+		for _, deletion := range deletions {
+			entitlement, ok := removed[deletion.EntitlementId]
+			if !ok {
+				continue
+			}
+
+			change := get(entitlement.GuildId)
+			change.Removed = append(change.Removed, activation.GuildEntitlement{
+				EntitlementId: deletion.EntitlementId,
+				DiscordId:     deletion.DiscordId,
+				SkuId:         entitlement.SkuId,
+				ExpiresAt:     entitlement.ExpiresAt,
+			})
+		}
+	}
+
+	changes := make([]activation.GuildChange, 0, len(byGuild))
+	for _, change := range byGuild {
+		switch {
+		case len(change.Removed) == 0:
+			change.Event = activation.GuildGainedPremium
+		case len(change.Added) == 0:
+			change.Event = activation.GuildLostPremium
+		case sameSkus(change.Added, change.Removed):
+			continue
+		default:
+			change.Event = activation.GuildTierChanged
+		}
+
+		changes = append(changes, *change)
+	}
+
+	slices.SortFunc(changes, func(a, b activation.GuildChange) int {
+		switch {
+		case a.GuildId < b.GuildId:
+			return -1
+		case a.GuildId > b.GuildId:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return changes
+}
+
+// sameSkus returns true if a and b hold entitlements for exactly the same set of SKUs
+func sameSkus(a, b []activation.GuildEntitlement) bool {
+	skus := func(entitlements []activation.GuildEntitlement) map[uuid.UUID]struct{} {
+		set := make(map[uuid.UUID]struct{}, len(entitlements))
+		for _, entitlement := range entitlements {
+			set[entitlement.SkuId] = struct{}{}
+		}
+
+		return set
+	}
+
+	skusA, skusB := skus(a), skus(b)
+	if len(skusA) != len(skusB) {
+		return false
+	}
+
+	for skuId := range skusA {
+		if _, ok := skusB[skuId]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// notifyGuildChanges calls the guild hook once for each guild whose entitlements the run changed. It must only be
+// called once the changes have been committed. Failures are logged rather than failing the run, as the changes have
+// already been made.
+func (d *Daemon) notifyGuildChanges(ctx context.Context, activations []activation.Activation, p plan, removed map[uuid.UUID]removedGuildEntitlement) {
+	if d.guildHook == nil {
+		return
+	}
+
+	runId, _ := RunIdFromContext(ctx)
+	for _, change := range guildChanges(runId, activations, p, removed) {
+		fields := []zap.Field{
+			zap.Uint64("guild_id", change.GuildId),
+			zap.String("event", string(change.Event)),
+			zap.Int("added", len(change.Added)),
+			zap.Int("removed", len(change.Removed)),
+		}
+
+		if err := d.guildHook.GuildChanged(ctx, change); err != nil {
+			metrics.GuildHookFailures.WithLabelValues(d.applicationLabel).Inc()
+			d.logger.Error("Failed to call guild hook", append(fields, zap.Error(err))...)
+
+			continue
+		}
+
+		d.logger.Debug("Called guild hook", fields...)
+	}
+}
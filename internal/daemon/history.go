@@ -0,0 +1,144 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const historySize = 20
+
+// RunSummary describes the outcome of a single run
+type RunSummary struct {
+	RunId     uuid.UUID
+	StartedAt time.Time
+	// GuildId and UserId are the guild or user that the run was restricted to, or 0 for a full run
+	GuildId  uint64
+	UserId   uint64
+	Duration time.Duration
+	// Error is empty if the run succeeded
+	Error      string
+	ErrorClass ErrorClass
+	// Phase is the phase that the run failed in, if it failed
+	Phase string
+	// ReadOnly is true if the database was read-only, in which case the changes were reported but not applied
+	ReadOnly bool
+	// DryRun is true if the changes were reported but not applied because dry run was enabled
+	DryRun bool
+	// Unchanged is true if reconciliation was skipped because Discord listed the same entitlements as the last run
+	// that found the database in sync, see SNAPSHOT_REUSE_ENABLED
+	Unchanged bool
+
+	Fetched              int
+	Creations            int
+	Refreshes            int
+	Deletions            int
+	MissingDeletions     int
+	BlockedDeletions     int
+	DeferredDeletions    int
+	PendingDeletions     int
+	IgnoredDeletions     int
+	PausedDeletions      int
+	QuarantinedDeletions int
+	UnknownSkus          []uint64
+	Skipped              map[SkipReason]int
+}
+
+func (s *RunSummary) setPlan(p plan) {
+	s.Creations = p.NewCreations()
+	s.Refreshes = len(p.Creations) - p.NewCreations()
+	s.Deletions = len(p.Deletions)
+	s.MissingDeletions = len(p.MissingDeletions)
+	s.BlockedDeletions = p.BlockedDeletions
+	s.DeferredDeletions = p.DeferredDeletions
+	s.PendingDeletions = len(p.Pending)
+	s.IgnoredDeletions = p.IgnoredDeletions
+	s.PausedDeletions = p.PausedDeletions
+	s.QuarantinedDeletions = len(p.Quarantined)
+	s.UnknownSkus = p.UnknownSkus
+	s.Skipped = p.Skipped
+}
+
+// runHistory holds the summaries of the most recent runs
+type runHistory struct {
+	mu   sync.Mutex
+	runs []RunSummary
+	// lastSuccessAt is tracked separately, as the last successful run may have been evicted from runs
+	lastSuccessAt time.Time
+	// lastFullSuccessAt is the start time of the most recent full run that did not fail
+	lastFullSuccessAt time.Time
+}
+
+func (h *runHistory) record(summary RunSummary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs = append(h.runs, summary)
+	if len(summary.Error) == 0 {
+		h.lastSuccessAt = summary.StartedAt
+
+		if summary.GuildId == 0 && summary.UserId == 0 {
+			h.lastFullSuccessAt = summary.StartedAt
+		}
+	}
+
+	if len(h.runs) > historySize {
+		h.runs = h.runs[len(h.runs)-historySize:]
+	}
+}
+
+// latest returns the summary of the most recent run
+func (h *runHistory) latest() (RunSummary, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.runs) == 0 {
+		return RunSummary{}, false
+	}
+
+	return h.runs[len(h.runs)-1], true
+}
+
+// lastSuccess returns the start time of the most recent run that did not fail
+func (h *runHistory) lastSuccess() (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lastSuccessAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	return h.lastSuccessAt, true
+}
+
+// LastFullSync returns the start time of the most recent full run that did not fail. Scoped runs are not considered,
+// as their success says nothing about whether the rest of the entitlements are being synced.
+func (d *Daemon) LastFullSync() (time.Time, bool) {
+	d.history.mu.Lock()
+	defer d.history.mu.Unlock()
+
+	if d.history.lastFullSuccessAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	return d.history.lastFullSuccessAt, true
+}
+
+// StartedAt returns when the daemon was created
+func (d *Daemon) StartedAt() time.Time {
+	return d.startedAt
+}
+
+// RecentRuns returns the summaries of the most recent runs, newest first
+func (d *Daemon) RecentRuns() []RunSummary {
+	d.history.mu.Lock()
+	defer d.history.mu.Unlock()
+
+	runs := make([]RunSummary, len(d.history.runs))
+	for i, run := range d.history.runs {
+		runs[len(runs)-1-i] = run
+	}
+
+	return runs
+}
@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"go.uber.org/zap"
+)
+
+// entitlementFields returns the fields identifying a Discord entitlement, for attaching to every log line about it
+func (d *Daemon) entitlementFields(e entitlement.Entitlement) []zap.Field {
+	return d.identityFields(e.Id, e.SkuId, e.GuildId, e.UserId)
+}
+
+// identityFields returns the fields identifying an entitlement. skuId is the Discord SKU, and is omitted if 0, as are
+// the guild and user if nil. User IDs are hashed if LOG_HASH_USER_IDS is set.
+func (d *Daemon) identityFields(discordId, skuId uint64, guildId, userId *uint64) []zap.Field {
+	fields := []zap.Field{zap.Uint64("discord_id", discordId)}
+
+	if skuId != 0 {
+		fields = append(fields, zap.Uint64("sku_id", skuId))
+	}
+
+	if guildId != nil {
+		fields = append(fields, zap.Uint64("guild_id", *guildId))
+	}
+
+	if userId != nil {
+		fields = append(fields, d.userIdField(*userId))
+	}
+
+	return fields
+}
+
+func (d *Daemon) userIdField(userId uint64) zap.Field {
+	if !d.config.LogHashUserIds {
+		return zap.Uint64("user_id", userId)
+	}
+
+	// Keyed, as user IDs are snowflakes that could otherwise be recovered by hashing candidate IDs
+	mac := hmac.New(sha256.New, []byte(d.config.LogHashKey))
+	mac.Write([]byte(strconv.FormatUint(userId, 10)))
+	return zap.String("user_id", "sha256:"+hex.EncodeToString(mac.Sum(nil))[:16])
+}
+
+// deletionFields returns the fields identifying the entitlement to be deleted. Only the Discord ID is known for
+// missing entitlements.
+func (d *Daemon) deletionFields(deletion plannedDeletion) []zap.Field {
+	if deletion.Entitlement != nil {
+		return d.entitlementFields(*deletion.Entitlement)
+	}
+
+	return d.identityFields(deletion.DiscordId, 0, nil, nil)
+}
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/acquire_lease.sql
+	acquireLeaseQuery string
+
+	//go:embed sql/release_lease.sql
+	releaseLeaseQuery string
+
+	//go:embed sql/get_lease.sql
+	getLeaseQuery string
+)
+
+// leaseName identifies the set of entitlements a run covers, so that shards do not contend for the same lease
+func (d *Daemon) leaseName() string {
+	return fmt.Sprintf("entitlements-sync/%d/%d", d.config.Discord.ApplicationId, d.config.ShardIndex)
+}
+
+// acquireLease takes the run lease, so that overlapping runs from other processes (e.g. a CronJob whose previous
+// run overran) do not race each other. The lease expires after RUN_LEASE_DURATION, in case the holder is killed
+// before releasing it. If the lease is held by another process, ok is false.
+func (d *Daemon) acquireLease(ctx context.Context) (release func(), ok bool, err error) {
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("%s/%s", hostname, uuid.New())
+
+	var acquiredBy string
+	err = d.db().pool.QueryRow(ctx, acquireLeaseQuery, d.leaseName(), holder, d.config.RunLease.Duration.Seconds()).Scan(&acquiredBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var currentHolder string
+		var expiresAt time.Time
+		if err := d.db().pool.QueryRow(ctx, getLeaseQuery, d.leaseName()).Scan(&currentHolder, &expiresAt); err == nil {
+			d.logger.Info("Run lease is held by another process", zap.String("holder", currentHolder), zap.Time("expires_at", expiresAt))
+		}
+
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	release = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+		defer cancel()
+
+		if _, err := d.db().pool.Exec(ctx, releaseLeaseQuery, d.leaseName(), holder); err != nil {
+			d.logger.Warn("Failed to release run lease, it will expire", zap.Error(err))
+		}
+	}
+
+	return release, true, nil
+}
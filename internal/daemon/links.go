@@ -0,0 +1,236 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/TicketsBot-cloud/common/collections"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	//go:embed sql/list_links_page.sql
+	listLinksPageQuery string
+
+	//go:embed sql/create_staged_entitlements.sql
+	createStagedEntitlementsQuery string
+
+	//go:embed sql/list_staged_links.sql
+	listStagedLinksQuery string
+
+	//go:embed sql/list_unstaged_links.sql
+	listUnstagedLinksQuery string
+)
+
+const linkPageSize = 1000
+
+// missingLink is a link for an entitlement that Discord no longer lists
+type missingLink struct {
+	link
+	// SkuId is the internal SKU of the linked entitlement, or the zero UUID if the entitlement no longer exists
+	SkuId uuid.UUID
+}
+
+// linkState is the state of the discord_entitlements table relative to the entitlements listed by Discord
+type linkState struct {
+	// Linked maps the Discord IDs of listed entitlements that are already linked to their entitlement ID
+	Linked map[uint64]uuid.UUID
+	// Missing holds links for entitlements that Discord no longer lists. At most as many links as the removal
+	// threshold that applies to each SKU are retained, as none are deleted if the threshold is reached.
+	Missing []missingLink
+	// MissingCount is the total number of links for entitlements that Discord no longer lists
+	MissingCount int
+	// MissingBySku is the number of links for entitlements that Discord no longer lists, by internal SKU
+	MissingBySku map[uuid.UUID]int
+}
+
+// retainMissing adds link to Missing, unless as many links as the removal threshold for its SKU are already held
+func (s *linkState) retainMissing(link missingLink, thresholds removalThresholds, retained map[uuid.UUID]int) {
+	if retained[link.SkuId] < thresholds.limit(link.SkuId) {
+		s.Missing = append(s.Missing, link)
+		retained[link.SkuId]++
+	}
+}
+
+// readLinkState compares the entitlements listed by Discord against discord_entitlements. The listed IDs are
+// loaded into a temporary table and diffed with joins in the database, so that the comparison is consistent with
+// the transaction. Temporary tables cannot be created in a read-only transaction, in which case the table is paged
+// through instead.
+func (d *Daemon) readLinkState(
+	ctx context.Context,
+	tx pgx.Tx,
+	activeEntitlements []entitlement.Entitlement,
+	thresholds removalThresholds,
+	readOnly bool,
+) (linkState, error) {
+	if readOnly {
+		return d.scanLinkState(ctx, tx, activeEntitlements, thresholds)
+	}
+
+	return d.diffLinkState(ctx, tx, activeEntitlements, thresholds)
+}
+
+func (d *Daemon) diffLinkState(ctx context.Context, tx pgx.Tx, activeEntitlements []entitlement.Entitlement, thresholds removalThresholds) (linkState, error) {
+	if _, err := tx.Exec(ctx, createStagedEntitlementsQuery); err != nil {
+		return linkState{}, err
+	}
+
+	staged := collections.NewSet[uint64]()
+	rows := make([][]any, 0, len(activeEntitlements))
+	for _, entitlement := range activeEntitlements {
+		if staged.Contains(entitlement.Id) {
+			continue
+		}
+
+		staged.Add(entitlement.Id)
+		rows = append(rows, []any{entitlement.Id})
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"staged_entitlements"}, []string{"discord_id"}, pgx.CopyFromRows(rows)); err != nil {
+		return linkState{}, err
+	}
+
+	if _, err := tx.Exec(ctx, "ANALYZE staged_entitlements;"); err != nil {
+		return linkState{}, err
+	}
+
+	state := linkState{
+		Linked:       make(map[uint64]uuid.UUID),
+		MissingBySku: make(map[uuid.UUID]int),
+	}
+
+	linkedRows, err := tx.Query(ctx, listStagedLinksQuery)
+	if err != nil {
+		return linkState{}, err
+	}
+
+	for linkedRows.Next() {
+		var link link
+		if err := linkedRows.Scan(&link.DiscordId, &link.EntitlementId); err != nil {
+			linkedRows.Close()
+			return linkState{}, err
+		}
+
+		state.Linked[link.DiscordId] = link.EntitlementId
+	}
+
+	linkedRows.Close()
+	if err := linkedRows.Err(); err != nil {
+		return linkState{}, err
+	}
+
+	// Entitlements outside the scope are not listed by a scoped run, so their absence means nothing
+	if _, ok := runScopeFromContext(ctx); ok {
+		return state, nil
+	}
+
+	if d.scanMissingOnReplica(ctx, activeEntitlements, thresholds, &state) {
+		return state, nil
+	}
+
+	// Fetch one row per SKU even if the threshold is 0, so that the total counts are still reported
+	missingRows, err := d.queryUnstagedLinks(ctx, tx, max(thresholds.maxLimit(), 1))
+	if err != nil {
+		return linkState{}, err
+	}
+
+	defer missingRows.Close()
+
+	retained := make(map[uuid.UUID]int)
+	for missingRows.Next() {
+		var (
+			link     missingLink
+			skuTotal int
+		)
+
+		if err := missingRows.Scan(&link.DiscordId, &link.EntitlementId, &link.SkuId, &state.MissingCount, &skuTotal); err != nil {
+			return linkState{}, err
+		}
+
+		state.MissingBySku[link.SkuId] = skuTotal
+		state.retainMissing(link, thresholds, retained)
+	}
+
+	if err := missingRows.Err(); err != nil {
+		return linkState{}, err
+	}
+
+	return state, nil
+}
+
+// scanLinkState pages through discord_entitlements, so that only links relevant to the run are held in memory
+// rather than the entire table
+func (d *Daemon) scanLinkState(ctx context.Context, tx pgx.Tx, activeEntitlements []entitlement.Entitlement, thresholds removalThresholds) (linkState, error) {
+	active := collections.NewSet[uint64]()
+	for _, entitlement := range activeEntitlements {
+		active.Add(entitlement.Id)
+	}
+
+	state := linkState{
+		Linked:       make(map[uint64]uuid.UUID),
+		MissingBySku: make(map[uuid.UUID]int),
+	}
+
+	_, scoped := runScopeFromContext(ctx)
+
+	retained := make(map[uuid.UUID]int)
+	err := d.forEachLink(ctx, tx, func(link missingLink) {
+		if !d.inShard(link.DiscordId) {
+			return
+		}
+
+		if active.Contains(link.DiscordId) {
+			state.Linked[link.DiscordId] = link.EntitlementId
+			return
+		}
+
+		if scoped {
+			return
+		}
+
+		state.MissingCount++
+		state.MissingBySku[link.SkuId]++
+		state.retainMissing(link, thresholds, retained)
+	})
+	if err != nil {
+		return linkState{}, err
+	}
+
+	return state, nil
+}
+
+// forEachLink calls fn for every row in discord_entitlements that belongs to the application, along with the SKU of
+// the linked entitlement, fetching linkPageSize rows at a time in order of Discord ID
+func (d *Daemon) forEachLink(ctx context.Context, tx pgx.Tx, fn func(missingLink)) error {
+	var after uint64
+	for {
+		rows, err := d.queryLinksPage(ctx, tx, after)
+		if err != nil {
+			return err
+		}
+
+		var count int
+		for rows.Next() {
+			var link missingLink
+			if err := rows.Scan(&link.DiscordId, &link.EntitlementId, &link.SkuId); err != nil {
+				rows.Close()
+				return err
+			}
+
+			fn(link)
+			after = link.DiscordId
+			count++
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if count < linkPageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// skuChangesChannel is the channel notified by the trigger on discord_store_skus, with the Discord SKU ID as the
+// payload
+const skuChangesChannel = "discord_store_skus_changed"
+
+// skuListenerRetryDelay is how long to wait before reconnecting after the listener connection fails
+const skuListenerRetryDelay = 5 * time.Second
+
+// listenSkuChanges listens for changes to discord_store_skus until ctx is cancelled. The SKU cache is dropped on
+// every change, and if a SKU that the last run could not resolve has been mapped, a run is triggered immediately so
+// that its entitlements are granted without waiting for RUN_FREQUENCY.
+func (d *Daemon) listenSkuChanges(ctx context.Context) {
+	for {
+		listenCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-d.skuListenerReset:
+				cancel()
+			case <-listenCtx.Done():
+			}
+		}()
+
+		err := d.listenSkuChangesOnce(listenCtx)
+		reset := listenCtx.Err() != nil
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if reset {
+			d.logger.Info("Database changed, reconnecting SKU listener")
+			continue
+		}
+
+		d.logger.Warn("SKU listener disconnected, reconnecting", zap.Duration("delay", skuListenerRetryDelay), zap.Error(err))
+
+		timer := time.NewTimer(skuListenerRetryDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// listenSkuChangesOnce opens a dedicated connection to the current database and handles notifications until the
+// connection fails or ctx is cancelled. A dedicated connection is used rather than one from the pool, as a pooled
+// connection would prevent the pool from being closed on cutover.
+func (d *Daemon) listenSkuChangesOnce(ctx context.Context) error {
+	connConfig := d.db().pool.Config().ConnConfig.Copy()
+
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+skuChangesChannel); err != nil {
+		return err
+	}
+
+	d.logger.Info("Listening for SKU changes")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		d.skuCache.invalidate()
+
+		skuId, err := strconv.ParseUint(notification.Payload, 10, 64)
+		if err != nil {
+			d.logger.Warn("Received invalid SKU change notification", zap.String("payload", notification.Payload))
+			continue
+		}
+
+		if !d.unknownSkus.has(skuId) {
+			d.logger.Debug("SKU mapping changed, invalidated SKU cache", zap.Uint64("sku_id", skuId))
+			continue
+		}
+
+		d.logger.Info("Previously unknown SKU has been mapped, triggering run", zap.Uint64("sku_id", skuId))
+		d.Trigger()
+	}
+}
+
+// resetSkuListener makes the SKU listener reconnect, e.g. after switching to a different database
+func (d *Daemon) resetSkuListener() {
+	if !d.config.SkuListener.Enabled {
+		return
+	}
+
+	select {
+	case d.skuListenerReset <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// sampleMemStats reads the runtime memory statistics at the start of a run. The returned function samples them
+// again at the end of the run, and exports the difference.
+func (d *Daemon) sampleMemStats() func() {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	return func() {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+
+		allocated := after.TotalAlloc - before.TotalAlloc
+		gcCycles := after.NumGC - before.NumGC
+		gcPause := time.Duration(after.PauseTotalNs - before.PauseTotalNs)
+
+		metrics.RunAllocatedBytes.WithLabelValues(d.applicationLabel).Set(float64(allocated))
+		metrics.RunHeapBytes.WithLabelValues(d.applicationLabel).Set(float64(after.HeapAlloc))
+		metrics.RunHeapSysBytes.WithLabelValues(d.applicationLabel).Set(float64(after.HeapSys))
+		metrics.RunGcCycles.WithLabelValues(d.applicationLabel).Set(float64(gcCycles))
+		metrics.RunGcPauseSeconds.WithLabelValues(d.applicationLabel).Set(gcPause.Seconds())
+
+		d.logger.Debug(
+			"Run memory usage",
+			zap.Uint64("allocated_bytes", allocated),
+			zap.Uint64("heap_bytes", after.HeapAlloc),
+			zap.Uint64("heap_sys_bytes", after.HeapSys),
+			zap.Uint32("gc_cycles", gcCycles),
+			zap.Duration("gc_pause", gcPause),
+		)
+	}
+}
@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/notify"
+	"go.uber.org/zap"
+)
+
+// newNotifier creates a Notifier for the configured chat services, or returns nil if there are none
+func newNotifier(config config.Config) notify.Notifier {
+	var notifiers notify.Multi
+	if len(config.Slack.WebhookUrl) > 0 {
+		notifiers = append(notifiers, notify.WithMinSeverity(notify.NewSlack(config.Slack.WebhookUrl), config.Slack.MinSeverity))
+	}
+
+	if len(config.Teams.WebhookUrl) > 0 {
+		notifiers = append(notifiers, notify.WithMinSeverity(notify.NewTeams(config.Teams.WebhookUrl), config.Teams.MinSeverity))
+	}
+
+	if len(config.NotifyWebhook.Url) > 0 {
+		notifiers = append(notifiers, notify.WithMinSeverity(notify.NewWebhook(config.NotifyWebhook.Url), config.NotifyWebhook.MinSeverity))
+	}
+
+	if len(notifiers) == 0 {
+		return nil
+	}
+
+	return notifiers
+}
+
+// notifyRun sends a summary of the run, if it failed, needs attention or applied changes
+func (d *Daemon) notifyRun(summary RunSummary) {
+	notification, ok := runNotification(summary)
+	if !ok {
+		return
+	}
+
+	d.notify(notification)
+}
+
+// notify sends the notification in the background, if any notifiers are configured
+func (d *Daemon) notify(notification notify.Notification) {
+	if d.notifier == nil {
+		return
+	}
+
+	d.notifyWg.Add(1)
+	go func() {
+		defer d.notifyWg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+		defer cancel()
+
+		if err := d.notifier.Notify(ctx, notification); err != nil {
+			d.logger.Warn("Failed to send notification", zap.Error(err))
+		}
+	}()
+}
+
+// FlushNotifications waits for notifications that are still being sent, so that they are not lost on exit
+func (d *Daemon) FlushNotifications() {
+	d.notifyWg.Wait()
+}
+
+func runNotification(summary RunSummary) (notify.Notification, bool) {
+	notification := notify.Notification{
+		Fields: []notify.Field{
+			{Name: "Run ID", Value: summary.RunId.String()},
+			{Name: "Duration", Value: summary.Duration.Round(time.Millisecond).String()},
+			{Name: "Created", Value: strconv.Itoa(summary.Creations)},
+			{Name: "Refreshed", Value: strconv.Itoa(summary.Refreshes)},
+			{Name: "Deleted", Value: strconv.Itoa(summary.Deletions + summary.MissingDeletions)},
+		},
+	}
+
+	var warnings []string
+	if summary.ReadOnly {
+		warnings = append(warnings, "The database was read-only, so no changes were applied.")
+	}
+
+	if summary.QuarantinedDeletions > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d deletions were quarantined and need approval.", summary.QuarantinedDeletions))
+	}
+
+	// Unknown SKUs are notified separately by escalateUnknownSkus once they persist, so that every run is not
+	// reported while a new SKU is being set up
+
+	switch {
+	case len(summary.Error) > 0:
+		notification.Severity = notify.SeverityError
+		notification.Title = "Entitlement sync failed"
+		notification.Text = fmt.Sprintf("%s: %s", summary.ErrorClass, summary.Error)
+	case summary.BlockedDeletions > 0:
+		notification.Severity = notify.SeverityError
+		notification.Title = "Removal threshold exceeded"
+		notification.Text = fmt.Sprintf("%d entitlements are no longer listed by Discord, but were not deleted.", summary.BlockedDeletions)
+	case len(warnings) > 0:
+		notification.Severity = notify.SeverityWarning
+		notification.Title = "Entitlement sync needs attention"
+		notification.Text = strings.Join(warnings, "\n")
+	case summary.Creations > 0 || summary.Deletions > 0 || summary.MissingDeletions > 0:
+		notification.Severity = notify.SeverityInfo
+		notification.Title = "Entitlement sync applied changes"
+	default:
+		return notify.Notification{}, false
+	}
+
+	return notification, true
+}
@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/logging"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot-cloud/gdl/rest/ratelimit"
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+)
+
+// accessTokenRefreshMargin is how long before it expires that an access token is replaced, so that it does not
+// expire part way through a run
+const accessTokenRefreshMargin = time.Minute * 10
+
+// clientCredentials obtains access tokens with the OAuth2 client credentials grant, for when DISCORD_CLIENT_SECRET is
+// set. The token is cached until it is close to expiring.
+type clientCredentials struct {
+	clientId     uint64
+	clientSecret string
+	scope        string
+	redactor     *logging.Redactor
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type clientCredentialsBody struct {
+	GrantType string `qs:"grant_type"`
+	Scope     string `qs:"scope"`
+}
+
+func newClientCredentials(config config.Config, redactor *logging.Redactor) *clientCredentials {
+	if len(config.Discord.ClientSecret) == 0 {
+		return nil
+	}
+
+	clientId := config.Discord.ClientId
+	if clientId == 0 {
+		clientId = config.Discord.ApplicationId
+	}
+
+	return &clientCredentials{
+		clientId:     clientId,
+		clientSecret: config.Discord.ClientSecret,
+		scope:        config.Discord.OauthScope,
+		redactor:     redactor,
+	}
+}
+
+// get returns the Authorization header for the current access token, exchanging the client credentials for a new
+// token if there is none, or it is about to expire
+func (c *clientCredentials) get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.token) > 0 && time.Until(c.expiresAt) > accessTokenRefreshMargin {
+		return "Bearer " + c.token, nil
+	}
+
+	endpoint := request.Endpoint{
+		RequestType: request.POST,
+		ContentType: request.ApplicationFormUrlEncoded,
+		Endpoint:    "/oauth2/token",
+		Route:       ratelimit.NewOtherRoute(ratelimit.RouteOauth2TokenExchange, c.clientId),
+	}
+
+	body := clientCredentialsBody{
+		GrantType: "client_credentials",
+		Scope:     c.scope,
+	}
+
+	header := "Basic " + base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.clientId, c.clientSecret)))
+
+	var res rest.TokenExchangeResponse
+	if err, _ := endpoint.Request(ctx, header, body, &res); err != nil {
+		return "", fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	c.redactor.AddSecret(res.AccessToken)
+	c.token = res.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+
+	return "Bearer " + c.token, nil
+}
+
+// authorization returns the credential to authenticate requests to Discord with: an OAuth2 access token if
+// DISCORD_CLIENT_SECRET is set, otherwise the bot token
+func (d *Daemon) authorization(ctx context.Context) (string, error) {
+	if d.clientCredentials != nil {
+		return d.clientCredentials.get(ctx)
+	}
+
+	return d.token.get(), nil
+}
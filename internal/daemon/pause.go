@@ -0,0 +1,37 @@
+package daemon
+
+import (
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// SetDeletionsPaused pauses or resumes deletions. While paused, runs still apply creations and refreshes, but the
+// deletions they would make are logged and left for a run after deletions are resumed, e.g. during a Discord API
+// incident in which entitlement listings are known to be incomplete.
+func (d *Daemon) SetDeletionsPaused(paused bool) {
+	if d.deletionsPaused.Swap(paused) != paused {
+		d.logger.Info("Changed whether deletions are paused", zap.Bool("paused", paused))
+	}
+}
+
+func (d *Daemon) DeletionsPaused() bool {
+	return d.deletionsPaused.Load()
+}
+
+// pauseDeletions removes the deletions from the plan if deletions are paused, logging each one instead
+func (d *Daemon) pauseDeletions(p plan) plan {
+	if !d.DeletionsPaused() {
+		return p
+	}
+
+	for _, deletion := range slices.Concat(p.Deletions, p.MissingDeletions) {
+		d.logger.Info("Not deleting entitlement as deletions are paused", append(d.deletionFields(deletion), zap.String("entitlement_id", deletion.EntitlementId.String()))...)
+	}
+
+	p.PausedDeletions = len(p.Deletions) + len(p.MissingDeletions)
+	p.Deletions = nil
+	p.MissingDeletions = nil
+
+	return p
+}
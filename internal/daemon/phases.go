@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	phaseFetch         = "fetch"
+	phaseSkuResolution = "sku_resolution"
+	phaseDeletionScan  = "deletion_scan"
+	phaseReconcile     = "reconcile"
+	phaseCommit        = "commit"
+)
+
+// phaseTimings accumulates the time spent in each phase of a run. Phases that are retried are counted once per
+// attempt.
+type phaseTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+	// current is the phase most recently started
+	current string
+}
+
+type phaseTimingsKey struct{}
+
+func withPhaseTimings(ctx context.Context) (context.Context, *phaseTimings) {
+	timings := &phaseTimings{
+		durations: make(map[string]time.Duration),
+	}
+
+	return context.WithValue(ctx, phaseTimingsKey{}, timings), timings
+}
+
+// timePhase starts timing a phase of the run that ctx belongs to, returning a function that must be called when the
+// phase ends
+func (d *Daemon) timePhase(ctx context.Context, phase string) func() {
+	start := time.Now()
+
+	if timings, ok := ctx.Value(phaseTimingsKey{}).(*phaseTimings); ok {
+		timings.mu.Lock()
+		timings.current = phase
+		timings.mu.Unlock()
+	}
+
+	return func() {
+		duration := time.Since(start)
+		metrics.PhaseDuration.WithLabelValues(d.applicationLabel, phase).Observe(duration.Seconds())
+
+		if timings, ok := ctx.Value(phaseTimingsKey{}).(*phaseTimings); ok {
+			timings.mu.Lock()
+			timings.durations[phase] += duration
+			timings.mu.Unlock()
+		}
+	}
+}
+
+// lastPhase returns the phase most recently started, or an empty string if none have been
+func (t *phaseTimings) lastPhase() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.current
+}
+
+func (t *phaseTimings) fields() []zap.Field {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fields := make([]zap.Field, 0, len(t.durations))
+	for _, phase := range []string{phaseFetch, phaseSkuResolution, phaseDeletionScan, phaseReconcile, phaseCommit} {
+		if duration, ok := t.durations[phase]; ok {
+			fields = append(fields, zap.Duration(phase+"_duration", duration))
+		}
+	}
+
+	return fields
+}
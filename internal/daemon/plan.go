@@ -0,0 +1,239 @@
+package daemon
+
+import (
+	"slices"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// plan is the set of changes required to bring the database in line with the entitlements listed by Discord
+type plan struct {
+	Creations []plannedCreation
+	// Deletions of entitlements that Discord returned with the deleted flag set
+	Deletions []plannedDeletion
+	// MissingDeletions are deletions of entitlements that Discord no longer lists (e.g. test entitlements)
+	MissingDeletions []plannedDeletion
+	// BlockedDeletions is the number of missing entitlement deletions withheld by MAX_REMOVALS_THRESHOLD
+	BlockedDeletions int
+	// DeferredDeletions is the number of missing entitlement deletions left for later runs by MAX_DELETIONS_PER_RUN
+	DeferredDeletions int
+	// Pending are deletions withheld until DELETION_GRACE_PERIOD has elapsed
+	Pending []plannedDeletion
+	// IgnoredDeletions is the number of deletions not planned because of an ignore policy
+	IgnoredDeletions int
+	// PausedDeletions is the number of deletions not applied because deletions are paused, see DELETIONS_PAUSED
+	PausedDeletions int
+	// Quarantined are deletions withheld until they are approved, see DELETION_QUARANTINE_ENABLED
+	Quarantined []plannedDeletion
+	// UnknownSkus are the Discord SKUs of listed entitlements that are not mapped in discord_store_skus
+	UnknownSkus []uint64
+	// Skipped is the number of listed entitlements that were not synced, by reason
+	Skipped map[SkipReason]int
+	// Ownerless are listed entitlements with neither a guild nor a user, see OWNERLESS_ENTITLEMENT_POLICY
+	Ownerless []plannedCreation
+	// TargetMismatches are the Discord IDs of entitlements that lack the ID their SKU targets, and so are stored
+	// with both IDs as listed
+	TargetMismatches []uint64
+	// DuplicateIds are the Discord IDs that were listed more than once
+	DuplicateIds []uint64
+	// Suppressed are guild entitlements not synced because the guild holds a higher tier, see SKU_PRECEDENCE
+	Suppressed []suppressedCreation
+}
+
+type plannedCreation struct {
+	Entitlement entitlement.Entitlement
+	Sku         model.Sku
+	// GuildId and UserId are the owners to store, which depend on whether the SKU targets a guild or a user
+	GuildId *uint64
+	UserId  *uint64
+	// Linked is true if the entitlement already exists, in which case it is upserted to refresh its expiry
+	Linked bool
+	// EntitlementId is the ID of the existing entitlement, if Linked
+	EntitlementId uuid.UUID
+}
+
+type plannedDeletion struct {
+	DiscordId     uint64
+	EntitlementId uuid.UUID
+	// SkuId is the internal SKU of the entitlement, if known. It is the zero UUID for missing entitlements whose row no
+	// longer exists.
+	SkuId uuid.UUID
+	// Entitlement is the entitlement as listed by Discord, only known for entitlements that Discord flagged as deleted
+	Entitlement *entitlement.Entitlement
+}
+
+func (d *Daemon) computePlan(
+	activeEntitlements []entitlement.Entitlement,
+	skus map[uint64]model.Sku,
+	targets map[uint64]skuTarget,
+	links linkState,
+	thresholds removalThresholds,
+) plan {
+	p := plan{
+		Skipped: make(map[SkipReason]int),
+	}
+
+	now := time.Now()
+	seen := make(map[uint64]struct{}, len(activeEntitlements))
+	for _, entitlement := range activeEntitlements {
+		if _, ok := seen[entitlement.Id]; ok {
+			p.DuplicateIds = append(p.DuplicateIds, entitlement.Id)
+		}
+
+		seen[entitlement.Id] = struct{}{}
+
+		sku, ok := skus[entitlement.SkuId]
+		if !ok {
+			d.logger.Debug("Skipping unknown SKU", d.entitlementFields(entitlement)...)
+			if !slices.Contains(p.UnknownSkus, entitlement.SkuId) {
+				p.UnknownSkus = append(p.UnknownSkus, entitlement.SkuId)
+			}
+
+			p.Skipped[SkipReasonUnknownSku]++
+			continue
+		}
+
+		entitlementId, linked := links.Linked[entitlement.Id]
+
+		if entitlement.Deleted {
+			if linked && (d.config.DeletedEntitlementPolicy == config.DeletionPolicyIgnore || d.config.Bootstrap) {
+				p.IgnoredDeletions++
+			} else if linked {
+				p.Deletions = append(p.Deletions, plannedDeletion{
+					DiscordId:     entitlement.Id,
+					EntitlementId: entitlementId,
+					SkuId:         sku.Id,
+					Entitlement:   &entitlement,
+				})
+			}
+
+			continue
+		}
+
+		if reason, skip := d.skipReason(entitlement, now); skip {
+			d.logger.Debug("Skipping entitlement", append(d.entitlementFields(entitlement), zap.String("reason", string(reason)))...)
+			p.Skipped[reason]++
+			continue
+		}
+
+		if !hasOwner(entitlement) {
+			d.logger.Warn("Entitlement has neither a guild nor a user, skipping", d.entitlementFields(entitlement)...)
+			p.Skipped[SkipReasonNoOwner]++
+			p.Ownerless = append(p.Ownerless, plannedCreation{Entitlement: entitlement, Sku: sku})
+			continue
+		}
+
+		target := targets[entitlement.SkuId]
+		if !target.matches(entitlement) {
+			p.TargetMismatches = append(p.TargetMismatches, entitlement.Id)
+		}
+
+		guildId, userId := target.apply(entitlement)
+		p.Creations = append(p.Creations, plannedCreation{
+			Entitlement:   entitlement,
+			Sku:           sku,
+			GuildId:       guildId,
+			UserId:        userId,
+			Linked:        linked,
+			EntitlementId: entitlementId,
+		})
+	}
+
+	// A backfill file may only cover part of the history, so the absence of an entitlement from it is not a removal
+	if d.config.MissingEntitlementPolicy == config.DeletionPolicyIgnore || len(d.config.BackfillFile) > 0 || d.config.Bootstrap {
+		p.IgnoredDeletions += links.MissingCount
+	} else {
+		blocked := d.blockedRemovals(&p, links, thresholds)
+
+		var missing []missingLink
+		for _, link := range links.Missing {
+			if !blocked(link.SkuId) {
+				missing = append(missing, link)
+			}
+		}
+
+		// Drain large numbers of deletions gradually across runs, rather than all at once
+		if limit := d.config.MaxDeletionsPerRun; limit > 0 && len(missing) > limit {
+			d.logger.Info("MAX_DELETIONS_PER_RUN reached, deferring remaining deletions", zap.Int("count", len(missing)), zap.Int("limit", limit))
+			p.DeferredDeletions = len(missing) - limit
+			missing = missing[:limit]
+		}
+
+		for _, link := range missing {
+			p.MissingDeletions = append(p.MissingDeletions, plannedDeletion{
+				DiscordId:     link.DiscordId,
+				EntitlementId: link.EntitlementId,
+				SkuId:         link.SkuId,
+			})
+		}
+	}
+
+	return p
+}
+
+// partition is the subset of a plan's changes that affect a single internal SKU
+type partition struct {
+	Creations []plannedCreation
+	Deletions []plannedDeletion
+}
+
+// partitionBySku groups the creations and flagged deletions by internal SKU. Entitlements are unique per guild,
+// user and SKU, so changes in different partitions never touch the same rows and can be applied concurrently.
+// Missing deletions are not included, as the SKU of a missing entitlement is not known without another lookup.
+func (p plan) partitionBySku() map[uuid.UUID]*partition {
+	partitions := make(map[uuid.UUID]*partition)
+	get := func(skuId uuid.UUID) *partition {
+		part, ok := partitions[skuId]
+		if !ok {
+			part = &partition{}
+			partitions[skuId] = part
+		}
+
+		return part
+	}
+
+	for _, deletion := range p.Deletions {
+		part := get(deletion.SkuId)
+		part.Deletions = append(part.Deletions, deletion)
+	}
+
+	for _, creation := range p.Creations {
+		part := get(creation.Sku.Id)
+		part.Creations = append(part.Creations, creation)
+	}
+
+	return partitions
+}
+
+// NewCreations returns the number of creations for entitlements that do not yet exist in the database
+func (p plan) NewCreations() int {
+	var count int
+	for _, creation := range p.Creations {
+		if !creation.Linked {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (p plan) driftFields() []zap.Field {
+	return []zap.Field{
+		zap.Int("creations", p.NewCreations()),
+		zap.Int("refreshes", len(p.Creations)-p.NewCreations()),
+		zap.Int("deletions", len(p.Deletions)),
+		zap.Int("missing_deletions", len(p.MissingDeletions)),
+		zap.Int("blocked_deletions", p.BlockedDeletions),
+		zap.Int("deferred_deletions", p.DeferredDeletions),
+		zap.Int("pending_deletions", len(p.Pending)),
+		zap.Int("ignored_deletions", p.IgnoredDeletions),
+		zap.Int("paused_deletions", p.PausedDeletions),
+		zap.Int("quarantined_deletions", len(p.Quarantined)),
+		zap.Any("skipped", p.Skipped),
+	}
+}
@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/planfile"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPlanFilesDisabled = errors.New("PLAN_SIGNING_KEY is not set")
+	ErrPlanNotApplicable = errors.New("plan cannot be applied while the run is a dry run or the database is read-only")
+)
+
+// PlanDriftError is returned when the changes computed when applying a plan file differ from those in the file,
+// because the entitlements listed by Discord or the database have changed since the plan was written
+type PlanDriftError struct {
+	Planned planfile.Changes
+	Current planfile.Changes
+}
+
+func (e *PlanDriftError) Error() string {
+	return fmt.Sprintf(
+		"changes have drifted since the plan was written: planned %d creations, %d deletions and %d missing deletions, now %d, %d and %d",
+		len(e.Planned.Creations), len(e.Planned.Deletions), len(e.Planned.MissingDeletions),
+		len(e.Current.Creations), len(e.Current.Deletions), len(e.Current.MissingDeletions),
+	)
+}
+
+// planMode makes a run write its changes to Captured without applying them, or, if Expected is set, only apply its
+// changes if they match Expected
+type planMode struct {
+	Captured *planfile.Changes
+	Expected *planfile.Changes
+}
+
+type planModeKey struct{}
+
+func withPlanMode(ctx context.Context, mode planMode) context.Context {
+	return context.WithValue(ctx, planModeKey{}, mode)
+}
+
+func planModeFromContext(ctx context.Context) (planMode, bool) {
+	mode, ok := ctx.Value(planModeKey{}).(planMode)
+	return mode, ok
+}
+
+// Plan performs a run that computes the changes required without applying them, and returns them as a signed plan
+// file, to be reviewed and then applied with ApplyPlanFile
+func (d *Daemon) Plan(ctx context.Context) (planfile.File, error) {
+	if len(d.config.PlanFile.SigningKey) == 0 {
+		return planfile.File{}, ErrPlanFilesDisabled
+	}
+
+	var changes planfile.Changes
+	if err := d.enqueueRun(withPlanMode(ctx, planMode{Captured: &changes}), false, runPriorityRequested); err != nil {
+		return planfile.File{}, err
+	}
+
+	file := planfile.File{
+		Version:       planfile.Version,
+		ApplicationId: d.config.Discord.ApplicationId,
+		CreatedAt:     time.Now().UTC(),
+		Changes:       changes,
+	}
+
+	if err := file.Sign([]byte(d.config.PlanFile.SigningKey)); err != nil {
+		return planfile.File{}, err
+	}
+
+	return file, nil
+}
+
+// ApplyPlanFile performs a run that applies the changes in a plan file written by Plan. The changes are recomputed,
+// and if they differ from those in the file, nothing is applied and a PlanDriftError is returned.
+func (d *Daemon) ApplyPlanFile(ctx context.Context, file planfile.File) error {
+	if len(d.config.PlanFile.SigningKey) == 0 {
+		return ErrPlanFilesDisabled
+	}
+
+	if err := file.Verify([]byte(d.config.PlanFile.SigningKey)); err != nil {
+		return err
+	}
+
+	if file.Version != planfile.Version {
+		return fmt.Errorf("unsupported plan file version %d", file.Version)
+	}
+
+	if file.ApplicationId != d.config.Discord.ApplicationId {
+		return fmt.Errorf("plan file was written for application %d", file.ApplicationId)
+	}
+
+	d.logger.Info(
+		"Applying plan file",
+		zap.Time("created_at", file.CreatedAt),
+		zap.Int("creations", len(file.Changes.Creations)),
+		zap.Int("deletions", len(file.Changes.Deletions)+len(file.Changes.MissingDeletions)),
+	)
+
+	return d.enqueueRun(withPlanMode(ctx, planMode{Expected: &file.Changes}), false, runPriorityRequested)
+}
+
+// checkPlanMode handles a run in plan mode once its plan has been computed, returning true if the run should stop
+// without applying the plan
+func (d *Daemon) checkPlanMode(ctx context.Context, p plan, dryRun, readOnly bool) (bool, error) {
+	mode, ok := planModeFromContext(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	changes := p.fileChanges()
+	if mode.Expected == nil {
+		*mode.Captured = changes
+		d.logger.Info("Plan computed, not applying changes", p.driftFields()...)
+		return true, nil
+	}
+
+	if !mode.Expected.Equal(changes) {
+		err := &PlanDriftError{Planned: *mode.Expected, Current: changes}
+		d.logger.Error("Plan file has drifted, not applying changes", zap.Error(err))
+		return true, err
+	}
+
+	if dryRun || readOnly {
+		return true, ErrPlanNotApplicable
+	}
+
+	return false, nil
+}
+
+// fileChanges returns the writes of the plan in the format of a plan file
+func (p plan) fileChanges() planfile.Changes {
+	changes := planfile.Changes{
+		Creations:        make([]planfile.Creation, len(p.Creations)),
+		Deletions:        fileDeletions(p.Deletions),
+		MissingDeletions: fileDeletions(p.MissingDeletions),
+	}
+
+	for i, creation := range p.Creations {
+		changes.Creations[i] = planfile.Creation{
+			DiscordId: creation.Entitlement.Id,
+			GuildId:   creation.GuildId,
+			UserId:    creation.UserId,
+			SkuId:     creation.Sku.Id,
+			SkuLabel:  creation.Sku.Label,
+		}
+
+		if creation.Entitlement.EndsAt != nil {
+			expiresAt := creation.Entitlement.EndsAt.UTC()
+			changes.Creations[i].ExpiresAt = &expiresAt
+		}
+
+		if creation.Linked {
+			entitlementId := creation.EntitlementId
+			changes.Creations[i].EntitlementId = &entitlementId
+		}
+	}
+
+	slices.SortFunc(changes.Creations, func(a, b planfile.Creation) int {
+		return cmp.Compare(a.DiscordId, b.DiscordId)
+	})
+
+	return changes
+}
+
+func fileDeletions(deletions []plannedDeletion) []planfile.Deletion {
+	res := make([]planfile.Deletion, len(deletions))
+	for i, deletion := range deletions {
+		res[i] = planfile.Deletion{
+			DiscordId:     deletion.DiscordId,
+			EntitlementId: deletion.EntitlementId,
+		}
+	}
+
+	slices.SortFunc(res, func(a, b planfile.Deletion) int {
+		return cmp.Compare(a.DiscordId, b.DiscordId)
+	})
+
+	return res
+}
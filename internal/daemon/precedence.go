@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"slices"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/upsert_suppressions.sql
+	upsertSuppressionsQuery string
+
+	//go:embed sql/prune_suppressions.sql
+	pruneSuppressionsQuery string
+)
+
+// suppressedCreation is a guild entitlement that is not granted because the guild holds an entitlement for a SKU
+// that takes precedence over it, see SKU_PRECEDENCE
+type suppressedCreation struct {
+	plannedCreation
+	// SuppressedBy is the Discord ID of the entitlement that takes precedence
+	SuppressedBy uint64
+}
+
+// applySkuPrecedence removes the creations of guild entitlements whose SKU is ranked below that of another entitlement
+// of the same guild in SKU_PRECEDENCE, so that each guild is only granted its highest tier. Existing entitlements
+// that are suppressed are deleted, so that the guild falls back to them if its higher tier ends. Entitlements of SKUs
+// that are not listed are not affected.
+func (d *Daemon) applySkuPrecedence(p *plan) {
+	if len(d.config.SkuPrecedence) == 0 {
+		return
+	}
+
+	rank := func(creation plannedCreation) (int, bool) {
+		if creation.GuildId == nil {
+			return 0, false
+		}
+
+		i := slices.Index(d.config.SkuPrecedence, creation.Entitlement.SkuId)
+		return i, i >= 0
+	}
+
+	// The highest ranked creation of each guild, the lowest ID first if several share a rank
+	best := make(map[uint64]plannedCreation)
+	for _, creation := range p.Creations {
+		creationRank, ok := rank(creation)
+		if !ok {
+			continue
+		}
+
+		current, ok := best[*creation.GuildId]
+		if !ok {
+			best[*creation.GuildId] = creation
+			continue
+		}
+
+		currentRank, _ := rank(current)
+		if creationRank < currentRank || (creationRank == currentRank && creation.Entitlement.Id < current.Entitlement.Id) {
+			best[*creation.GuildId] = creation
+		}
+	}
+
+	creations := p.Creations[:0]
+	for _, creation := range p.Creations {
+		creationRank, ok := rank(creation)
+		if !ok {
+			creations = append(creations, creation)
+			continue
+		}
+
+		winner := best[*creation.GuildId]
+		if winnerRank, _ := rank(winner); creationRank == winnerRank {
+			creations = append(creations, creation)
+			continue
+		}
+
+		p.Suppressed = append(p.Suppressed, suppressedCreation{plannedCreation: creation, SuppressedBy: winner.Entitlement.Id})
+		p.Skipped[SkipReasonLowerTier]++
+
+		d.logger.Debug(
+			"Suppressing entitlement for lower tier SKU",
+			append(d.entitlementFields(creation.Entitlement), zap.Uint64("suppressed_by", winner.Entitlement.Id))...,
+		)
+
+		if creation.Linked {
+			entitlement := creation.Entitlement
+			p.Deletions = append(p.Deletions, plannedDeletion{
+				DiscordId:     entitlement.Id,
+				EntitlementId: creation.EntitlementId,
+				SkuId:         creation.Sku.Id,
+				Entitlement:   &entitlement,
+			})
+		}
+	}
+
+	p.Creations = creations
+}
+
+// syncSuppressions records the suppressed entitlements in the entitlement_suppressions table. A full run also
+// removes the entitlements that are no longer suppressed.
+func (d *Daemon) syncSuppressions(ctx context.Context, tx pgx.Tx, p plan) error {
+	if len(d.config.SkuPrecedence) == 0 {
+		return nil
+	}
+
+	discordIds := make([]uint64, len(p.Suppressed))
+	guildIds := make([]uint64, len(p.Suppressed))
+	skuIds := make([]uint64, len(p.Suppressed))
+	suppressedBy := make([]uint64, len(p.Suppressed))
+	for i, suppressed := range p.Suppressed {
+		discordIds[i] = suppressed.Entitlement.Id
+		guildIds[i] = *suppressed.GuildId
+		skuIds[i] = suppressed.Entitlement.SkuId
+		suppressedBy[i] = suppressed.SuppressedBy
+	}
+
+	if len(discordIds) > 0 {
+		if _, err := tx.Exec(ctx, upsertSuppressionsQuery, discordIds, guildIds, skuIds, suppressedBy, d.config.Discord.ApplicationId); err != nil {
+			return err
+		}
+	}
+
+	if _, scoped := runScopeFromContext(ctx); scoped {
+		return nil
+	}
+
+	// Only the application's own suppressions are pruned, as the others are not listed by this run. Rows recorded
+	// before suppressions were attributed to an application have an application_id of 0, and are pruned by any.
+	_, err := tx.Exec(ctx, pruneSuppressionsQuery, discordIds, d.config.Discord.ApplicationId)
+	return err
+}
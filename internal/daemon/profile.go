@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// profileSlowRun captures a CPU profile from the point at which the run reaches 50% of the timeout until it
+// finishes, and a heap profile at that point, writing both to PROFILE_DIR. The returned function must be called
+// when the run finishes.
+func (d *Daemon) profileSlowRun(ctx context.Context) func() {
+	if len(d.config.ProfileDir) == 0 {
+		return func() {}
+	}
+
+	runId, _ := RunIdFromContext(ctx)
+	prefix := filepath.Join(d.config.ProfileDir, fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), runId))
+
+	var (
+		mu      sync.Mutex
+		stopped bool
+		cpuFile *os.File
+	)
+
+	timer := time.AfterFunc(d.config.ExecutionTimeout/2, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			return
+		}
+
+		if err := writeHeapProfile(prefix + "-heap.pprof"); err != nil {
+			d.logger.Error("Failed to write heap profile", zap.Error(err))
+		}
+
+		f, err := os.Create(prefix + "-cpu.pprof")
+		if err != nil {
+			d.logger.Error("Failed to create CPU profile", zap.Error(err))
+			return
+		}
+
+		if err := pprof.StartCPUProfile(f); err != nil {
+			d.logger.Error("Failed to start CPU profile", zap.Error(err))
+			f.Close()
+			return
+		}
+
+		cpuFile = f
+		d.logger.Info("Run is slow, capturing profiles", zap.String("prefix", prefix))
+	})
+
+	return func() {
+		timer.Stop()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		stopped = true
+		if cpuFile == nil {
+			return
+		}
+
+		pprof.StopCPUProfile()
+		if err := cpuFile.Close(); err != nil {
+			d.logger.Error("Failed to write CPU profile", zap.Error(err))
+			return
+		}
+
+		d.logger.Info("Wrote profiles for slow run", zap.String("prefix", prefix))
+	}
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/purge_user_quarantine.sql
+	purgeUserQuarantineQuery string
+
+	//go:embed sql/purge_user_pending_deletions.sql
+	purgeUserPendingDeletionsQuery string
+
+	//go:embed sql/purge_user_entitlements.sql
+	purgeUserEntitlementsQuery string
+
+	//go:embed sql/record_user_purge.sql
+	recordUserPurgeQuery string
+
+	//go:embed sql/purge_user_undo_log.sql
+	purgeUserUndoLogQuery string
+
+	//go:embed sql/purge_user_entitlement_ids.sql
+	purgeUserEntitlementIdsQuery string
+
+	//go:embed sql/purge_user_renewals.sql
+	purgeUserRenewalsQuery string
+
+	//go:embed sql/list_user_purges.sql
+	listUserPurgesQuery string
+)
+
+var ErrPurgeDisabled = errors.New("user purge is not enabled")
+
+// PurgeUser deletes all the Discord entitlements of the user, along with their links and any quarantined or pending
+// deletions, returning the number of entitlements deleted. Entitlements from other sources are not affected. The purge
+// is recorded against a keyed hash of the user ID, rather than the ID itself, and entitlements of purged users are
+// skipped by later runs, so that they are not recreated.
+func (d *Daemon) PurgeUser(ctx context.Context, userId uint64) (int64, error) {
+	if !d.config.UserPurge.Enabled {
+		return 0, ErrPurgeDisabled
+	}
+
+	// Prevent a run from recreating the entitlements concurrently, and the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	tx, err := d.db().pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rollback(tx)
+
+	if d.config.DeletionQuarantine.Enabled {
+		if _, err := tx.Exec(ctx, purgeUserQuarantineQuery, userId, model.EntitlementSourceDiscord); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.gracePeriodEnabled() {
+		if _, err := tx.Exec(ctx, purgeUserPendingDeletionsQuery, userId, model.EntitlementSourceDiscord); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.config.UndoLog.Enabled {
+		if _, err := tx.Exec(ctx, purgeUserUndoLogQuery, userId, model.EntitlementSourceDiscord); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.config.RenewalEvents.Enabled {
+		if _, err := tx.Exec(ctx, purgeUserRenewalsQuery, userId); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.config.StableIds.Enabled {
+		if _, err := tx.Exec(ctx, purgeUserEntitlementIdsQuery, userId, model.EntitlementSourceDiscord); err != nil {
+			return 0, err
+		}
+	}
+
+	// Links and guild overrides are removed by cascade
+	tag, err := tx.Exec(ctx, purgeUserEntitlementsQuery, userId, model.EntitlementSourceDiscord)
+	if err != nil {
+		return 0, wrapDbError(err)
+	}
+
+	userHash := d.purgeHash(userId)
+	if _, err := tx.Exec(ctx, recordUserPurgeQuery, userHash, tag.RowsAffected()); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, wrapDbError(err)
+	}
+
+	if d.purgedUsers != nil {
+		d.purgedUsers[userHash] = struct{}{}
+	}
+
+	d.logger.Info("Purged user", zap.String("user_hash", userHash), zap.Int64("entitlements", tag.RowsAffected()))
+	return tag.RowsAffected(), nil
+}
+
+// loadPurgedUsers reads the hashes of the purged users, for skipReason to check entitlements against. It must be
+// called while holding runMu.
+func (d *Daemon) loadPurgedUsers(ctx context.Context, tx pgx.Tx) error {
+	if !d.config.UserPurge.Enabled {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, listUserPurgesQuery)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	purged := make(map[string]struct{})
+	for rows.Next() {
+		var userHash string
+		if err := rows.Scan(&userHash); err != nil {
+			return err
+		}
+
+		purged[userHash] = struct{}{}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	d.purgedUsers = purged
+	return nil
+}
+
+func (d *Daemon) isPurgedUser(userId uint64) bool {
+	if len(d.purgedUsers) == 0 {
+		return false
+	}
+
+	_, ok := d.purgedUsers[d.purgeHash(userId)]
+	return ok
+}
+
+func (d *Daemon) purgeHash(userId uint64) string {
+	mac := hmac.New(sha256.New, []byte(d.config.UserPurge.HashKey))
+	mac.Write([]byte(strconv.FormatUint(userId, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
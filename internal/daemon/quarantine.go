@@ -0,0 +1,193 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/list_approved_quarantine.sql
+	listApprovedQuarantineQuery string
+
+	//go:embed sql/list_quarantine.sql
+	listQuarantineQuery string
+
+	//go:embed sql/insert_quarantine.sql
+	insertQuarantineQuery string
+
+	//go:embed sql/clear_quarantine.sql
+	clearQuarantineQuery string
+
+	//go:embed sql/approve_quarantine.sql
+	approveQuarantineQuery string
+)
+
+var ErrQuarantineDisabled = errors.New("deletion quarantine is not enabled")
+
+// QuarantinedDeletion is a deletion withheld until it is approved
+type QuarantinedDeletion struct {
+	DiscordId     uint64
+	EntitlementId uuid.UUID
+	QuarantinedAt time.Time
+	ApprovedAt    *time.Time
+}
+
+// quarantineDeletions withholds the planned deletions that have not been approved, if there are more than
+// DELETION_QUARANTINE_THRESHOLD of them. Withheld deletions are moved to p.Quarantined, to be written to the
+// quarantine table by syncQuarantine.
+func (d *Daemon) quarantineDeletions(ctx context.Context, tx pgx.Tx, p *plan) error {
+	if !d.config.DeletionQuarantine.Enabled {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, listApprovedQuarantineQuery)
+	if err != nil {
+		return err
+	}
+
+	approved := make(map[uint64]uuid.UUID)
+	for rows.Next() {
+		var link link
+		if err := rows.Scan(&link.DiscordId, &link.EntitlementId); err != nil {
+			rows.Close()
+			return err
+		}
+
+		approved[link.DiscordId] = link.EntitlementId
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	isApproved := func(deletion plannedDeletion) bool {
+		entitlementId, ok := approved[deletion.DiscordId]
+		return ok && entitlementId == deletion.EntitlementId
+	}
+
+	var unapproved int
+	for _, deletions := range [][]plannedDeletion{p.Deletions, p.MissingDeletions} {
+		for _, deletion := range deletions {
+			if !isApproved(deletion) {
+				unapproved++
+			}
+		}
+	}
+
+	if unapproved <= d.config.DeletionQuarantine.Threshold {
+		return nil
+	}
+
+	split := func(deletions []plannedDeletion) []plannedDeletion {
+		var kept []plannedDeletion
+		for _, deletion := range deletions {
+			if isApproved(deletion) {
+				kept = append(kept, deletion)
+			} else {
+				p.Quarantined = append(p.Quarantined, deletion)
+			}
+		}
+
+		return kept
+	}
+
+	p.Deletions = split(p.Deletions)
+	p.MissingDeletions = split(p.MissingDeletions)
+
+	d.logger.Warn(
+		"DELETION_QUARANTINE_THRESHOLD exceeded, quarantining deletions until approved",
+		zap.Int("count", len(p.Quarantined)),
+		zap.Int("threshold", d.config.DeletionQuarantine.Threshold),
+	)
+
+	return nil
+}
+
+// syncQuarantine records the quarantined deletions, and removes entries for entitlements that have since been
+// deleted, or that Discord lists as active again
+func (d *Daemon) syncQuarantine(ctx context.Context, tx pgx.Tx, p plan, activeEntitlements []entitlement.Entitlement) error {
+	if !d.config.DeletionQuarantine.Enabled {
+		return nil
+	}
+
+	if len(p.Quarantined) > 0 {
+		discordIds := make([]uint64, len(p.Quarantined))
+		entitlementIds := make([]uuid.UUID, len(p.Quarantined))
+		for i, deletion := range p.Quarantined {
+			discordIds[i] = deletion.DiscordId
+			entitlementIds[i] = deletion.EntitlementId
+		}
+
+		if _, err := tx.Exec(ctx, insertQuarantineQuery, discordIds, uuidArray(entitlementIds)); err != nil {
+			return err
+		}
+	}
+
+	active := make([]uint64, 0, len(activeEntitlements))
+	for _, entitlement := range activeEntitlements {
+		if !entitlement.Deleted {
+			active = append(active, entitlement.Id)
+		}
+	}
+
+	_, err := tx.Exec(ctx, clearQuarantineQuery, active)
+	return err
+}
+
+// ListQuarantine returns all quarantined deletions, including those that have been approved but not yet applied
+func (d *Daemon) ListQuarantine(ctx context.Context) ([]QuarantinedDeletion, error) {
+	if !d.config.DeletionQuarantine.Enabled {
+		return nil, ErrQuarantineDisabled
+	}
+
+	// Prevent the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	rows, err := d.db().pool.Query(ctx, listQuarantineQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deletions := make([]QuarantinedDeletion, 0)
+	for rows.Next() {
+		var deletion QuarantinedDeletion
+		if err := rows.Scan(&deletion.DiscordId, &deletion.EntitlementId, &deletion.QuarantinedAt, &deletion.ApprovedAt); err != nil {
+			return nil, err
+		}
+
+		deletions = append(deletions, deletion)
+	}
+
+	return deletions, rows.Err()
+}
+
+// ApproveQuarantine approves the quarantined deletions of the given Discord entitlement IDs, or all quarantined
+// deletions if discordIds is nil, so that they are applied by the next run. It returns the number approved.
+func (d *Daemon) ApproveQuarantine(ctx context.Context, discordIds []uint64) (int64, error) {
+	if !d.config.DeletionQuarantine.Enabled {
+		return 0, ErrQuarantineDisabled
+	}
+
+	// Prevent the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	tag, err := d.db().pool.Exec(ctx, approveQuarantineQuery, discordIds)
+	if err != nil {
+		return 0, err
+	}
+
+	d.logger.Info("Approved quarantined deletions", zap.Int64("count", tag.RowsAffected()), zap.Uint64s("discord_ids", discordIds))
+	return tag.RowsAffected(), nil
+}
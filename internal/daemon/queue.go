@@ -0,0 +1,72 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/queue"
+	"go.uber.org/zap"
+)
+
+// queueRetryDelay is how long to wait before reconnecting after the connection to the queue is lost
+const queueRetryDelay = 5 * time.Second
+
+func newQueueConsumer(config config.Config) *queue.Consumer {
+	if len(config.Queue.Url) == 0 {
+		return nil
+	}
+
+	return queue.NewConsumer(config.Queue.Url, config.Queue.Name)
+}
+
+// consumeQueue performs the runs requested on the queue until ctx is cancelled, reconnecting if the connection is
+// lost
+func (d *Daemon) consumeQueue(ctx context.Context) {
+	for {
+		d.logger.Info("Consuming run requests", zap.String("queue", d.queue.Queue()))
+
+		err := d.queue.Run(ctx, d.handleRunRequest, func(payload []byte, err error) {
+			d.logger.Warn("Received invalid run request", zap.ByteString("payload", payload), zap.Error(err))
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		d.logger.Warn("Disconnected from queue, reconnecting", zap.Duration("delay", queueRetryDelay), zap.Error(err))
+
+		timer := time.NewTimer(queueRetryDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// handleRunRequest performs the requested run, returning once it has finished so that the request is only
+// acknowledged once its changes have been committed
+func (d *Daemon) handleRunRequest(ctx context.Context, request queue.Request) error {
+	var scope runScope
+	switch request.Scope {
+	case queue.ScopeGuild:
+		scope.GuildId = request.GuildId
+	case queue.ScopeUser:
+		scope.UserId = request.UserId
+	}
+
+	if request.Scope == queue.ScopeFull {
+		d.logger.Info("Run requested from queue")
+	} else {
+		d.logger.Info("Scoped run requested from queue", scope.fields()...)
+		ctx = withRunScope(ctx, scope)
+	}
+
+	if err := d.enqueueRun(ctx, true, runPriorityRequested); err != nil {
+		d.logger.Error("Failed to perform run requested from queue", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"go.uber.org/zap"
+)
+
+// recount lists the application's entitlements a second time, only counting them, and returns a CountMismatchError
+// if the count differs from the first listing by more than COUNT_CHECK_TOLERANCE. Discord does not report a total,
+// so this is the only way to catch a listing that was silently cut short. Entitlements created after the first
+// listing are not counted, as they have higher IDs than any it saw, unless the first listing was empty.
+func (d *Daemon) recount(ctx context.Context, listed []entitlement.Entitlement) error {
+	last := ^uint64(0)
+	if len(listed) > 0 {
+		last = 0
+		for _, e := range listed {
+			last = max(last, e.Id)
+		}
+	}
+
+	pager := d.newEntitlementPager(0)
+
+	var recounted int
+	for {
+		page, err := pager.Next(ctx)
+		if err != nil {
+			var paginationErr *PaginationError
+			if errors.As(err, &paginationErr) {
+				return err
+			}
+
+			return &DiscordUnavailableError{Err: err}
+		}
+
+		if page == nil {
+			break
+		}
+
+		for _, e := range page {
+			if e.Id <= last {
+				recounted++
+			}
+		}
+
+		if pager.Cursor() >= last {
+			break
+		}
+	}
+
+	if diff := recounted - len(listed); abs(diff) > d.config.CountCheck.Tolerance {
+		d.fetchLogger.Error(
+			"Entitlement count differs between listings",
+			zap.Int("listed", len(listed)),
+			zap.Int("recounted", recounted),
+			zap.Int("tolerance", d.config.CountCheck.Tolerance),
+		)
+
+		return &CountMismatchError{Listed: len(listed), Recounted: recounted}
+	}
+
+	d.fetchLogger.Debug("Entitlement count verified", zap.Int("listed", len(listed)), zap.Int("recounted", recounted))
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// renewal is an existing entitlement whose expiry was extended by Discord, e.g. when a subscription renews
+type renewal = store.Renewal
+
+// currentExpiries returns the stored expiry of each linked entitlement that is about to be refreshed, if
+// RENEWAL_EVENTS_ENABLED is set, so that renewals can be detected. Entitlements that never expire are omitted.
+func (d *Daemon) currentExpiries(ctx context.Context, tx pgx.Tx, creations []plannedCreation) (map[uuid.UUID]time.Time, error) {
+	if !d.config.RenewalEvents.Enabled {
+		return nil, nil
+	}
+
+	var ids []uuid.UUID
+	for _, creation := range creations {
+		if creation.Linked {
+			ids = append(ids, creation.EntitlementId)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return d.db().store.GetExpiries(ctx, tx, ids)
+}
+
+// renewalOf returns the renewal of the entitlement, if the creation refreshed an existing entitlement in place and
+// extended its expiry
+func renewalOf(creation plannedCreation, created model.Entitlement, expiries map[uuid.UUID]time.Time) (renewal, bool) {
+	if !creation.Linked || created.Id != creation.EntitlementId || created.ExpiresAt == nil {
+		return renewal{}, false
+	}
+
+	previous, ok := expiries[created.Id]
+	if !ok || !created.ExpiresAt.After(previous) {
+		return renewal{}, false
+	}
+
+	return renewal{
+		DiscordId:         creation.Entitlement.Id,
+		EntitlementId:     created.Id,
+		GuildId:           creation.GuildId,
+		UserId:            creation.UserId,
+		SkuId:             creation.Sku.Id,
+		PreviousExpiresAt: previous,
+		ExpiresAt:         *created.ExpiresAt,
+	}, true
+}
+
+// recordRenewals writes the renewals to the entitlement_renewals table, for the billing analytics pipeline
+func (d *Daemon) recordRenewals(ctx context.Context, tx pgx.Tx, renewals []renewal) error {
+	if len(renewals) == 0 {
+		return nil
+	}
+
+	runId, _ := RunIdFromContext(ctx)
+	for _, renewal := range renewals {
+		d.logger.Info(
+			"Renewed entitlement",
+			append(
+				d.identityFields(renewal.DiscordId, 0, renewal.GuildId, renewal.UserId),
+				zap.String("entitlement_id", renewal.EntitlementId.String()),
+				zap.Time("previous_expires_at", renewal.PreviousExpiresAt),
+				zap.Time("expires_at", renewal.ExpiresAt),
+			)...,
+		)
+
+		if err := d.db().store.InsertRenewal(ctx, tx, runId, renewal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/TicketsBot-cloud/common/collections"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/postgres"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// readStore returns the store to make reads from that do not need to see the primary's latest writes, which is the
+// read replica if REPLICA_DATABASE_URI is set
+func (d *Daemon) readStore() store.EntitlementStore {
+	dbs := d.db()
+	if dbs.replicaStore != nil {
+		return dbs.replicaStore
+	}
+
+	return dbs.store
+}
+
+// scanMissingOnReplica pages through discord_entitlements on the read replica for the links of entitlements that
+// Discord no longer lists, so that the primary only has to check the entitlements that are listed. false is returned
+// if the primary should be scanned instead, because the replica is not configured, is lagging by more than
+// REPLICA_MAX_LAG, or could not be scanned.
+func (d *Daemon) scanMissingOnReplica(ctx context.Context, activeEntitlements []entitlement.Entitlement, thresholds removalThresholds, state *linkState) bool {
+	dbs := d.db()
+	if dbs.replicaStore == nil {
+		return false
+	}
+
+	lag, err := postgres.ReplicationLag(ctx, dbs.replicaPool)
+	if err != nil {
+		d.logger.Warn("Failed to check read replica lag, scanning primary", zap.Error(err))
+		return false
+	}
+
+	if lag > d.config.Replica.MaxLag {
+		d.logger.Warn("Read replica is lagging, scanning primary", zap.Duration("lag", lag), zap.Duration("max_lag", d.config.Replica.MaxLag))
+		return false
+	}
+
+	tx, err := dbs.replicaStore.BeginTx(ctx)
+	if err != nil {
+		d.logger.Warn("Failed to begin transaction on read replica, scanning primary", zap.Error(err))
+		return false
+	}
+
+	defer rollback(tx)
+
+	if _, err := tx.Exec(ctx, "SET TRANSACTION READ ONLY;"); err != nil {
+		d.logger.Warn("Failed to begin transaction on read replica, scanning primary", zap.Error(err))
+		return false
+	}
+
+	active := collections.NewSet[uint64]()
+	for _, entitlement := range activeEntitlements {
+		active.Add(entitlement.Id)
+	}
+
+	// Collected separately, so that state is left untouched if the scan fails part way through
+	scanned := linkState{MissingBySku: make(map[uuid.UUID]int)}
+	retained := make(map[uuid.UUID]int)
+	err = d.forEachLink(ctx, tx, func(link missingLink) {
+		if !d.inShard(link.DiscordId) || active.Contains(link.DiscordId) {
+			return
+		}
+
+		scanned.MissingCount++
+		scanned.MissingBySku[link.SkuId]++
+		scanned.retainMissing(link, thresholds, retained)
+	})
+	if err != nil {
+		d.logger.Warn("Failed to scan read replica, scanning primary", zap.Error(err))
+		return false
+	}
+
+	state.Missing = scanned.Missing
+	state.MissingCount = scanned.MissingCount
+	state.MissingBySku = scanned.MissingBySku
+
+	d.dbLogger.Debug("Scanned read replica for missing entitlements", zap.Int("missing", scanned.MissingCount), zap.Duration("lag", lag))
+	return true
+}
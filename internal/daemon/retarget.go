@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/lock_linked_entitlement.sql
+	lockLinkedEntitlementQuery string
+
+	//go:embed sql/upsert_guild_override.sql
+	upsertGuildOverrideQuery string
+
+	//go:embed sql/retarget_entitlement.sql
+	retargetEntitlementQuery string
+
+	//go:embed sql/list_guild_overrides.sql
+	listGuildOverridesQuery string
+)
+
+var (
+	ErrRetargetDisabled    = errors.New("entitlement retargeting is not enabled")
+	ErrEntitlementNotFound = errors.New("no entitlement is linked to the Discord entitlement")
+	ErrNotUserEntitlement  = errors.New("only user entitlements can be retargeted to a different guild")
+)
+
+// RetargetEntitlement changes the guild that the user entitlement linked to the Discord entitlement activates. The
+// internal entitlement is updated in place, so the link to the Discord entitlement is preserved, and the guild is
+// recorded as an override so that later runs do not revert it.
+func (d *Daemon) RetargetEntitlement(ctx context.Context, discordId, guildId uint64) error {
+	if !d.config.Retarget.Enabled {
+		return ErrRetargetDisabled
+	}
+
+	// Prevent a run from rewriting the entitlement concurrently, and the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	tx, err := d.db().pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer rollback(tx)
+
+	var (
+		entitlementId uuid.UUID
+		userId        *uint64
+	)
+
+	if err := tx.QueryRow(ctx, lockLinkedEntitlementQuery, discordId).Scan(&entitlementId, &userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrEntitlementNotFound
+		}
+
+		return err
+	}
+
+	if userId == nil {
+		return ErrNotUserEntitlement
+	}
+
+	if _, err := tx.Exec(ctx, upsertGuildOverrideQuery, discordId, guildId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, retargetEntitlementQuery, entitlementId, guildId); err != nil {
+		return wrapDbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return wrapDbError(err)
+	}
+
+	d.logger.Info(
+		"Retargeted entitlement",
+		zap.Uint64("discord_id", discordId),
+		zap.String("entitlement_id", entitlementId.String()),
+		zap.Uint64("guild_id", guildId),
+	)
+
+	return nil
+}
+
+// applyGuildOverrides replaces the guild of planned creations that have been retargeted by RetargetEntitlement
+func (d *Daemon) applyGuildOverrides(ctx context.Context, tx pgx.Tx, p *plan) error {
+	if !d.config.Retarget.Enabled {
+		return nil
+	}
+
+	var discordIds []uint64
+	for _, creation := range p.Creations {
+		if creation.Linked && creation.UserId != nil {
+			discordIds = append(discordIds, creation.Entitlement.Id)
+		}
+	}
+
+	if len(discordIds) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, listGuildOverridesQuery, discordIds)
+	if err != nil {
+		return err
+	}
+
+	overrides := make(map[uint64]uint64)
+	for rows.Next() {
+		var discordId, guildId uint64
+		if err := rows.Scan(&discordId, &guildId); err != nil {
+			rows.Close()
+			return err
+		}
+
+		overrides[discordId] = guildId
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, creation := range p.Creations {
+		if guildId, ok := overrides[creation.Entitlement.Id]; ok && creation.UserId != nil {
+			p.Creations[i].GuildId = &guildId
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/postgres"
+	"go.uber.org/zap"
+)
+
+// retryTransient calls f until it succeeds, returns a non-transient error, or DB_RETRY_ATTEMPTS attempts have been
+// made. Attempts are separated by an exponential backoff with full jitter, so that concurrent shards do not retry in
+// lockstep. f must be safe to re-run from the start, i.e. it must use a fresh transaction on each attempt.
+func (d *Daemon) retryTransient(ctx context.Context, f func() error) error {
+	attempts := max(d.config.DbRetry.Attempts, 1)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || attempt >= attempts || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := backoff(attempt, d.config.DbRetry.BaseDelay, d.config.DbRetry.MaxDelay)
+		d.logger.Warn(
+			"Transient database error, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", attempts),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		metrics.DbRetries.WithLabelValues(d.applicationLabel).Inc()
+
+		// A dropped connection may mean the primary has moved, so don't hand the retry a stale connection
+		if postgres.IsFailoverError(err) {
+			postgres.CloseIdleConns(ctx, d.db().pool)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// isTransient returns true if err was caused by a transient database error. Discord errors are excluded, as Discord
+// requests are retried by retryDiscord.
+func isTransient(err error) bool {
+	var (
+		discordUnavailableErr *DiscordUnavailableError
+		discordAuthErr        *DiscordAuthError
+	)
+	if errors.As(err, &discordUnavailableErr) || errors.As(err, &discordAuthErr) {
+		return false
+	}
+
+	return postgres.IsTransientError(err)
+}
+
+func backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := base << (attempt - 1)
+	if delay <= 0 || (maxDelay > 0 && delay > maxDelay) {
+		delay = maxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"maps"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+// previousEntitlementIds returns the IDs that the entitlements of the unlinked creations previously had, by Discord
+// ID. This allows an entitlement that reappears, e.g. after an API flake or an un-cancellation, to be recreated with
+// its previous ID, so that references to it remain valid. The stable ID mapping is consulted first, then the undo log
+// for the most recent deletion. IDs that are in use again are not returned.
+func (d *Daemon) previousEntitlementIds(ctx context.Context, tx pgx.Tx, creations []plannedCreation) (map[uint64]uuid.UUID, error) {
+	if !d.config.StableIds.Enabled && !d.config.UndoLog.Enabled {
+		return nil, nil
+	}
+
+	var discordIds []uint64
+	for _, creation := range creations {
+		if !creation.Linked {
+			discordIds = append(discordIds, creation.Entitlement.Id)
+		}
+	}
+
+	if len(discordIds) == 0 {
+		return nil, nil
+	}
+
+	ids := make(map[uint64]uuid.UUID)
+	if d.config.StableIds.Enabled {
+		stable, err := d.db().store.StableEntitlementIds(ctx, tx, discordIds)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(ids, stable)
+	}
+
+	if d.config.UndoLog.Enabled && len(ids) < len(discordIds) {
+		remaining := make([]uint64, 0, len(discordIds)-len(ids))
+		for _, discordId := range discordIds {
+			if _, ok := ids[discordId]; !ok {
+				remaining = append(remaining, discordId)
+			}
+		}
+
+		deleted, err := d.db().store.DeletedEntitlementIds(ctx, tx, remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(ids, deleted)
+	}
+
+	return ids, nil
+}
+
+// recordEntitlementIds records the entitlement ID of each link in the stable ID mapping. Unlike links, the mapping is
+// not removed when the entitlement is deleted, so the ID can be reused if the Discord entitlement reappears.
+func (d *Daemon) recordEntitlementIds(ctx context.Context, tx pgx.Tx, links []link) error {
+	if !d.config.StableIds.Enabled || len(links) == 0 {
+		return nil
+	}
+
+	return d.db().store.RecordEntitlementIds(ctx, tx, links)
+}
+
+// createEntitlement upserts the entitlement for the creation, using previousId as its ID if it is created and
+// previousId is not the zero UUID
+func (d *Daemon) createEntitlement(ctx context.Context, tx pgx.Tx, creation plannedCreation, previousId uuid.UUID) (model.Entitlement, error) {
+	if previousId == uuid.Nil {
+		return d.db().store.CreateEntitlement(ctx, tx, creation.GuildId, creation.UserId, creation.Sku.Id, creation.Entitlement.EndsAt)
+	}
+
+	return d.db().store.CreateEntitlementWithId(ctx, tx, previousId, creation.GuildId, creation.UserId, creation.Sku.Id, creation.Entitlement.EndsAt)
+}
@@ -0,0 +1,437 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/postgres"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/tracing"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+func (d *Daemon) runOnce(ctx context.Context) (err error) {
+	runId := uuid.New()
+	ctx = withRunId(ctx, runId)
+
+	scope, scoped := runScopeFromContext(ctx)
+	if scoped {
+		d.logger.Debug("Running scoped synchronisation", append(scope.fields(), zap.String("run_id", runId.String()))...)
+	} else {
+		d.logger.Debug("Running synchronisation", zap.String("run_id", runId.String()))
+	}
+
+	// Declared first so that it runs last, after the error has been classified
+	summary := RunSummary{RunId: runId, StartedAt: time.Now(), GuildId: scope.GuildId, UserId: scope.UserId}
+	defer func() {
+		summary.Duration = time.Since(summary.StartedAt)
+		if err != nil {
+			summary.Error = err.Error()
+			summary.ErrorClass = Classify(err)
+		}
+
+		d.history.record(summary)
+		d.writeStatusFile(summary)
+		d.notifyRun(summary)
+	}()
+
+	transaction := sentry.StartTransaction(ctx, "sync", sentry.WithOpName("sync.run"))
+	transaction.SetTag("run_id", runId.String())
+	ctx, finishTrace := tracing.StartSpan(transaction.Context(), "sync.run")
+
+	defer func() {
+		if err != nil {
+			if ctx.Err() != nil {
+				err = &TimeoutError{Err: err}
+			}
+
+			d.recordError(err)
+			transaction.SetTag("error_class", string(Classify(err)))
+		}
+
+		finishTrace(err)
+		finishSpan(transaction, err)
+	}()
+
+	defer d.sampleMemStats()()
+	defer d.profileSlowRun(ctx)()
+
+	ctx, timings := withPhaseTimings(ctx)
+
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			summary.Phase = timings.lastPhase()
+		}
+
+		duration := time.Now().Sub(start)
+		if duration > (d.config.ExecutionTimeout / 2.0) {
+			fields := append([]zap.Field{zap.Duration("duration", duration)}, timings.fields()...)
+			d.logger.Warn("Execution took more than 50% of the timeout", fields...)
+		}
+	}()
+
+	d.reloadToken()
+
+	flags := d.evaluateFlags(ctx)
+
+	fetchCtx, finishFetch := startSpan(ctx, "sync.fetch")
+	endFetch := d.timePhase(ctx, phaseFetch)
+	var (
+		activeEntitlements []entitlement.Entitlement
+		pages              []pageHash
+	)
+	if len(d.config.BackfillFile) > 0 {
+		activeEntitlements, err = d.readBackfill()
+	} else {
+		activeEntitlements, pages, err = d.fetchEntitlements(fetchCtx)
+	}
+	endFetch()
+	finishFetch(err)
+	if err != nil {
+		d.fetchLogger.Error("Failed to fetch entitlements", zap.Error(err))
+		var paginationErr *PaginationError
+		if len(d.config.BackfillFile) > 0 || errors.As(err, &paginationErr) {
+			return err
+		}
+
+		if isDiscordAuthError(err) {
+			return &DiscordAuthError{Err: err}
+		}
+
+		return &DiscordUnavailableError{Err: err}
+	}
+
+	d.fetchLogger.Debug("Fetched entitlements", zap.Int("count", len(activeEntitlements)))
+
+	if d.config.CountCheck.Enabled && !scoped && len(d.config.BackfillFile) == 0 {
+		if err := d.recount(ctx, activeEntitlements); err != nil {
+			return err
+		}
+	}
+	d.refreshSkuMetadata(ctx)
+	summary.Fetched = len(activeEntitlements)
+
+	_, planned := planModeFromContext(ctx)
+	if scoped || planned {
+		pages = nil
+	}
+
+	if d.canReuseSnapshot(ctx, pages, flags) {
+		d.logger.Debug("Entitlements unchanged since the database was last in sync, skipping reconciliation", zap.Int("pages", len(pages)))
+		summary.Unchanged = true
+		d.notifyExpiring(ctx)
+		return nil
+	}
+
+	shardEntitlements := d.filterShard(activeEntitlements)
+	if d.config.ShardCount > 1 {
+		d.logger.Debug(
+			"Filtered entitlements to shard",
+			zap.Int("shard_index", d.config.ShardIndex),
+			zap.Int("shard_count", d.config.ShardCount),
+			zap.Int("count", len(shardEntitlements)),
+		)
+	}
+
+	// The database phase is retried as a whole on transient errors, with the plan recomputed against the current
+	// state of the database, so that changes committed by a failed attempt are not applied twice
+	var p *plan
+	err = d.retryTransient(ctx, func() error {
+		attempted, err := d.reconcile(ctx, &summary, flags, shardEntitlements)
+		if attempted != nil {
+			p = attempted
+		}
+
+		return err
+	})
+
+	// A scoped run only sees some of the SKUs, so would reset the consecutive run counts of the rest
+	if p != nil && !scoped {
+		d.escalateUnknownSkus(p.UnknownSkus)
+	}
+
+	if p != nil {
+		for reason, count := range p.Skipped {
+			metrics.Skipped.WithLabelValues(d.applicationLabel, string(reason)).Add(float64(count))
+		}
+	}
+
+	if err != nil {
+		d.snapshot.invalidate()
+		return err
+	}
+
+	if p != nil && !scoped && !planned {
+		d.updateSnapshot(pages, flags, *p, summary)
+	}
+
+	if !summary.DryRun && !summary.ReadOnly {
+		d.notifyExpiring(ctx)
+	}
+
+	if d.db().shadowStore != nil && !scoped {
+		shadowCtx, finishShadow := startSpan(ctx, "sync.shadow")
+		err := d.compareShadow(shadowCtx, activeEntitlements)
+		finishShadow(err)
+		if err != nil {
+			d.logger.Error("Failed to compare shadow database", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// reconcile diffs the database against the given entitlements and applies the changes in a new transaction. The
+// plan is returned once it has been computed, even if it could not be applied.
+func (d *Daemon) reconcile(ctx context.Context, summary *RunSummary, flags runFlags, shardEntitlements []entitlement.Entitlement) (*plan, error) {
+	tx, err := d.beginRunTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rollback(tx)
+
+	diffCtx, finishDiff := startSpan(ctx, "sync.diff")
+	p, readOnly, err := d.diff(diffCtx, tx, shardEntitlements)
+	finishDiff(err)
+	if err != nil {
+		return nil, err
+	}
+
+	p = d.applyFlags(p, flags)
+	p = d.pauseDeletions(p)
+
+	summary.setPlan(p)
+	summary.ReadOnly = readOnly
+	summary.DryRun = flags.DryRun
+	if mode, ok := planModeFromContext(ctx); ok && mode.Expected == nil {
+		summary.DryRun = true
+	}
+
+	if limit := d.config.MaxCreationsThreshold; limit > 0 && p.NewCreations() >= limit {
+		d.logger.Error("MAX_CREATIONS_THRESHOLD exceeded, not applying changes", zap.Int("count", p.NewCreations()), zap.Int("threshold", limit))
+		return &p, &ThresholdExceededError{Threshold: "MAX_CREATIONS_THRESHOLD", Count: p.NewCreations(), Limit: limit}
+	}
+
+	if err := d.checkStrict(p); err != nil {
+		d.logger.Error("Data anomalies found in strict mode, not applying changes", zap.Error(err))
+		return &p, err
+	}
+
+	if len(p.Ownerless) > 0 && d.config.OwnerlessEntitlementPolicy == config.OwnerlessPolicyError {
+		d.logger.Error("Entitlements have neither a guild nor a user, not applying changes", zap.Int("count", len(p.Ownerless)))
+		return &p, &MalformedEntitlementError{DiscordId: p.Ownerless[0].Entitlement.Id, Count: len(p.Ownerless)}
+	}
+
+	if stop, err := d.checkPlanMode(ctx, p, flags.DryRun, readOnly); stop {
+		return &p, err
+	}
+
+	if flags.DryRun {
+		d.logger.Info("Dry run enabled, skipping mutations", p.driftFields()...)
+		d.reportDryRun(ctx, p)
+		return &p, nil
+	}
+
+	// If the database is read-only (e.g. a replica promotion is in progress), still report the drift rather than
+	// failing the run with a write error
+	if readOnly {
+		d.logger.Warn("Database is read-only, skipping mutations", p.driftFields()...)
+		return &p, nil
+	}
+
+	writeCtx, finishWrite := startSpan(ctx, "sync.write")
+	err = d.write(writeCtx, tx, p, shardEntitlements)
+	finishWrite(err)
+	if err != nil {
+		if postgres.IsReadOnlyError(err) {
+			d.logger.Warn("Database became read-only during run, remaining mutations skipped", p.driftFields()...)
+			return &p, nil
+		}
+
+		return &p, err
+	}
+
+	d.logger.Debug("Synchronisation complete", p.driftFields()...)
+
+	d.computeStats(ctx)
+
+	return &p, nil
+}
+
+// diff computes the changes required to bring the database in line with Discord, and reports whether the
+// database is currently read-only
+func (d *Daemon) diff(ctx context.Context, tx pgx.Tx, activeEntitlements []entitlement.Entitlement) (plan, bool, error) {
+	endSkuResolution := d.timePhase(ctx, phaseSkuResolution)
+	skus, err := d.resolveSkus(ctx, activeEntitlements)
+	if err != nil {
+		endSkuResolution()
+		return plan{}, false, err
+	}
+
+	thresholds, err := d.resolveRemovalThresholds(ctx, skus)
+	if err != nil {
+		endSkuResolution()
+		return plan{}, false, err
+	}
+
+	targets, err := d.resolveSkuTargets(ctx, tx, skus)
+	endSkuResolution()
+	if err != nil {
+		d.logger.Error("Failed to resolve SKU targets", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	readOnly, err := postgres.IsReadOnly(ctx, tx)
+	if err != nil {
+		d.logger.Error("Failed to check whether database is read-only", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	if err := d.loadPurgedUsers(ctx, tx); err != nil {
+		d.logger.Error("Failed to read purged users", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	endDeletionScan := d.timePhase(ctx, phaseDeletionScan)
+	links, err := d.readLinkState(ctx, tx, activeEntitlements, thresholds, readOnly)
+	endDeletionScan()
+	if err != nil {
+		d.logger.Error("Failed to list all discord entitlements", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	p := d.computePlan(activeEntitlements, skus, targets, links, thresholds)
+	if err := d.applyGuildOverrides(ctx, tx, &p); err != nil {
+		d.logger.Error("Failed to read guild overrides", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	d.applySkuPrecedence(&p)
+
+	if err := d.deferDeletions(ctx, tx, &p); err != nil {
+		d.logger.Error("Failed to read pending deletions", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	if err := d.quarantineDeletions(ctx, tx, &p); err != nil {
+		d.logger.Error("Failed to read deletion quarantine", zap.Error(err))
+		return plan{}, false, err
+	}
+
+	return p, readOnly, nil
+}
+
+// write applies the plan and commits the transaction
+func (d *Daemon) write(ctx context.Context, tx pgx.Tx, p plan, activeEntitlements []entitlement.Entitlement) error {
+	removedGuilds, err := d.lookupRemovedGuilds(ctx, tx, p)
+	if err != nil {
+		d.logger.Error("Failed to read the guilds of deleted entitlements", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	endReconcile := d.timePhase(ctx, phaseReconcile)
+	activations, err := d.applyPlan(ctx, tx, p)
+	endReconcile()
+	if err != nil {
+		return err
+	}
+
+	if err := d.recordDailyCounts(ctx, tx, p); err != nil {
+		d.logger.Error("Failed to record daily counts", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.deadLetterOwnerless(ctx, tx, p); err != nil {
+		d.logger.Error("Failed to record dead letters", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.syncQuarantine(ctx, tx, p, activeEntitlements); err != nil {
+		d.logger.Error("Failed to update deletion quarantine", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.syncPendingDeletions(ctx, tx, p, activeEntitlements); err != nil {
+		d.logger.Error("Failed to update pending deletions", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.syncSuppressions(ctx, tx, p); err != nil {
+		d.logger.Error("Failed to record suppressed entitlements", zap.Error(err))
+		return wrapDbError(err)
+	}
+
+	if err := d.pruneUndoLog(ctx, tx); err != nil {
+		d.logger.Error("Failed to prune undo log", zap.Error(err))
+		return err
+	}
+
+	endCommit := d.timePhase(ctx, phaseCommit)
+	err = tx.Commit(ctx)
+	endCommit()
+	if err != nil {
+		return wrapDbError(err)
+	}
+
+	d.notifyGuildChanges(ctx, activations, p, removedGuilds)
+
+	return nil
+}
+
+// beginRunTx starts a transaction tagged with the ID of the run that ctx belongs to
+func (d *Daemon) beginRunTx(ctx context.Context) (pgx.Tx, error) {
+	tx, err := d.db().store.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runId, _ := RunIdFromContext(ctx)
+	if err := postgres.SetRunApplicationName(ctx, tx, runId.String()); err != nil {
+		rollback(tx)
+		return nil, err
+	}
+
+	tx = postgres.AnnotateTx(tx)
+	tx = postgres.LogSlowQueries(tx, d.db().pool, postgres.SlowQueryOptions{
+		Threshold: d.config.SlowQueryThreshold,
+		Explain:   d.config.SlowQueryExplain,
+	}, d.logger)
+
+	return tx, nil
+}
+
+func rollback(tx pgx.Tx) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tx.Rollback(ctx)
+}
+
+// startSpan starts a Sentry span, and a Datadog span if tracing.Available. The returned function finishes both.
+func startSpan(ctx context.Context, operation string) (context.Context, func(err error)) {
+	span := sentry.StartSpan(ctx, operation)
+	ctx, finishDatadog := tracing.StartSpan(span.Context(), operation)
+
+	return ctx, func(err error) {
+		finishDatadog(err)
+		finishSpan(span, err)
+	}
+}
+
+func finishSpan(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
@@ -0,0 +1,19 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type runIdKey struct{}
+
+func withRunId(ctx context.Context, runId uuid.UUID) context.Context {
+	return context.WithValue(ctx, runIdKey{}, runId)
+}
+
+// RunIdFromContext returns the ID of the run that ctx belongs to, if any
+func RunIdFromContext(ctx context.Context) (uuid.UUID, bool) {
+	runId, ok := ctx.Value(runIdKey{}).(uuid.UUID)
+	return runId, ok
+}
@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/postgres"
+	"go.uber.org/zap"
+)
+
+// runPriority orders the runs waiting in the run queue. Higher priority runs start first.
+type runPriority int
+
+const (
+	// runPriorityScheduled is a run started every RUN_FREQUENCY
+	runPriorityScheduled runPriority = iota
+	// runPriorityTriggered is a run that nothing waits for, e.g. one triggered by SIGUSR1 or a Redis command
+	runPriorityTriggered
+	// runPriorityRequested is a run that a caller is waiting for the result of, e.g. one requested through the admin
+	// API or the run request queue
+	runPriorityRequested
+)
+
+// runKey identifies the runs that can be coalesced. A full run has the zero scope. Runs with a non-zero Unique, such
+// as plan runs, are never coalesced.
+type runKey struct {
+	Scope  runScope
+	Unique uint64
+}
+
+type queuedRun struct {
+	// ctx carries the scope and mode of the run
+	ctx      context.Context
+	key      runKey
+	priority runPriority
+	seq      uint64
+	waiters  []chan error
+}
+
+// runQueue serialises the runs requested in daemon mode. Requests for a run that is already waiting to start, e.g.
+// several requests for a full run, are coalesced into it, and the run takes the highest priority of its requests.
+// Once a run has started, new requests queue a further run, as they may concern changes made after it fetched.
+type runQueue struct {
+	mu      sync.Mutex
+	pending []*queuedRun
+	seq     uint64
+	ready   chan struct{}
+}
+
+func newRunQueue() *runQueue {
+	return &runQueue{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// submit queues a run, returning a channel that receives its result. If coalesce is false, the run is never merged
+// with another.
+func (q *runQueue) submit(ctx context.Context, scope runScope, coalesce bool, priority runPriority) (<-chan error, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	key := runKey{Scope: scope}
+	if !coalesce {
+		key.Unique = q.seq
+	}
+
+	done := make(chan error, 1)
+
+	for _, run := range q.pending {
+		if run.key == key {
+			run.priority = max(run.priority, priority)
+			run.waiters = append(run.waiters, done)
+			return done, true
+		}
+	}
+
+	q.pending = append(q.pending, &queuedRun{
+		ctx:      ctx,
+		key:      key,
+		priority: priority,
+		seq:      q.seq,
+		waiters:  []chan error{done},
+	})
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return done, false
+}
+
+// next removes and returns the highest priority run, the oldest first, or nil if no runs are waiting
+func (q *runQueue) next() *queuedRun {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil
+	}
+
+	best := 0
+	for i, run := range q.pending {
+		if run.priority > q.pending[best].priority || (run.priority == q.pending[best].priority && run.seq < q.pending[best].seq) {
+			best = i
+		}
+	}
+
+	run := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	return run
+}
+
+func (q *runQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// enqueueRun queues a run and waits for its result. ctx carries the scope and mode of the run, and its timeout is
+// EXECUTION_TIMEOUT from when it starts. The run is not cancelled if ctx is.
+func (d *Daemon) enqueueRun(ctx context.Context, coalesce bool, priority runPriority) error {
+	scope, _ := runScopeFromContext(ctx)
+	done, coalesced := d.runs.submit(context.WithoutCancel(ctx), scope, coalesce, priority)
+	if coalesced {
+		d.logger.Debug("Run already queued, waiting for it", scope.fields()...)
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processRuns performs the queued runs one at a time until ctx is cancelled
+func (d *Daemon) processRuns(ctx context.Context) {
+	for {
+		select {
+		case <-d.runs.ready:
+		case <-ctx.Done():
+			return
+		}
+
+		for run := d.runs.next(); run != nil; run = d.runs.next() {
+			err := d.performQueuedRun(ctx, run)
+			for _, waiter := range run.waiters {
+				waiter <- err
+			}
+		}
+	}
+}
+
+func (d *Daemon) performQueuedRun(ctx context.Context, run *queuedRun) error {
+	runCtx := run.ctx
+	if run.priority == runPriorityScheduled {
+		runCtx = withSnapshotReuse(runCtx)
+	}
+
+	start := time.Now()
+	err := d.doRun(runCtx, d.config.ExecutionTimeout)
+	if err != nil {
+		d.logger.Error("Failed to run", append(run.key.Scope.fields(), zap.Error(err))...)
+
+		if postgres.IsFailoverError(err) {
+			closed := postgres.CloseIdleConns(ctx, d.db().pool)
+			d.logger.Warn("Database may have failed over, closed idle connections", zap.Int("closed", closed))
+		}
+	}
+
+	d.logger.Info("Run completed", zap.Duration("duration", time.Since(start)), zap.Int("queued", d.runs.len()))
+	return err
+}
@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+type testSubmission struct {
+	scope    runScope
+	coalesce bool
+	priority runPriority
+}
+
+func TestRunQueue(t *testing.T) {
+	full := runScope{}
+	guild := runScope{GuildId: 1}
+
+	tests := []struct {
+		name        string
+		submissions []testSubmission
+		// wantCoalesced is whether each submission was merged into a waiting run
+		wantCoalesced []bool
+		// wantOrder is the index of the first submission of each run, in the order the runs start
+		wantOrder []int
+		// wantWaiters is the number of submissions waiting on each run, in the order the runs start
+		wantWaiters []int
+	}{
+		{
+			name: "coalesces full runs",
+			submissions: []testSubmission{
+				{scope: full, coalesce: true, priority: runPriorityScheduled},
+				{scope: full, coalesce: true, priority: runPriorityTriggered},
+			},
+			wantCoalesced: []bool{false, true},
+			wantOrder:     []int{0},
+			wantWaiters:   []int{2},
+		},
+		{
+			name: "does not coalesce different scopes",
+			submissions: []testSubmission{
+				{scope: full, coalesce: true, priority: runPriorityScheduled},
+				{scope: guild, coalesce: true, priority: runPriorityScheduled},
+			},
+			wantCoalesced: []bool{false, false},
+			wantOrder:     []int{0, 1},
+			wantWaiters:   []int{1, 1},
+		},
+		{
+			name: "never coalesces unique runs",
+			submissions: []testSubmission{
+				{scope: full, coalesce: false, priority: runPriorityRequested},
+				{scope: full, coalesce: false, priority: runPriorityRequested},
+			},
+			wantCoalesced: []bool{false, false},
+			wantOrder:     []int{0, 1},
+			wantWaiters:   []int{1, 1},
+		},
+		{
+			name: "starts highest priority first",
+			submissions: []testSubmission{
+				{scope: full, coalesce: true, priority: runPriorityScheduled},
+				{scope: guild, coalesce: true, priority: runPriorityRequested},
+			},
+			wantCoalesced: []bool{false, false},
+			wantOrder:     []int{1, 0},
+			wantWaiters:   []int{1, 1},
+		},
+		{
+			name: "raises priority of coalesced run",
+			submissions: []testSubmission{
+				{scope: full, coalesce: true, priority: runPriorityScheduled},
+				{scope: guild, coalesce: true, priority: runPriorityTriggered},
+				{scope: full, coalesce: true, priority: runPriorityRequested},
+			},
+			wantCoalesced: []bool{false, false, true},
+			wantOrder:     []int{0, 1},
+			wantWaiters:   []int{2, 1},
+		},
+		{
+			name: "starts oldest first at same priority",
+			submissions: []testSubmission{
+				{scope: guild, coalesce: true, priority: runPriorityTriggered},
+				{scope: full, coalesce: true, priority: runPriorityTriggered},
+			},
+			wantCoalesced: []bool{false, false},
+			wantOrder:     []int{0, 1},
+			wantWaiters:   []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newRunQueue()
+
+			var coalesced []bool
+			for _, submission := range tt.submissions {
+				_, merged := q.submit(context.Background(), submission.scope, submission.coalesce, submission.priority)
+				coalesced = append(coalesced, merged)
+			}
+
+			if !slices.Equal(coalesced, tt.wantCoalesced) {
+				t.Errorf("coalesced %v, want %v", coalesced, tt.wantCoalesced)
+			}
+
+			var order, waiters []int
+			for run := q.next(); run != nil; run = q.next() {
+				// seq counts submissions from 1, including those that were coalesced
+				order = append(order, int(run.seq)-1)
+				waiters = append(waiters, len(run.waiters))
+			}
+
+			if !slices.Equal(order, tt.wantOrder) {
+				t.Errorf("started runs in order %v, want %v", order, tt.wantOrder)
+			}
+
+			if !slices.Equal(waiters, tt.wantWaiters) {
+				t.Errorf("runs had %v waiters, want %v", waiters, tt.wantWaiters)
+			}
+		})
+	}
+}
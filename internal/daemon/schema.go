@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+)
+
+var (
+	//go:embed sql/quarantine_schema.sql
+	quarantineSchema string
+
+	//go:embed sql/lease_schema.sql
+	leaseSchema string
+
+	//go:embed sql/pending_deletions_schema.sql
+	pendingDeletionsSchema string
+
+	//go:embed sql/sku_flags_schema.sql
+	skuFlagsSchema string
+
+	//go:embed sql/guild_overrides_schema.sql
+	guildOverridesSchema string
+
+	//go:embed sql/user_purges_schema.sql
+	userPurgesSchema string
+
+	//go:embed sql/dead_letters_schema.sql
+	deadLettersSchema string
+
+	//go:embed sql/undo_log_schema.sql
+	undoLogSchema string
+
+	//go:embed sql/entitlement_ids_schema.sql
+	entitlementIdsSchema string
+
+	//go:embed sql/sku_listener_schema.sql
+	skuListenerSchema string
+
+	//go:embed sql/sku_metadata_schema.sql
+	skuMetadataSchema string
+
+	//go:embed sql/renewals_schema.sql
+	renewalsSchema string
+
+	//go:embed sql/stats_schema.sql
+	statsSchema string
+
+	//go:embed sql/expiry_notifications_schema.sql
+	expiryNotificationsSchema string
+
+	//go:embed sql/suppressions_schema.sql
+	suppressionsSchema string
+)
+
+// EnsureSchema creates the tables used by the daemon itself, if they are enabled and do not already exist
+func (d *Daemon) EnsureSchema(ctx context.Context) error {
+	// The standalone store's tables are referenced by the daemon's own, so must be created first
+	if creator, ok := d.db().store.(store.SchemaCreator); ok {
+		if err := creator.EnsureSchema(ctx); err != nil {
+			return err
+		}
+	}
+
+	if d.config.DeletionQuarantine.Enabled {
+		if _, err := d.db().pool.Exec(ctx, quarantineSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.RunLease.Enabled {
+		if _, err := d.db().pool.Exec(ctx, leaseSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.gracePeriodEnabled() {
+		if _, err := d.db().pool.Exec(ctx, pendingDeletionsSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.SkuTargetSource == config.SkuTargetSourceDatabase {
+		if _, err := d.db().pool.Exec(ctx, skuFlagsSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.Retarget.Enabled {
+		if _, err := d.db().pool.Exec(ctx, guildOverridesSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.UserPurge.Enabled {
+		if _, err := d.db().pool.Exec(ctx, userPurgesSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.deadLettersEnabled() {
+		if _, err := d.db().pool.Exec(ctx, deadLettersSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.UndoLog.Enabled {
+		if _, err := d.db().pool.Exec(ctx, undoLogSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.StableIds.Enabled {
+		if _, err := d.db().pool.Exec(ctx, entitlementIdsSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.SkuListener.Enabled {
+		if _, err := d.db().pool.Exec(ctx, skuListenerSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.SkuMetadata.Enabled {
+		if _, err := d.db().pool.Exec(ctx, skuMetadataSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.RenewalEvents.Enabled {
+		if _, err := d.db().pool.Exec(ctx, renewalsSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.Stats.Enabled {
+		if _, err := d.db().pool.Exec(ctx, statsSchema); err != nil {
+			return err
+		}
+	}
+
+	if len(d.config.ExpiryHook.Url) > 0 {
+		if _, err := d.db().pool.Exec(ctx, expiryNotificationsSchema); err != nil {
+			return err
+		}
+	}
+
+	if len(d.config.SkuPrecedence) > 0 {
+		if _, err := d.db().pool.Exec(ctx, suppressionsSchema); err != nil {
+			return err
+		}
+	}
+
+	if d.config.MultiApplication() {
+		if _, err := d.db().pool.Exec(ctx, applicationsSchema); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
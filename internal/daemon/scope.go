@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// runScope restricts a run to the entitlements of a single guild or user. Only the entitlements that Discord lists
+// for the guild or user are fetched, so entitlements that are no longer listed cannot be detected, and are left for
+// the next full run to remove. Entitlements that Discord lists as deleted are still removed.
+type runScope struct {
+	GuildId uint64
+	UserId  uint64
+}
+
+func (s runScope) fields() []zap.Field {
+	switch {
+	case s.GuildId != 0:
+		return []zap.Field{zap.Uint64("guild_id", s.GuildId)}
+	case s.UserId != 0:
+		return []zap.Field{zap.Uint64("user_id", s.UserId)}
+	default:
+		return nil
+	}
+}
+
+type runScopeKey struct{}
+
+func withRunScope(ctx context.Context, scope runScope) context.Context {
+	return context.WithValue(ctx, runScopeKey{}, scope)
+}
+
+// runScopeFromContext returns the scope of the run that ctx belongs to, or false if it is a full run
+func runScopeFromContext(ctx context.Context) (runScope, bool) {
+	scope, ok := ctx.Value(runScopeKey{}).(runScope)
+	return scope, ok
+}
+
+// SyncGuild syncs the entitlements of a single guild, e.g. straight after a purchase, waiting for any queued runs
+// with a higher priority first
+func (d *Daemon) SyncGuild(ctx context.Context, guildId uint64) error {
+	return d.enqueueRun(withRunScope(ctx, runScope{GuildId: guildId}), true, runPriorityRequested)
+}
+
+// SyncUser syncs the entitlements of a single user, e.g. straight after a purchase, waiting for any queued runs
+// with a higher priority first
+func (d *Daemon) SyncUser(ctx context.Context, userId uint64) error {
+	return d.enqueueRun(withRunScope(ctx, runScope{UserId: userId}), true, runPriorityRequested)
+}
+
+// requestScopedSync queues a sync of the guild or user in the background
+func (d *Daemon) requestScopedSync(scope runScope) {
+	if _, coalesced := d.runs.submit(withRunScope(context.Background(), scope), scope, true, runPriorityTriggered); coalesced {
+		d.logger.Debug("Sync already requested", scope.fields()...)
+	}
+}
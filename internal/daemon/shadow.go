@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/collections"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/store"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/list_linked_entitlements.sql
+	listLinkedEntitlementsQuery string
+
+	//go:embed sql/list_linked_app_entitlements.sql
+	listLinkedAppEntitlementsQuery string
+)
+
+type linkedEntitlement struct {
+	EntitlementId uuid.UUID
+	GuildId       *uint64
+	UserId        *uint64
+	SkuId         uuid.UUID
+	ExpiresAt     *time.Time
+}
+
+type shadowReport struct {
+	OnlyInPrimary []uint64
+	OnlyInShadow  []uint64
+	Mismatched    []uint64
+	WouldCreate   []uint64
+	WouldDelete   []uint64
+}
+
+func (r shadowReport) Diverged() bool {
+	return len(r.OnlyInPrimary) > 0 || len(r.OnlyInShadow) > 0 || len(r.Mismatched) > 0 ||
+		len(r.WouldCreate) > 0 || len(r.WouldDelete) > 0
+}
+
+// compareShadow performs the reconciliation read-only against the shadow database, and reports where its state
+// diverges from the primary database. Nothing is ever written to either database. Only the links synced by this
+// instance are compared, as activeEntitlements only contains this shard's entitlements of this application.
+func (d *Daemon) compareShadow(ctx context.Context, activeEntitlements []entitlement.Entitlement) error {
+	d.logger.Debug("Comparing shadow database against primary")
+
+	primary, err := d.readLinkedEntitlements(ctx, d.db().store)
+	if err != nil {
+		d.logger.Error("Failed to read linked entitlements from primary database", zap.Error(err))
+		return err
+	}
+
+	shadow, err := d.readLinkedEntitlements(ctx, d.db().shadowStore)
+	if err != nil {
+		d.logger.Error("Failed to read linked entitlements from shadow database", zap.Error(err))
+		return err
+	}
+
+	var report shadowReport
+	for discordId, primaryEntitlement := range primary {
+		shadowEntitlement, ok := shadow[discordId]
+		if !ok {
+			report.OnlyInPrimary = append(report.OnlyInPrimary, discordId)
+			continue
+		}
+
+		if !linkedEntitlementsEqual(primaryEntitlement, shadowEntitlement) {
+			report.Mismatched = append(report.Mismatched, discordId)
+		}
+	}
+
+	for discordId := range shadow {
+		if _, ok := primary[discordId]; !ok {
+			report.OnlyInShadow = append(report.OnlyInShadow, discordId)
+		}
+	}
+
+	// Run the reconciliation against the shadow database, without applying any of the changes
+	knownSkus := make(map[uint64]bool)
+	activeEntitlementsSet := collections.NewSet[uint64]()
+	for _, entitlement := range activeEntitlements {
+		if entitlement.Deleted {
+			if _, ok := shadow[entitlement.Id]; ok {
+				report.WouldDelete = append(report.WouldDelete, entitlement.Id)
+			}
+
+			// Added to the set so that it is not reported again as missing below
+			activeEntitlementsSet.Add(entitlement.Id)
+			continue
+		}
+
+		activeEntitlementsSet.Add(entitlement.Id)
+
+		known, ok := knownSkus[entitlement.SkuId]
+		if !ok {
+			sku, err := d.db().shadowStore.GetSku(ctx, entitlement.SkuId)
+			if err != nil {
+				d.logger.Error("Failed to get SKU from shadow database", zap.Uint64("sku_id", entitlement.SkuId), zap.Error(err))
+				return err
+			}
+
+			known = sku != nil
+			knownSkus[entitlement.SkuId] = known
+		}
+
+		if !known {
+			continue
+		}
+
+		if _, ok := shadow[entitlement.Id]; !ok {
+			report.WouldCreate = append(report.WouldCreate, entitlement.Id)
+		}
+	}
+
+	for discordId := range shadow {
+		if !activeEntitlementsSet.Contains(discordId) {
+			report.WouldDelete = append(report.WouldDelete, discordId)
+		}
+	}
+
+	if !report.Diverged() {
+		d.logger.Info("Shadow database is consistent with primary", zap.Int("count", len(primary)))
+		return nil
+	}
+
+	d.logger.Warn(
+		"Shadow database diverges from primary",
+		zap.Int("only_in_primary", len(report.OnlyInPrimary)),
+		zap.Int("only_in_shadow", len(report.OnlyInShadow)),
+		zap.Int("mismatched", len(report.Mismatched)),
+		zap.Int("would_create", len(report.WouldCreate)),
+		zap.Int("would_delete", len(report.WouldDelete)),
+	)
+
+	d.logger.Debug(
+		"Shadow database divergence details",
+		zap.Uint64s("only_in_primary", report.OnlyInPrimary),
+		zap.Uint64s("only_in_shadow", report.OnlyInShadow),
+		zap.Uint64s("mismatched", report.Mismatched),
+		zap.Uint64s("would_create", report.WouldCreate),
+		zap.Uint64s("would_delete", report.WouldDelete),
+	)
+
+	return nil
+}
+
+// readLinkedEntitlements lists the linked entitlements in db that are synced by this instance: those in this shard
+// and, when DISCORD_APPLICATIONS is set, created by this application
+func (d *Daemon) readLinkedEntitlements(ctx context.Context, db store.EntitlementStore) (map[uint64]linkedEntitlement, error) {
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(ctx, "SET TRANSACTION READ ONLY;"); err != nil {
+		return nil, err
+	}
+
+	var rows pgx.Rows
+	if d.config.MultiApplication() {
+		rows, err = tx.Query(ctx, listLinkedAppEntitlementsQuery, d.config.PrimaryApplicationId(), d.config.Discord.ApplicationId)
+	} else {
+		rows, err = tx.Query(ctx, listLinkedEntitlementsQuery)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	linked, err := scanLinkedEntitlements(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.config.ShardCount > 1 {
+		for discordId := range linked {
+			if !d.inShard(discordId) {
+				delete(linked, discordId)
+			}
+		}
+	}
+
+	return linked, nil
+}
+
+func scanLinkedEntitlements(rows pgx.Rows) (map[uint64]linkedEntitlement, error) {
+	defer rows.Close()
+
+	res := make(map[uint64]linkedEntitlement)
+	for rows.Next() {
+		var discordId uint64
+		var entitlement linkedEntitlement
+		if err := rows.Scan(
+			&discordId,
+			&entitlement.EntitlementId,
+			&entitlement.GuildId,
+			&entitlement.UserId,
+			&entitlement.SkuId,
+			&entitlement.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+
+		res[discordId] = entitlement
+	}
+
+	return res, rows.Err()
+}
+
+func linkedEntitlementsEqual(a, b linkedEntitlement) bool {
+	return a.SkuId == b.SkuId &&
+		ptrEqual(a.GuildId, b.GuildId) &&
+		ptrEqual(a.UserId, b.UserId) &&
+		timePtrEqual(a.ExpiresAt, b.ExpiresAt)
+}
+
+func ptrEqual[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func timePtrEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
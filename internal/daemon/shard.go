@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+)
+
+// inShard returns true if the entitlement with the given Discord ID is synced by this instance. Entitlements are
+// assigned to shards by their Discord ID modulo SHARD_COUNT.
+func (d *Daemon) inShard(discordId uint64) bool {
+	return discordId%uint64(d.config.ShardCount) == uint64(d.config.ShardIndex)
+}
+
+// filterShard returns the entitlements that are synced by this instance
+func (d *Daemon) filterShard(entitlements []entitlement.Entitlement) []entitlement.Entitlement {
+	if d.config.ShardCount <= 1 {
+		return entitlements
+	}
+
+	filtered := make([]entitlement.Entitlement, 0, len(entitlements)/d.config.ShardCount+1)
+	for _, entitlement := range entitlements {
+		if d.inShard(entitlement.Id) {
+			filtered = append(filtered, entitlement)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package daemon
+
+import "context"
+
+// listenSignals does nothing on platforms without SIGUSR1
+func (d *Daemon) listenSignals(ctx context.Context) {}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// listenSignals triggers a run whenever the process receives SIGUSR1, e.g. from kill -USR1 <pid>. If a run is in
+// progress, the triggered run starts once it completes.
+func (d *Daemon) listenSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-signals:
+			d.logger.Info("Received SIGUSR1, triggering run")
+			d.Trigger()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"slices"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+)
+
+// SkipReason is the reason an entitlement listed by Discord was not synced
+type SkipReason string
+
+const (
+	SkipReasonUnknownSku    SkipReason = "unknown_sku"
+	SkipReasonFilteredType  SkipReason = "filtered_type"
+	SkipReasonFilteredGuild SkipReason = "filtered_guild"
+	SkipReasonNotStarted    SkipReason = "not_started"
+	SkipReasonTest          SkipReason = "test_entitlement"
+	SkipReasonPurgedUser    SkipReason = "purged_user"
+	SkipReasonNoOwner       SkipReason = "no_owner"
+	SkipReasonLowerTier     SkipReason = "lower_tier"
+)
+
+// skipReason returns the reason that the entitlement should not be synced, if any. Entitlements with an unknown SKU
+// are handled separately, as the SKU must be resolved first.
+func (d *Daemon) skipReason(e entitlement.Entitlement, now time.Time) (SkipReason, bool) {
+	if e.Type == entitlement.TypeTestModePurchase && !d.config.SyncTestEntitlements {
+		return SkipReasonTest, true
+	}
+
+	if slices.Contains(d.config.SkipEntitlementTypes, uint16(e.Type)) {
+		return SkipReasonFilteredType, true
+	}
+
+	if e.GuildId != nil && slices.Contains(d.config.SkipGuildIds, *e.GuildId) {
+		return SkipReasonFilteredGuild, true
+	}
+
+	if d.config.SkipNotStarted && e.StartsAt != nil && e.StartsAt.After(now) {
+		return SkipReasonNotStarted, true
+	}
+
+	if e.UserId != nil && d.isPurgedUser(*e.UserId) {
+		return SkipReasonPurgedUser, true
+	}
+
+	return "", false
+}
+
+// hasOwner returns true if the entitlement has a guild or a user to store it against
+func hasOwner(e entitlement.Entitlement) bool {
+	return (e.GuildId != nil && *e.GuildId != 0) || (e.UserId != nil && *e.UserId != 0)
+}
@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/google/uuid"
+)
+
+//go:embed sql/list_store_skus.sql
+var listStoreSkusQuery string
+
+// skuTypeSubscriptionGroup is the type of SKU that groups subscription SKUs, which never has entitlements of its own
+const skuTypeSubscriptionGroup = 6
+
+// SkuLintReport lists the inconsistencies between discord_store_skus and the SKUs that Discord lists for the
+// application
+type SkuLintReport struct {
+	// Missing are the SKUs listed by Discord that are not mapped, whose entitlements are skipped as unknown
+	Missing []LintedSku
+	// Stale are the mappings of SKUs that Discord no longer lists
+	Stale []LintedSku
+	// Duplicates are the mappings of multiple Discord SKUs to the same internal SKU, which is only correct if the
+	// Discord SKUs are intended to grant the same premium
+	Duplicates []LintedSku
+}
+
+// LintedSku is a Discord SKU, along with the internal SKU it is mapped to, if any
+type LintedSku struct {
+	DiscordId uint64
+	// Name and Type are only known for SKUs that Discord lists
+	Name string
+	Type int
+	// SkuId and Label are only known for SKUs that are mapped
+	SkuId uuid.UUID
+	Label string
+}
+
+// LintSkus compares discord_store_skus against the SKUs that Discord lists for the application
+func (d *Daemon) LintSkus(ctx context.Context) (SkuLintReport, error) {
+	listed, err := d.listDiscordSkus(ctx)
+	if err != nil {
+		return SkuLintReport{}, &DiscordUnavailableError{Err: err}
+	}
+
+	// Prevent the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	rows, err := d.db().pool.Query(ctx, listStoreSkusQuery)
+	if err != nil {
+		return SkuLintReport{}, err
+	}
+
+	defer rows.Close()
+
+	var mapped []LintedSku
+	for rows.Next() {
+		var sku LintedSku
+		if err := rows.Scan(&sku.DiscordId, &sku.SkuId, &sku.Label); err != nil {
+			return SkuLintReport{}, err
+		}
+
+		mapped = append(mapped, sku)
+	}
+
+	if err := rows.Err(); err != nil {
+		return SkuLintReport{}, err
+	}
+
+	return lintSkus(listed, mapped), nil
+}
+
+func lintSkus(listed []discordSku, mapped []LintedSku) SkuLintReport {
+	var report SkuLintReport
+
+	listedById := make(map[uint64]discordSku, len(listed))
+	for _, sku := range listed {
+		listedById[sku.Id] = sku
+	}
+
+	mappedById := make(map[uint64]LintedSku, len(mapped))
+	bySkuId := make(map[uuid.UUID]int)
+	for _, sku := range mapped {
+		mappedById[sku.DiscordId] = sku
+		bySkuId[sku.SkuId]++
+	}
+
+	for _, sku := range listed {
+		if _, ok := mappedById[sku.Id]; !ok && sku.Type != skuTypeSubscriptionGroup {
+			report.Missing = append(report.Missing, LintedSku{DiscordId: sku.Id, Name: sku.Name, Type: sku.Type})
+		}
+	}
+
+	for _, sku := range mapped {
+		discord, ok := listedById[sku.DiscordId]
+		if ok {
+			sku.Name, sku.Type = discord.Name, discord.Type
+		} else {
+			report.Stale = append(report.Stale, sku)
+		}
+
+		if bySkuId[sku.SkuId] > 1 {
+			report.Duplicates = append(report.Duplicates, sku)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//go:embed sql/upsert_sku_metadata.sql
+var upsertSkuMetadataQuery string
+
+// skuMetadata holds the names of the application's SKUs, as last fetched from Discord
+type skuMetadata struct {
+	mu          sync.RWMutex
+	names       map[uint64]string
+	refreshedAt time.Time
+}
+
+func (m *skuMetadata) due(interval time.Duration) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return time.Since(m.refreshedAt) >= interval
+}
+
+func (m *skuMetadata) set(skus []discordSku) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.names = make(map[uint64]string, len(skus))
+	for _, sku := range skus {
+		m.names[sku.Id] = sku.Name
+	}
+
+	m.refreshedAt = time.Now()
+}
+
+// invalidate causes the metadata to be refreshed by the next run, e.g. after switching to a different database
+func (m *skuMetadata) invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshedAt = time.Time{}
+}
+
+func (m *skuMetadata) name(skuId uint64) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name, ok := m.names[skuId]
+	return name, ok
+}
+
+// SkuNames returns the name of each of the application's SKUs by Discord SKU ID, if SKU_METADATA_ENABLED is set
+func (d *Daemon) SkuNames() map[uint64]string {
+	d.skuMetadata.mu.RLock()
+	defer d.skuMetadata.mu.RUnlock()
+
+	names := make(map[uint64]string, len(d.skuMetadata.names))
+	for skuId, name := range d.skuMetadata.names {
+		names[skuId] = name
+	}
+
+	return names
+}
+
+// refreshSkuMetadata fetches the application's SKUs from Discord and stores their metadata in the
+// discord_sku_metadata table, at most once per SKU_METADATA_REFRESH_INTERVAL. Failures are logged rather than failing
+// the run, as the metadata is only informational. Prices are not stored, as Discord's SKU object does not include
+// them, and the store listing that does is not available to bots.
+func (d *Daemon) refreshSkuMetadata(ctx context.Context) {
+	if !d.config.SkuMetadata.Enabled || !d.skuMetadata.due(d.config.SkuMetadata.RefreshInterval) {
+		return
+	}
+
+	skus, err := d.listDiscordSkus(ctx)
+	if err != nil {
+		d.fetchLogger.Warn("Failed to fetch SKU metadata", zap.Error(err))
+		return
+	}
+
+	discordIds := make([]uint64, len(skus))
+	names := make([]string, len(skus))
+	slugs := make([]string, len(skus))
+	types := make([]int16, len(skus))
+	flags := make([]int32, len(skus))
+	for i, sku := range skus {
+		discordIds[i] = sku.Id
+		names[i] = sku.Name
+		slugs[i] = sku.Slug
+		types[i] = int16(sku.Type)
+		flags[i] = int32(sku.Flags)
+	}
+
+	if _, err := d.db().pool.Exec(ctx, upsertSkuMetadataQuery, discordIds, names, slugs, types, flags); err != nil {
+		d.logger.Warn("Failed to store SKU metadata", zap.Error(err))
+		return
+	}
+
+	d.skuMetadata.set(skus)
+	d.logger.Debug("Refreshed SKU metadata", zap.Int("count", len(skus)))
+}
+
+// skuNameFields returns the name of the Discord SKU as a log field, if known
+func (d *Daemon) skuNameFields(skuId uint64) []zap.Field {
+	if name, ok := d.skuMetadata.name(skuId); ok {
+		return []zap.Field{zap.String("sku_name", name)}
+	}
+
+	return nil
+}
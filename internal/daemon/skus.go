@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"go.uber.org/zap"
+)
+
+// resolveSkus looks up the internal SKU for each Discord SKU referenced by the entitlements. SKUs that are not cached
+// are looked up in a single query. Discord SKUs that are not mapped in discord_store_skus are omitted from the result.
+func (d *Daemon) resolveSkus(ctx context.Context, entitlements []entitlement.Entitlement) (map[uint64]model.Sku, error) {
+	skus := make(map[uint64]model.Sku)
+	checked := make(map[uint64]struct{})
+
+	d.skuCache.expire(d.config.SkuCacheTtl)
+
+	var uncached []uint64
+	for _, entitlement := range entitlements {
+		if _, ok := checked[entitlement.SkuId]; ok {
+			continue
+		}
+
+		checked[entitlement.SkuId] = struct{}{}
+
+		if sku, ok := d.skuCache.get(entitlement.SkuId); ok {
+			skus[entitlement.SkuId] = sku
+		} else if !d.skuCache.isUnknown(entitlement.SkuId, d.config.UnknownSkuCacheTtl) {
+			uncached = append(uncached, entitlement.SkuId)
+		}
+	}
+
+	if len(uncached) == 0 {
+		return skus, nil
+	}
+
+	resolved, err := d.readStore().GetSkus(ctx, uncached)
+	if err != nil {
+		d.logger.Error("Failed to get SKU IDs", zap.Int("count", len(uncached)), zap.Error(err))
+		return nil, err
+	}
+
+	for _, skuId := range uncached {
+		sku, ok := resolved[skuId]
+		if !ok {
+			d.skuCache.markUnknown(skuId)
+			d.recordError(&UnknownSkuError{SkuId: skuId})
+			d.logger.Debug("Sku not found in discord_store_skus", zap.Uint64("sku_id", skuId))
+			continue
+		}
+
+		if d.skuCache.put(skuId, sku) {
+			d.logger.Info("Previously unknown SKU has been mapped, invalidated SKU cache", zap.Uint64("sku_id", skuId))
+		}
+
+		skus[skuId] = sku
+	}
+
+	return skus, nil
+}
+
+// lookupSku returns the internal SKU of a Discord SKU from the SKU cache or discord_store_skus, or nil if the
+// Discord SKU is not mapped
+func (d *Daemon) lookupSku(ctx context.Context, skuId uint64) (*model.Sku, error) {
+	if sku, ok := d.skuCache.get(skuId); ok {
+		return &sku, nil
+	}
+
+	if d.skuCache.isUnknown(skuId, d.config.UnknownSkuCacheTtl) {
+		return nil, nil
+	}
+
+	sku, err := d.readStore().GetSku(ctx, skuId)
+	if err != nil {
+		d.logger.Error("Failed to get SKU ID", zap.Uint64("sku_id", skuId), zap.Error(err))
+		return nil, err
+	}
+
+	if sku == nil {
+		d.skuCache.markUnknown(skuId)
+		return nil, nil
+	}
+
+	if d.skuCache.put(skuId, *sku) {
+		d.logger.Info("Previously unknown SKU has been mapped, invalidated SKU cache", zap.Uint64("sku_id", skuId))
+	}
+
+	return sku, nil
+}
+
+// skuCache holds the internal SKU of each Discord SKU across runs in daemon mode, as discord_store_skus rarely
+// changes. The cache is dropped after SKU_CACHE_TTL, or as soon as a previously unknown SKU resolves, as that
+// indicates the table has been edited. Unknown SKUs are only looked up again once UNKNOWN_SKU_CACHE_TTL has passed,
+// or the cache is dropped, e.g. by the SKU listener when the table changes.
+type skuCache struct {
+	mu   sync.Mutex
+	skus map[uint64]model.Sku
+	// unknown holds when each unknown SKU was last looked up
+	unknown  map[uint64]time.Time
+	loadedAt time.Time
+}
+
+// expire drops the cache if it is older than ttl. If ttl is 0, caching is disabled and the cache is always dropped.
+func (c *skuCache) expire(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= 0 || time.Since(c.loadedAt) >= ttl {
+		c.reset()
+	}
+}
+
+func (c *skuCache) get(skuId uint64) (model.Sku, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sku, ok := c.skus[skuId]
+	return sku, ok
+}
+
+// put caches the SKU, returning true if the SKU was previously unknown, in which case the rest of the cache has been
+// dropped. SKUs already served from the cache during the current run are not refetched.
+func (c *skuCache) put(skuId uint64, sku model.Sku) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, wasUnknown := c.unknown[skuId]
+	if wasUnknown {
+		c.reset()
+	}
+
+	c.skus[skuId] = sku
+	return wasUnknown
+}
+
+func (c *skuCache) markUnknown(skuId uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unknown[skuId] = time.Now()
+}
+
+// isUnknown returns true if the SKU was found to be unknown less than ttl ago
+func (c *skuCache) isUnknown(skuId uint64, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lookedUpAt, ok := c.unknown[skuId]
+	return ok && time.Since(lookedUpAt) < ttl
+}
+
+// invalidate drops the cache, e.g. after switching to a different database
+func (c *skuCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reset()
+}
+
+func (c *skuCache) reset() {
+	c.skus = make(map[uint64]model.Sku)
+	c.unknown = make(map[uint64]time.Time)
+	c.loadedAt = time.Now()
+}
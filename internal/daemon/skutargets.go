@@ -0,0 +1,205 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+//go:embed sql/list_sku_flags.sql
+var listSkuFlagsQuery string
+
+// SKU flags, see https://discord.com/developers/docs/resources/sku#sku-object-sku-flags
+const (
+	skuFlagGuildSubscription uint32 = 1 << 7
+	skuFlagUserSubscription  uint32 = 1 << 8
+)
+
+// skuTarget is whether the entitlements of a SKU belong to a guild or a user
+type skuTarget uint8
+
+const (
+	// skuTargetBoth stores both the guild and user of the entitlement, as Discord lists them
+	skuTargetBoth skuTarget = iota
+	skuTargetGuild
+	skuTargetUser
+)
+
+func targetFromFlags(flags uint32) skuTarget {
+	switch {
+	case flags&skuFlagGuildSubscription != 0:
+		return skuTargetGuild
+	case flags&skuFlagUserSubscription != 0:
+		return skuTargetUser
+	default:
+		return skuTargetBoth
+	}
+}
+
+// apply returns the guild and user IDs to store for the entitlement. If the entitlement does not have the ID that the
+// SKU targets, both IDs are returned unchanged.
+func (t skuTarget) apply(e entitlement.Entitlement) (guildId, userId *uint64) {
+	switch {
+	case t == skuTargetGuild && e.GuildId != nil:
+		return e.GuildId, nil
+	case t == skuTargetUser && e.UserId != nil:
+		return nil, e.UserId
+	default:
+		return e.GuildId, e.UserId
+	}
+}
+
+// matches returns true if the entitlement has the ID that the SKU targets
+func (t skuTarget) matches(e entitlement.Entitlement) bool {
+	switch t {
+	case skuTargetGuild:
+		return e.GuildId != nil
+	case skuTargetUser:
+		return e.UserId != nil
+	default:
+		return true
+	}
+}
+
+// resolveSkuTargets returns the target of each of the given Discord SKUs, read from SKU_TARGET_SOURCE. SKUs whose
+// flags are not known are omitted, and treated as skuTargetBoth.
+func (d *Daemon) resolveSkuTargets(ctx context.Context, tx pgx.Tx, skus map[uint64]model.Sku) (map[uint64]skuTarget, error) {
+	switch d.config.SkuTargetSource {
+	case config.SkuTargetSourceDiscord:
+		return d.skuTargets.get(d.config.SkuCacheTtl, skus, func() (map[uint64]uint32, error) {
+			return d.fetchSkuFlags(ctx)
+		})
+	case config.SkuTargetSourceDatabase:
+		return d.readSkuFlags(ctx, tx, skus)
+	default:
+		return nil, nil
+	}
+}
+
+type discordSku struct {
+	Id    uint64 `json:"id,string"`
+	Type  int    `json:"type"`
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Flags uint32 `json:"flags"`
+}
+
+// listDiscordSkus lists all the application's SKUs from Discord
+func (d *Daemon) listDiscordSkus(ctx context.Context) ([]discordSku, error) {
+	endpoint := request.Endpoint{
+		RequestType: request.GET,
+		ContentType: request.Nil,
+		Endpoint:    fmt.Sprintf("/applications/%d/skus", d.config.Discord.ApplicationId),
+	}
+
+	authorization, err := d.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var skus []discordSku
+	if err, _ := endpoint.Request(ctx, authorization, nil, &skus); err != nil {
+		return nil, err
+	}
+
+	return skus, nil
+}
+
+// fetchSkuFlags lists the flags of all the application's SKUs from Discord
+func (d *Daemon) fetchSkuFlags(ctx context.Context) (map[uint64]uint32, error) {
+	skus, err := d.listDiscordSkus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[uint64]uint32, len(skus))
+	for _, sku := range skus {
+		flags[sku.Id] = sku.Flags
+	}
+
+	d.fetchLogger.Debug("Fetched SKU flags", zap.Int("count", len(flags)))
+	return flags, nil
+}
+
+func (d *Daemon) readSkuFlags(ctx context.Context, tx pgx.Tx, skus map[uint64]model.Sku) (map[uint64]skuTarget, error) {
+	skuIds := make([]uint64, 0, len(skus))
+	for skuId := range skus {
+		skuIds = append(skuIds, skuId)
+	}
+
+	rows, err := tx.Query(ctx, listSkuFlagsQuery, skuIds)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	targets := make(map[uint64]skuTarget, len(skuIds))
+	for rows.Next() {
+		var (
+			skuId uint64
+			flags int32
+		)
+
+		if err := rows.Scan(&skuId, &flags); err != nil {
+			return nil, err
+		}
+
+		targets[skuId] = targetFromFlags(uint32(flags))
+	}
+
+	return targets, rows.Err()
+}
+
+// skuTargetCache holds the targets of the SKUs fetched from Discord across runs. The SKUs are refetched after
+// SKU_CACHE_TTL, or when a SKU that is not in the cache is needed, e.g. because it was created since the last fetch.
+type skuTargetCache struct {
+	mu       sync.Mutex
+	targets  map[uint64]skuTarget
+	loadedAt time.Time
+}
+
+func (c *skuTargetCache) get(ttl time.Duration, skus map[uint64]model.Sku, fetch func() (map[uint64]uint32, error)) (map[uint64]skuTarget, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stale := c.targets == nil || ttl <= 0 || time.Since(c.loadedAt) >= ttl
+	for skuId := range skus {
+		if _, ok := c.targets[skuId]; !ok {
+			stale = true
+			break
+		}
+	}
+
+	if stale {
+		flags, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		c.targets = make(map[uint64]skuTarget, len(flags))
+		for skuId, skuFlags := range flags {
+			c.targets[skuId] = targetFromFlags(skuFlags)
+		}
+
+		c.loadedAt = time.Now()
+	}
+
+	targets := make(map[uint64]skuTarget, len(skus))
+	for skuId := range skus {
+		if target, ok := c.targets[skuId]; ok {
+			targets[skuId] = target
+		}
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+)
+
+type pageHash [sha256.Size]byte
+
+func hashPage(page []entitlement.Entitlement) pageHash {
+	// Entitlements always encode, so the error can be ignored
+	encoded, _ := json.Marshal(page)
+	return sha256.Sum256(encoded)
+}
+
+// fetchSnapshot holds the page hashes of the last full run that found the database in sync with Discord, so that
+// scheduled runs can skip reconciliation while Discord lists exactly the same entitlements, see SNAPSHOT_REUSE_ENABLED
+type fetchSnapshot struct {
+	mu      sync.Mutex
+	pages   []pageHash
+	flags   runFlags
+	takenAt time.Time
+}
+
+// matches returns true if the pages and flags are the same as those of the snapshot, and the snapshot was taken
+// less than maxAge ago
+func (s *fetchSnapshot) matches(pages []pageHash, flags runFlags, maxAge time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pages != nil && s.flags == flags && time.Since(s.takenAt) < maxAge && slices.Equal(s.pages, pages)
+}
+
+func (s *fetchSnapshot) store(pages []pageHash, flags runFlags) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pages = pages
+	s.flags = flags
+	s.takenAt = time.Now()
+}
+
+// invalidate drops the snapshot, so that the next run reconciles, e.g. after switching to a different database
+func (s *fetchSnapshot) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pages = nil
+}
+
+type snapshotReuseKey struct{}
+
+// withSnapshotReuse allows the run to skip reconciliation if the fetched entitlements match the snapshot. Only
+// scheduled runs reuse the snapshot, so that a run that has been explicitly requested always reconciles.
+func withSnapshotReuse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, snapshotReuseKey{}, true)
+}
+
+// canReuseSnapshot returns true if the run may skip reconciliation because the fetched pages match the snapshot
+func (d *Daemon) canReuseSnapshot(ctx context.Context, pages []pageHash, flags runFlags) bool {
+	if !d.config.SnapshotReuse.Enabled || pages == nil {
+		return false
+	}
+
+	if reuse, _ := ctx.Value(snapshotReuseKey{}).(bool); !reuse {
+		return false
+	}
+
+	return d.snapshot.matches(pages, flags, d.config.SnapshotReuse.MaxAge)
+}
+
+// updateSnapshot records the pages fetched by a full run that has applied its plan. The snapshot is only kept if the
+// plan contained no changes, as otherwise the next run may have work to do even if Discord lists the same
+// entitlements, e.g. deletions whose grace period has elapsed.
+func (d *Daemon) updateSnapshot(pages []pageHash, flags runFlags, p plan, summary RunSummary) {
+	if !d.config.SnapshotReuse.Enabled {
+		return
+	}
+
+	if pages == nil || summary.DryRun || summary.ReadOnly || !p.inSync() {
+		d.snapshot.invalidate()
+		return
+	}
+
+	d.snapshot.store(pages, flags)
+}
+
+// inSync returns true if the plan makes no changes other than refreshing existing entitlements, and withholds none
+func (p plan) inSync() bool {
+	return p.NewCreations() == 0 &&
+		len(p.Deletions) == 0 &&
+		len(p.MissingDeletions) == 0 &&
+		p.BlockedDeletions == 0 &&
+		p.DeferredDeletions == 0 &&
+		len(p.Pending) == 0 &&
+		p.PausedDeletions == 0 &&
+		len(p.Quarantined) == 0 &&
+		len(p.UnknownSkus) == 0 &&
+		len(p.Ownerless) == 0
+}
@@ -0,0 +1,5 @@
+INSERT INTO sync_leases(name, holder, acquired_at, expires_at)
+VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+ON CONFLICT ("name") DO UPDATE SET "holder" = $2, "acquired_at" = NOW(), "expires_at" = NOW() + make_interval(secs => $3)
+WHERE sync_leases."expires_at" < NOW()
+RETURNING "holder";
\ No newline at end of file
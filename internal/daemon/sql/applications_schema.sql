@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS discord_entitlement_applications
+(
+    discord_id     int8        NOT NULL PRIMARY KEY,
+    application_id int8        NOT NULL,
+    created_at     timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS discord_entitlement_applications_application_id ON discord_entitlement_applications (application_id);
\ No newline at end of file
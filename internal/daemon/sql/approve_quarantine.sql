@@ -0,0 +1,4 @@
+UPDATE deletion_quarantine
+SET "approved_at" = NOW()
+WHERE "approved_at" IS NULL
+AND ($1::int8[] IS NULL OR "discord_id" = ANY($1));
\ No newline at end of file
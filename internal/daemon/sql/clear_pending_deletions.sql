@@ -0,0 +1,8 @@
+DELETE FROM pending_deletions
+WHERE "discord_id" = ANY($1)
+OR NOT EXISTS (
+    SELECT 1
+    FROM discord_entitlements
+    WHERE discord_entitlements.discord_id = pending_deletions.discord_id
+    AND discord_entitlements.entitlement_id = pending_deletions.entitlement_id
+);
\ No newline at end of file
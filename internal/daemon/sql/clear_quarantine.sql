@@ -0,0 +1,8 @@
+DELETE FROM deletion_quarantine
+WHERE "discord_id" = ANY($1)
+OR NOT EXISTS (
+    SELECT 1
+    FROM discord_entitlements
+    WHERE discord_entitlements.discord_id = deletion_quarantine.discord_id
+    AND discord_entitlements.entitlement_id = deletion_quarantine.entitlement_id
+);
\ No newline at end of file
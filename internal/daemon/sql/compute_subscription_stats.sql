@@ -0,0 +1,18 @@
+WITH counts AS (
+    SELECT sku_id, SUM(created) AS created, SUM(deleted) AS deleted
+    FROM entitlement_daily_counts
+    WHERE day >= $2::date AND day < $3::date
+    GROUP BY sku_id
+),
+active AS (
+    SELECT entitlements.sku_id, COUNT(*) AS active
+    FROM entitlements
+    INNER JOIN discord_entitlements ON discord_entitlements.entitlement_id = entitlements.id
+    WHERE entitlements.expires_at IS NULL OR entitlements.expires_at >= $3::date
+    GROUP BY entitlements.sku_id
+)
+INSERT INTO subscription_stats(period, period_start, period_end, sku_id, new_subscriptions, cancellations, active)
+SELECT $1::text, $2::date, $3::date, COALESCE(counts.sku_id, active.sku_id), COALESCE(counts.created, 0), COALESCE(counts.deleted, 0), COALESCE(active.active, 0)
+FROM counts
+FULL OUTER JOIN active ON active.sku_id = counts.sku_id
+ON CONFLICT (period, period_start, sku_id) DO NOTHING
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT COUNT(*)
+FROM entitlement_undo_log
+WHERE "run_id" = $1 AND "restored_at" IS NULL;
\ No newline at end of file
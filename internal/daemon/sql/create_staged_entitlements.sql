@@ -0,0 +1,5 @@
+CREATE TEMPORARY TABLE staged_entitlements
+(
+    discord_id int8 NOT NULL,
+    PRIMARY KEY (discord_id)
+) ON COMMIT DROP;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS entitlement_dead_letters
+(
+    discord_id int8        NOT NULL,
+    sku_id     UUID        NOT NULL,
+    guild_id   int8,
+    user_id    int8,
+    error      TEXT        NOT NULL,
+    attempts   int4        NOT NULL DEFAULT 1,
+    failed_at  timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (discord_id)
+);
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS entitlement_ids
+(
+    discord_id     int8        NOT NULL PRIMARY KEY,
+    entitlement_id UUID        NOT NULL,
+    updated_at     timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS entitlement_ids_entitlement_id ON entitlement_ids (entitlement_id);
+
+INSERT INTO entitlement_ids(discord_id, entitlement_id)
+SELECT discord_id, entitlement_id FROM discord_entitlements
+ON CONFLICT ("discord_id") DO NOTHING;
\ No newline at end of file
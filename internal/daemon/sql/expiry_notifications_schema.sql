@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS entitlement_expiry_notifications
+(
+    entitlement_id UUID        NOT NULL,
+    expires_at     timestamptz NOT NULL,
+    notified_at    timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (entitlement_id, expires_at),
+    FOREIGN KEY (entitlement_id) REFERENCES entitlements (id) ON DELETE CASCADE
+);
\ No newline at end of file
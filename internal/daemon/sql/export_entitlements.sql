@@ -0,0 +1,7 @@
+SELECT entitlements.id, entitlements.guild_id, entitlements.user_id, entitlements.sku_id, skus.label, entitlements.expires_at, discord_entitlements.discord_id
+FROM entitlements
+INNER JOIN skus ON skus.id = entitlements.sku_id
+LEFT JOIN discord_entitlements ON discord_entitlements.entitlement_id = entitlements.id
+WHERE entitlements.source = $3
+AND (entitlements.user_id = $1 OR entitlements.guild_id = $2)
+ORDER BY entitlements.id;
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT "discord_id", "guild_id", "updated_at"
+FROM entitlement_guild_overrides
+WHERE "discord_id" = ANY($1)
+ORDER BY "discord_id";
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT "discord_id", "entitlement_id", "first_seen_at"
+FROM pending_deletions
+WHERE "entitlement_id" = ANY($1)
+ORDER BY "discord_id";
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT "discord_id", "entitlement_id", "quarantined_at", "approved_at"
+FROM deletion_quarantine
+WHERE "entitlement_id" = ANY($1)
+ORDER BY "discord_id";
\ No newline at end of file
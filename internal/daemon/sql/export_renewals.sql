@@ -0,0 +1,4 @@
+SELECT "run_id", "entitlement_id", "discord_id", "guild_id", "user_id", "sku_id", "previous_expires_at", "expires_at", "renewed_at"
+FROM entitlement_renewals
+WHERE "user_id" = $1 OR "guild_id" = $2
+ORDER BY "renewed_at";
\ No newline at end of file
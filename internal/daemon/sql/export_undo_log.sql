@@ -0,0 +1,4 @@
+SELECT "run_id", "entitlement_id", "discord_id", "guild_id", "user_id", "sku_id", "expires_at", "deleted_at", "restored_at"
+FROM entitlement_undo_log
+WHERE ("user_id" = $1 OR "guild_id" = $2) AND "source" = $3
+ORDER BY "deleted_at";
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT "purged_at", "entitlements"
+FROM user_purges
+WHERE "user_hash" = $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT "holder", "expires_at"
+FROM sync_leases
+WHERE "name" = $1;
\ No newline at end of file
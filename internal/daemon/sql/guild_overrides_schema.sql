@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS entitlement_guild_overrides
+(
+    discord_id int8        NOT NULL,
+    guild_id   int8        NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (discord_id),
+    FOREIGN KEY (discord_id) REFERENCES discord_entitlements (discord_id) ON DELETE CASCADE
+);
\ No newline at end of file
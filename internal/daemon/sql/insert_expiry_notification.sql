@@ -0,0 +1,3 @@
+INSERT INTO entitlement_expiry_notifications(entitlement_id, expires_at)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS sync_leases
+(
+    name        TEXT        NOT NULL,
+    holder      TEXT        NOT NULL,
+    acquired_at timestamptz NOT NULL,
+    expires_at  timestamptz NOT NULL,
+    PRIMARY KEY (name)
+);
\ No newline at end of file
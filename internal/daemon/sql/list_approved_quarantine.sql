@@ -0,0 +1,3 @@
+SELECT "discord_id", "entitlement_id"
+FROM deletion_quarantine
+WHERE "approved_at" IS NOT NULL;
\ No newline at end of file
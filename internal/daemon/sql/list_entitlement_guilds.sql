@@ -0,0 +1,4 @@
+SELECT "id", "guild_id", "sku_id", "expires_at"
+FROM entitlements
+WHERE "id" = ANY($1)
+AND "guild_id" IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,10 @@
+SELECT entitlements.id, discord_entitlements.discord_id, entitlements.guild_id, entitlements.user_id, entitlements.sku_id, skus.label, entitlements.expires_at
+FROM entitlements
+INNER JOIN discord_entitlements ON discord_entitlements.entitlement_id = entitlements.id
+INNER JOIN skus ON skus.id = entitlements.sku_id
+LEFT JOIN entitlement_expiry_notifications
+    ON entitlement_expiry_notifications.entitlement_id = entitlements.id
+    AND entitlement_expiry_notifications.expires_at = entitlements.expires_at
+WHERE entitlements.expires_at > NOW()
+  AND entitlements.expires_at <= NOW() + make_interval(secs => $1)
+  AND entitlement_expiry_notifications.entitlement_id IS NULL
\ No newline at end of file
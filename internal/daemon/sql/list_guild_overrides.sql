@@ -0,0 +1,3 @@
+SELECT "discord_id", "guild_id"
+FROM entitlement_guild_overrides
+WHERE "discord_id" = ANY($1);
\ No newline at end of file
@@ -0,0 +1,5 @@
+SELECT discord_entitlements.discord_id, entitlements.id, entitlements.guild_id, entitlements.user_id, entitlements.sku_id, entitlements.expires_at
+FROM discord_entitlements
+INNER JOIN entitlements ON entitlements.id = discord_entitlements.entitlement_id
+LEFT JOIN discord_entitlement_applications apps ON apps.discord_id = discord_entitlements.discord_id
+WHERE COALESCE(apps.application_id, $1) = $2;
\ No newline at end of file
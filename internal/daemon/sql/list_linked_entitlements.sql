@@ -0,0 +1,3 @@
+SELECT discord_entitlements.discord_id, entitlements.id, entitlements.guild_id, entitlements.user_id, entitlements.sku_id, entitlements.expires_at
+FROM discord_entitlements
+INNER JOIN entitlements ON entitlements.id = discord_entitlements.entitlement_id;
@@ -0,0 +1,6 @@
+SELECT discord_entitlements.discord_id, discord_entitlements.entitlement_id, entitlements.sku_id
+FROM discord_entitlements
+LEFT JOIN entitlements ON entitlements.id = discord_entitlements.entitlement_id
+WHERE discord_entitlements.discord_id > $1
+ORDER BY discord_entitlements.discord_id
+LIMIT $2;
\ No newline at end of file
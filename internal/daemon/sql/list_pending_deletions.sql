@@ -0,0 +1,3 @@
+SELECT "discord_id", "entitlement_id", "first_seen_at" <= NOW() - make_interval(secs => $2)
+FROM pending_deletions
+WHERE "discord_id" = ANY($1);
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT "discord_id", "entitlement_id", "quarantined_at", "approved_at"
+FROM deletion_quarantine
+ORDER BY "quarantined_at", "discord_id";
\ No newline at end of file
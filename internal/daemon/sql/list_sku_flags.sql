@@ -0,0 +1,3 @@
+SELECT "discord_id", "flags"
+FROM discord_sku_flags
+WHERE "discord_id" = ANY($1);
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT staged_entitlements.discord_id, discord_entitlements.entitlement_id
+FROM staged_entitlements
+INNER JOIN discord_entitlements ON discord_entitlements.discord_id = staged_entitlements.discord_id;
\ No newline at end of file
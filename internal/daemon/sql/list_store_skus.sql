@@ -0,0 +1,4 @@
+SELECT discord_store_skus.discord_id, discord_store_skus.sku_id, skus.label
+FROM discord_store_skus
+INNER JOIN skus ON skus.id = discord_store_skus.sku_id
+ORDER BY discord_store_skus.discord_id;
\ No newline at end of file
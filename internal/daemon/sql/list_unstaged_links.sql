@@ -0,0 +1,20 @@
+WITH missing AS (
+    SELECT discord_entitlements.discord_id,
+           discord_entitlements.entitlement_id,
+           entitlements.sku_id,
+           COUNT(*) OVER () AS total,
+           COUNT(*) OVER (PARTITION BY entitlements.sku_id) AS sku_total,
+           ROW_NUMBER() OVER (PARTITION BY entitlements.sku_id ORDER BY discord_entitlements.discord_id) AS sku_row
+    FROM discord_entitlements
+    LEFT JOIN entitlements ON entitlements.id = discord_entitlements.entitlement_id
+    WHERE discord_entitlements.discord_id % $2 = $3
+    AND NOT EXISTS (
+        SELECT 1
+        FROM staged_entitlements
+        WHERE staged_entitlements.discord_id = discord_entitlements.discord_id
+    )
+)
+SELECT discord_id, entitlement_id, sku_id, total, sku_total
+FROM missing
+WHERE sku_row <= $1
+ORDER BY discord_id;
\ No newline at end of file
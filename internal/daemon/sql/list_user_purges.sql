@@ -0,0 +1,2 @@
+SELECT "user_hash"
+FROM user_purges;
\ No newline at end of file
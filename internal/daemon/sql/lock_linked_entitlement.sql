@@ -0,0 +1,5 @@
+SELECT entitlements.id, entitlements.user_id
+FROM discord_entitlements
+INNER JOIN entitlements ON entitlements.id = discord_entitlements.entitlement_id
+WHERE discord_entitlements.discord_id = $1
+FOR UPDATE OF entitlements;
\ No newline at end of file
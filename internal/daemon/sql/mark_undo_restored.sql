@@ -0,0 +1,3 @@
+UPDATE entitlement_undo_log
+SET "restored_at" = NOW()
+WHERE "run_id" = $1 AND "restored_at" IS NULL;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS pending_deletions
+(
+    discord_id     int8        NOT NULL,
+    entitlement_id UUID        NOT NULL,
+    first_seen_at  timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (discord_id)
+);
\ No newline at end of file
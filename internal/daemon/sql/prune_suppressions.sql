@@ -0,0 +1,3 @@
+DELETE FROM entitlement_suppressions
+WHERE NOT ("discord_id" = ANY($1))
+AND "application_id" IN ($2, 0)
\ No newline at end of file
@@ -0,0 +1,2 @@
+DELETE FROM entitlement_undo_log
+WHERE "deleted_at" < NOW() - make_interval(secs => $1);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DELETE FROM entitlement_ids
+USING entitlements
+WHERE entitlement_ids.entitlement_id = entitlements.id
+AND entitlements."user_id" = $1 AND entitlements."source" = $2;
\ No newline at end of file
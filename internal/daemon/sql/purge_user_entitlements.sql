@@ -0,0 +1,2 @@
+DELETE FROM entitlements
+WHERE "user_id" = $1 AND "source" = $2;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DELETE FROM pending_deletions
+WHERE "entitlement_id" IN (
+    SELECT "id"
+    FROM entitlements
+    WHERE "user_id" = $1 AND "source" = $2
+);
\ No newline at end of file
@@ -0,0 +1,6 @@
+DELETE FROM deletion_quarantine
+WHERE "entitlement_id" IN (
+    SELECT "id"
+    FROM entitlements
+    WHERE "user_id" = $1 AND "source" = $2
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DELETE FROM entitlement_renewals
+WHERE "user_id" = $1;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DELETE FROM entitlement_undo_log
+WHERE "user_id" = $1 AND "source" = $2;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS deletion_quarantine
+(
+    discord_id     int8        NOT NULL,
+    entitlement_id UUID        NOT NULL,
+    quarantined_at timestamptz NOT NULL DEFAULT NOW(),
+    approved_at    timestamptz DEFAULT NULL,
+    PRIMARY KEY (discord_id)
+);
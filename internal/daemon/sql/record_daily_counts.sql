@@ -0,0 +1,5 @@
+INSERT INTO entitlement_daily_counts(day, sku_id, created, deleted)
+SELECT (NOW() AT TIME ZONE 'UTC')::date, counts.sku_id, counts.created, counts.deleted
+FROM unnest($1::uuid[], $2::int4[], $3::int4[]) AS counts(sku_id, created, deleted)
+ON CONFLICT (day, sku_id) DO UPDATE SET "created" = entitlement_daily_counts."created" + EXCLUDED."created",
+                                        "deleted" = entitlement_daily_counts."deleted" + EXCLUDED."deleted";
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO user_purges(user_hash, entitlements)
+VALUES ($1, $2)
+ON CONFLICT ("user_hash") DO UPDATE SET "purged_at" = NOW(), "entitlements" = user_purges."entitlements" + EXCLUDED."entitlements";
\ No newline at end of file
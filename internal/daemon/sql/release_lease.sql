@@ -0,0 +1,2 @@
+DELETE FROM sync_leases
+WHERE "name" = $1 AND "holder" = $2;
\ No newline at end of file
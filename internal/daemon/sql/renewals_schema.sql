@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS entitlement_renewals
+(
+    run_id              UUID        NOT NULL,
+    entitlement_id      UUID        NOT NULL,
+    discord_id          int8        NOT NULL,
+    guild_id            int8,
+    user_id             int8,
+    sku_id              UUID        NOT NULL,
+    previous_expires_at timestamptz NOT NULL,
+    expires_at          timestamptz NOT NULL,
+    renewed_at          timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS entitlement_renewals_renewed_at ON entitlement_renewals (renewed_at);
+CREATE INDEX IF NOT EXISTS entitlement_renewals_user_id ON entitlement_renewals (user_id);
+CREATE INDEX IF NOT EXISTS entitlement_renewals_guild_id ON entitlement_renewals (guild_id);
\ No newline at end of file
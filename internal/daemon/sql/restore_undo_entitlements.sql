@@ -0,0 +1,5 @@
+INSERT INTO entitlements(id, guild_id, user_id, sku_id, source, expires_at)
+SELECT DISTINCT ON (entitlement_id) entitlement_id, guild_id, user_id, sku_id, source, expires_at
+FROM entitlement_undo_log
+WHERE "run_id" = $1 AND "restored_at" IS NULL
+ON CONFLICT DO NOTHING;
\ No newline at end of file
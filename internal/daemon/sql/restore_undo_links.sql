@@ -0,0 +1,8 @@
+INSERT INTO discord_entitlements(discord_id, entitlement_id)
+SELECT entitlement_undo_log.discord_id, entitlement_undo_log.entitlement_id
+FROM entitlement_undo_log
+INNER JOIN entitlements ON entitlements.id = entitlement_undo_log.entitlement_id
+WHERE entitlement_undo_log.run_id = $1
+AND entitlement_undo_log.restored_at IS NULL
+AND entitlement_undo_log.discord_id IS NOT NULL
+ON CONFLICT ("discord_id") DO UPDATE SET "entitlement_id" = EXCLUDED."entitlement_id";
\ No newline at end of file
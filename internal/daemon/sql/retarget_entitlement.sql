@@ -0,0 +1,3 @@
+UPDATE entitlements
+SET "guild_id" = $2
+WHERE "id" = $1;
\ No newline at end of file
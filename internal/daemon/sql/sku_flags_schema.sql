@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS discord_sku_flags
+(
+    discord_id int8 NOT NULL,
+    flags      int4 NOT NULL,
+    PRIMARY KEY (discord_id)
+);
\ No newline at end of file
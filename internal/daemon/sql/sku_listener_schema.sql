@@ -0,0 +1,11 @@
+CREATE OR REPLACE FUNCTION notify_discord_store_skus_changed() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM pg_notify('discord_store_skus_changed', NEW.discord_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER discord_store_skus_changed
+AFTER INSERT OR UPDATE ON discord_store_skus
+FOR EACH ROW EXECUTE FUNCTION notify_discord_store_skus_changed();
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS discord_sku_metadata
+(
+    discord_id int8        NOT NULL,
+    name       TEXT        NOT NULL,
+    slug       TEXT        NOT NULL,
+    type       int2        NOT NULL,
+    flags      int4        NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (discord_id)
+);
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS entitlement_daily_counts
+(
+    day     date NOT NULL,
+    sku_id  UUID NOT NULL,
+    created int4 NOT NULL DEFAULT 0,
+    deleted int4 NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, sku_id)
+);
+
+CREATE TABLE IF NOT EXISTS subscription_stats
+(
+    period            TEXT        NOT NULL,
+    period_start      date        NOT NULL,
+    period_end        date        NOT NULL,
+    sku_id            UUID        NOT NULL,
+    new_subscriptions int4        NOT NULL,
+    cancellations     int4        NOT NULL,
+    active            int4        NOT NULL,
+    computed_at       timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (period, period_start, sku_id)
+);
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS entitlement_suppressions
+(
+    discord_id          int8        NOT NULL,
+    guild_id            int8        NOT NULL,
+    sku_id              int8        NOT NULL,
+    suppressed_by       int8        NOT NULL,
+    first_suppressed_at timestamptz NOT NULL DEFAULT NOW(),
+    last_suppressed_at  timestamptz NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (discord_id)
+);
+
+CREATE INDEX IF NOT EXISTS entitlement_suppressions_guild_id ON entitlement_suppressions (guild_id);
+
+ALTER TABLE entitlement_suppressions ADD COLUMN IF NOT EXISTS application_id int8 NOT NULL DEFAULT 0;
\ No newline at end of file
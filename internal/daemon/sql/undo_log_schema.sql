@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS entitlement_undo_log
+(
+    run_id         UUID           NOT NULL,
+    entitlement_id UUID           NOT NULL,
+    discord_id     int8,
+    guild_id       int8,
+    user_id        int8,
+    sku_id         UUID           NOT NULL,
+    source         premium_source NOT NULL,
+    expires_at     timestamptz,
+    deleted_at     timestamptz    NOT NULL DEFAULT NOW(),
+    restored_at    timestamptz,
+    UNIQUE NULLS NOT DISTINCT (run_id, entitlement_id, discord_id)
+);
+
+CREATE INDEX IF NOT EXISTS entitlement_undo_log_discord_id ON entitlement_undo_log (discord_id);
+CREATE INDEX IF NOT EXISTS entitlement_undo_log_deleted_at ON entitlement_undo_log (deleted_at);
\ No newline at end of file
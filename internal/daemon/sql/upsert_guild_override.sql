@@ -0,0 +1,3 @@
+INSERT INTO entitlement_guild_overrides(discord_id, guild_id)
+VALUES ($1, $2)
+ON CONFLICT ("discord_id") DO UPDATE SET "guild_id" = EXCLUDED."guild_id", "updated_at" = NOW();
\ No newline at end of file
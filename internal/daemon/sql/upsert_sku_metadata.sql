@@ -0,0 +1,7 @@
+INSERT INTO discord_sku_metadata(discord_id, name, slug, type, flags)
+SELECT * FROM unnest($1::int8[], $2::text[], $3::text[], $4::int2[], $5::int4[])
+ON CONFLICT ("discord_id") DO UPDATE SET "name"       = EXCLUDED."name",
+                                         "slug"       = EXCLUDED."slug",
+                                         "type"       = EXCLUDED."type",
+                                         "flags"      = EXCLUDED."flags",
+                                         "updated_at" = NOW();
\ No newline at end of file
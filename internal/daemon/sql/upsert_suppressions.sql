@@ -0,0 +1,7 @@
+INSERT INTO entitlement_suppressions(discord_id, guild_id, sku_id, suppressed_by, application_id)
+SELECT *, $5 FROM unnest($1::int8[], $2::int8[], $3::int8[], $4::int8[])
+ON CONFLICT (discord_id) DO UPDATE SET "guild_id" = EXCLUDED."guild_id",
+                                       "sku_id" = EXCLUDED."sku_id",
+                                       "suppressed_by" = EXCLUDED."suppressed_by",
+                                       "application_id" = EXCLUDED."application_id",
+                                       "last_suppressed_at" = NOW()
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_purges
+(
+    user_hash    text        NOT NULL,
+    purged_at    timestamptz NOT NULL DEFAULT NOW(),
+    entitlements int4        NOT NULL,
+    PRIMARY KEY (user_hash)
+);
\ No newline at end of file
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/record_daily_counts.sql
+	recordDailyCountsQuery string
+
+	//go:embed sql/compute_subscription_stats.sql
+	computeSubscriptionStatsQuery string
+)
+
+// recordDailyCounts adds the creations and deletions applied by the run to today's counts for each SKU, from which
+// the subscription stats are aggregated
+func (d *Daemon) recordDailyCounts(ctx context.Context, tx pgx.Tx, p plan) error {
+	if !d.config.Stats.Enabled {
+		return nil
+	}
+
+	type counts struct {
+		created int32
+		deleted int32
+	}
+
+	bySku := make(map[uuid.UUID]*counts)
+	get := func(skuId uuid.UUID) *counts {
+		c, ok := bySku[skuId]
+		if !ok {
+			c = &counts{}
+			bySku[skuId] = c
+		}
+
+		return c
+	}
+
+	for _, creation := range p.Creations {
+		if !creation.Linked {
+			get(creation.Sku.Id).created++
+		}
+	}
+
+	for _, deletion := range slices.Concat(p.Deletions, p.MissingDeletions) {
+		// The entitlement of a missing link may already have been removed by something else
+		if deletion.SkuId != uuid.Nil {
+			get(deletion.SkuId).deleted++
+		}
+	}
+
+	if len(bySku) == 0 {
+		return nil
+	}
+
+	skuIds := make([]uuid.UUID, 0, len(bySku))
+	created := make([]int32, 0, len(bySku))
+	deleted := make([]int32, 0, len(bySku))
+	for skuId, c := range bySku {
+		skuIds = append(skuIds, skuId)
+		created = append(created, c.created)
+		deleted = append(deleted, c.deleted)
+	}
+
+	_, err := tx.Exec(ctx, recordDailyCountsQuery, uuidArray(skuIds), created, deleted)
+	return err
+}
+
+// statsJob tracks the most recent period that subscription stats have been computed for, so that they are only
+// computed once per period
+type statsJob struct {
+	mu       sync.Mutex
+	computed map[config.StatsPeriod]time.Time
+}
+
+// due returns true if the stats for the period starting at start have not been computed by this process
+func (j *statsJob) due(period config.StatsPeriod, start time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return !j.computed[period].Equal(start)
+}
+
+func (j *statsJob) done(period config.StatsPeriod, start time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.computed == nil {
+		j.computed = make(map[config.StatsPeriod]time.Time)
+	}
+
+	j.computed[period] = start
+}
+
+// lastCompletedPeriod returns the start and end of the most recent period that ended at or before now, in UTC.
+// Weeks start on Monday.
+func lastCompletedPeriod(period config.StatsPeriod, now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch period {
+	case config.StatsPeriodWeek:
+		end = today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return end.AddDate(0, 0, -7), end
+	default:
+		end = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return end.AddDate(0, -1, 0), end
+	}
+}
+
+// computeStats writes the subscription stats for the most recently completed period of each of STATS_PERIODS to
+// the subscription_stats table, if they have not already been written. Active subscriptions are counted when the
+// stats are computed, which is the first run after the period ends. Failures are logged rather than failing the run,
+// and are retried by the next run.
+func (d *Daemon) computeStats(ctx context.Context) {
+	if !d.config.Stats.Enabled {
+		return
+	}
+
+	for _, period := range d.config.Stats.Periods {
+		start, end := lastCompletedPeriod(period, time.Now())
+		if !d.stats.due(period, start) {
+			continue
+		}
+
+		tag, err := d.db().pool.Exec(ctx, computeSubscriptionStatsQuery, string(period), start, end)
+		if err != nil {
+			d.logger.Error("Failed to compute subscription stats", zap.String("period", string(period)), zap.Time("period_start", start), zap.Error(err))
+			continue
+		}
+
+		d.stats.done(period, start)
+		if tag.RowsAffected() > 0 {
+			d.logger.Info("Computed subscription stats", zap.String("period", string(period)), zap.Time("period_start", start), zap.Int64("skus", tag.RowsAffected()))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type statusFile struct {
+	RunId       string     `json:"run_id"`
+	LastRunAt   time.Time  `json:"last_run_at"`
+	DurationMs  int64      `json:"duration_ms"`
+	Result      string     `json:"result"`
+	Error       string     `json:"error,omitempty"`
+	ErrorClass  string     `json:"error_class,omitempty"`
+	LastSuccess *time.Time `json:"last_success_at"`
+
+	Fetched   int            `json:"fetched"`
+	Created   int            `json:"created"`
+	Refreshed int            `json:"refreshed"`
+	Deleted   int            `json:"deleted"`
+	Blocked   int            `json:"blocked_deletions"`
+	Skipped   map[string]int `json:"skipped"`
+}
+
+// writeStatusFile writes a summary of the run to STATUS_FILE, for file-based monitors. The file is replaced
+// atomically, so that readers never observe a partially written file. Scoped runs are not written, as monitors
+// are concerned with full runs.
+func (d *Daemon) writeStatusFile(summary RunSummary) {
+	if len(d.config.StatusFile) == 0 || summary.GuildId != 0 || summary.UserId != 0 {
+		return
+	}
+
+	status := statusFile{
+		RunId:      summary.RunId.String(),
+		LastRunAt:  summary.StartedAt,
+		DurationMs: summary.Duration.Milliseconds(),
+		Result:     "ok",
+		Error:      summary.Error,
+		ErrorClass: string(summary.ErrorClass),
+		Fetched:    summary.Fetched,
+		Created:    summary.Creations,
+		Refreshed:  summary.Refreshes,
+		Deleted:    summary.Deletions + summary.MissingDeletions,
+		Blocked:    summary.BlockedDeletions,
+		Skipped:    make(map[string]int, len(summary.Skipped)),
+	}
+
+	for reason, count := range summary.Skipped {
+		status.Skipped[string(reason)] = count
+	}
+
+	switch {
+	case len(summary.Error) > 0:
+		status.Result = "error"
+	case summary.ReadOnly:
+		status.Result = "read_only"
+	case summary.DryRun:
+		status.Result = "dry_run"
+	}
+
+	if lastSuccess, ok := d.history.lastSuccess(); ok {
+		status.LastSuccess = &lastSuccess
+	}
+
+	if err := writeFileAtomic(d.config.StatusFile, status); err != nil {
+		d.logger.Warn("Failed to write status file", zap.String("path", d.config.StatusFile), zap.Error(err))
+	}
+}
+
+func writeFileAtomic(path string, body any) error {
+	encoded, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
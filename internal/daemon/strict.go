@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AnomalyError is returned in strict mode when the entitlements listed by Discord contain anomalies that would
+// otherwise be synced on a best-effort basis
+type AnomalyError struct {
+	// Anomalies is the number of entitlements affected by each kind of anomaly
+	Anomalies map[string]int
+}
+
+func (e *AnomalyError) Error() string {
+	anomalies := make([]string, 0, len(e.Anomalies))
+	for _, kind := range anomalyKinds {
+		if count, ok := e.Anomalies[kind]; ok {
+			anomalies = append(anomalies, fmt.Sprintf("%s: %d", kind, count))
+		}
+	}
+
+	return fmt.Sprintf("data anomalies found in strict mode (%s)", strings.Join(anomalies, ", "))
+}
+
+const (
+	anomalyUnknownSku     = "unknown_sku"
+	anomalyNoOwner        = "no_owner"
+	anomalyTargetMismatch = "target_mismatch"
+	anomalyDuplicateId    = "duplicate_id"
+)
+
+// anomalyKinds is the order anomalies are reported in
+var anomalyKinds = []string{anomalyUnknownSku, anomalyNoOwner, anomalyTargetMismatch, anomalyDuplicateId}
+
+// checkStrict returns an AnomalyError if STRICT_MODE is enabled and the plan was computed from anomalous data
+func (d *Daemon) checkStrict(p plan) error {
+	if !d.config.StrictMode {
+		return nil
+	}
+
+	anomalies := make(map[string]int)
+	if count := p.Skipped[SkipReasonUnknownSku]; count > 0 {
+		anomalies[anomalyUnknownSku] = count
+	}
+
+	if len(p.Ownerless) > 0 {
+		anomalies[anomalyNoOwner] = len(p.Ownerless)
+	}
+
+	if len(p.TargetMismatches) > 0 {
+		anomalies[anomalyTargetMismatch] = len(p.TargetMismatches)
+	}
+
+	if len(p.DuplicateIds) > 0 {
+		anomalies[anomalyDuplicateId] = len(p.DuplicateIds)
+	}
+
+	if len(anomalies) == 0 {
+		return nil
+	}
+
+	return &AnomalyError{Anomalies: anomalies}
+}
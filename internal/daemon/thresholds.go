@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// removalThresholds holds the removal threshold of each internal SKU configured in SKU_REMOVAL_THRESHOLDS. Missing
+// entitlements of other SKUs are subject to MAX_REMOVALS_THRESHOLD, counted together.
+type removalThresholds struct {
+	bySku  map[uuid.UUID]int
+	global int
+}
+
+func (t removalThresholds) limit(skuId uuid.UUID) int {
+	if limit, ok := t.bySku[skuId]; ok {
+		return limit
+	}
+
+	return t.global
+}
+
+func (t removalThresholds) maxLimit() int {
+	limit := t.global
+	for _, skuLimit := range t.bySku {
+		limit = max(limit, skuLimit)
+	}
+
+	return limit
+}
+
+// resolveRemovalThresholds maps the Discord SKUs in SKU_REMOVAL_THRESHOLDS to internal SKUs. SKUs that are not
+// listed in any entitlement this run are looked up separately, as their entitlements may all have been removed. If
+// several Discord SKUs map to the same internal SKU, the lowest threshold applies.
+func (d *Daemon) resolveRemovalThresholds(ctx context.Context, skus map[uint64]model.Sku) (removalThresholds, error) {
+	thresholds := removalThresholds{
+		bySku:  make(map[uuid.UUID]int),
+		global: d.config.MaxRemovalsThreshold,
+	}
+
+	for discordSkuId, limit := range d.config.SkuRemovalThresholds {
+		sku, ok := skus[discordSkuId]
+		if !ok {
+			resolved, err := d.lookupSku(ctx, discordSkuId)
+			if err != nil {
+				return removalThresholds{}, err
+			}
+
+			if resolved == nil {
+				d.logger.Warn("SKU in SKU_REMOVAL_THRESHOLDS is not mapped in discord_store_skus", zap.Uint64("sku_id", discordSkuId))
+				continue
+			}
+
+			sku = *resolved
+		}
+
+		if existing, ok := thresholds.bySku[sku.Id]; ok {
+			limit = min(limit, existing)
+		}
+
+		thresholds.bySku[sku.Id] = limit
+	}
+
+	return thresholds, nil
+}
+
+// blockedRemovals reports which SKUs' missing entitlements must not be deleted, as a removal threshold has been
+// reached, and sets p.BlockedDeletions to the number withheld
+func (d *Daemon) blockedRemovals(p *plan, links linkState, thresholds removalThresholds) func(skuId uuid.UUID) bool {
+	blocked := make(map[uuid.UUID]bool)
+
+	var unconfigured int
+	for skuId, count := range links.MissingBySku {
+		limit, ok := thresholds.bySku[skuId]
+		if !ok {
+			unconfigured += count
+			continue
+		}
+
+		if count >= limit {
+			d.recordError(&ThresholdExceededError{Threshold: "SKU_REMOVAL_THRESHOLDS", Count: count, Limit: limit})
+			d.logger.Error("SKU_REMOVAL_THRESHOLDS exceeded, not deleting entitlements of SKU", zap.String("internal_sku_id", skuId.String()), zap.Int("count", count), zap.Int("threshold", limit))
+			blocked[skuId] = true
+			p.BlockedDeletions += count
+		}
+	}
+
+	blockUnconfigured := unconfigured >= thresholds.global
+	if blockUnconfigured {
+		d.recordError(&ThresholdExceededError{Threshold: "MAX_REMOVALS_THRESHOLD", Count: unconfigured, Limit: thresholds.global})
+		d.logger.Error("MAX_REMOVALS_THRESHOLD exceeded, not deleting entitlements", zap.Int("count", unconfigured), zap.Int("threshold", thresholds.global))
+		p.BlockedDeletions += unconfigured
+	}
+
+	return func(skuId uuid.UUID) bool {
+		if _, ok := thresholds.bySku[skuId]; ok {
+			return blocked[skuId]
+		}
+
+		return blockUnconfigured
+	}
+}
@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+func newWriteLimiter(config config.Config) *rate.Limiter {
+	if config.WriteRateLimit <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(config.WriteRateLimit), max(config.WriteRateBurst, 1))
+}
+
+// throttleWrites blocks until n entitlement mutations may be made under WRITE_RATE_LIMIT. The limiter is shared by
+// all the workers of a run and with the attached applications, so the limit applies to the database as a whole.
+func (d *Daemon) throttleWrites(ctx context.Context, n int) error {
+	if d.writeLimiter == nil {
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.WriteThrottleSeconds.WithLabelValues(d.applicationLabel).Add(time.Since(start).Seconds())
+	}()
+
+	burst := d.writeLimiter.Burst()
+	for n > 0 {
+		batch := min(n, burst)
+		if err := d.writeLimiter.WaitN(ctx, batch); err != nil {
+			return err
+		}
+
+		n -= batch
+	}
+
+	return nil
+}
+
+// writeBatchSize is the number of rows that a bulk mutation should be split into, so that the writes are spread out
+// under WRITE_RATE_LIMIT rather than applied in one statement after waiting. size is returned if writes are not
+// throttled.
+func (d *Daemon) writeBatchSize(size int) int {
+	if d.writeLimiter == nil {
+		return size
+	}
+
+	return d.writeLimiter.Burst()
+}
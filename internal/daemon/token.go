@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/logging"
+	"go.uber.org/zap"
+)
+
+// tokenSource holds the Discord bot token. When DISCORD_TOKEN_FILE is set, the file is checked for changes before
+// each run, so that the token can be rotated without restarting the daemon.
+type tokenSource struct {
+	path     string
+	redactor *logging.Redactor
+
+	mu      sync.RWMutex
+	token   string
+	modTime time.Time
+}
+
+func newTokenSource(path, token string, redactor *logging.Redactor) *tokenSource {
+	ts := &tokenSource{
+		path:     path,
+		redactor: redactor,
+		token:    token,
+	}
+
+	if len(path) > 0 {
+		if info, err := os.Stat(path); err == nil {
+			ts.modTime = info.ModTime()
+		}
+	}
+
+	return ts
+}
+
+func (ts *tokenSource) get() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.token
+}
+
+// reload re-reads the token file if it has been modified since it was last read, returning whether the token changed.
+// If the file cannot be read, or is empty (e.g. mid-write), the current token is kept.
+func (ts *tokenSource) reload() (bool, error) {
+	if len(ts.path) == 0 {
+		return false, nil
+	}
+
+	info, err := os.Stat(ts.path)
+	if err != nil {
+		return false, err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if info.ModTime().Equal(ts.modTime) {
+		return false, nil
+	}
+
+	raw, err := os.ReadFile(ts.path)
+	if err != nil {
+		return false, err
+	}
+
+	token := strings.TrimSpace(string(raw))
+	if len(token) == 0 {
+		return false, nil
+	}
+
+	ts.modTime = info.ModTime()
+	if token == ts.token {
+		return false, nil
+	}
+
+	if ts.redactor != nil {
+		ts.redactor.AddSecret(token)
+	}
+
+	ts.token = token
+	return true, nil
+}
+
+func (d *Daemon) reloadToken() {
+	changed, err := d.token.reload()
+	if err != nil {
+		d.logger.Warn("Failed to reload Discord token, using the previous token", zap.String("path", d.config.Discord.TokenFile), zap.Error(err))
+		return
+	}
+
+	if changed {
+		d.logger.Info("Discord token rotated", zap.String("path", d.config.Discord.TokenFile))
+		d.reconnectGateway()
+	}
+}
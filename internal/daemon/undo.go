@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	//go:embed sql/prune_undo_log.sql
+	pruneUndoLogQuery string
+
+	//go:embed sql/count_undo_log.sql
+	countUndoLogQuery string
+
+	//go:embed sql/restore_undo_entitlements.sql
+	restoreUndoEntitlementsQuery string
+
+	//go:embed sql/restore_undo_links.sql
+	restoreUndoLinksQuery string
+
+	//go:embed sql/mark_undo_restored.sql
+	markUndoRestoredQuery string
+)
+
+var (
+	ErrUndoDisabled  = errors.New("undo log is not enabled")
+	ErrNothingToUndo = errors.New("no deletions recorded for run, or already undone")
+)
+
+// recordUndo copies the entitlements that are about to be deleted, along with their links, to the undo log against
+// the current run. It must be called in the same transaction as the deletion, so that the record is only kept if the
+// deletion is committed.
+func (d *Daemon) recordUndo(ctx context.Context, tx pgx.Tx, entitlementIds []uuid.UUID) error {
+	if !d.config.UndoLog.Enabled || len(entitlementIds) == 0 {
+		return nil
+	}
+
+	runId, _ := RunIdFromContext(ctx)
+	if err := d.db().store.RecordUndo(ctx, tx, runId, entitlementIds); err != nil {
+		d.logger.Error("Failed to record deletions in undo log", zap.Int("count", len(entitlementIds)), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// pruneUndoLog removes undo log entries older than UNDO_LOG_RETENTION
+func (d *Daemon) pruneUndoLog(ctx context.Context, tx pgx.Tx) error {
+	if !d.config.UndoLog.Enabled {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, pruneUndoLogQuery, d.config.UndoLog.Retention.Seconds())
+	return err
+}
+
+// UndoRun restores the entitlements deleted by a run from the undo log, with their original IDs and links, returning
+// the number restored. Entitlements whose guild, user and SKU have since been given a new entitlement are not
+// restored. Deletions are paused afterwards, so that the next run does not delete the entitlements again before the
+// cause has been fixed.
+func (d *Daemon) UndoRun(ctx context.Context, runId uuid.UUID) (int64, error) {
+	if !d.config.UndoLog.Enabled {
+		return 0, ErrUndoDisabled
+	}
+
+	// Prevent a run from deleting the entitlements again concurrently, and the pool from being swapped by a cutover
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	tx, err := d.db().pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rollback(tx)
+
+	var recorded int
+	if err := tx.QueryRow(ctx, countUndoLogQuery, runId).Scan(&recorded); err != nil {
+		return 0, err
+	}
+
+	if recorded == 0 {
+		return 0, ErrNothingToUndo
+	}
+
+	tag, err := tx.Exec(ctx, restoreUndoEntitlementsQuery, runId)
+	if err != nil {
+		return 0, wrapDbError(err)
+	}
+
+	if _, err := tx.Exec(ctx, restoreUndoLinksQuery, runId); err != nil {
+		return 0, wrapDbError(err)
+	}
+
+	if _, err := tx.Exec(ctx, markUndoRestoredQuery, runId); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, wrapDbError(err)
+	}
+
+	d.logger.Info("Undid run deletions", zap.String("run_id", runId.String()), zap.Int64("restored", tag.RowsAffected()))
+	d.SetDeletionsPaused(true)
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/notify"
+	"go.uber.org/zap"
+)
+
+// unknownSkuTracker counts the number of consecutive runs in which each unknown SKU has been observed
+type unknownSkuTracker struct {
+	mu     sync.Mutex
+	counts map[uint64]int
+}
+
+// observe records the unknown SKUs seen by a run, and returns the number of consecutive runs each has been seen in.
+// SKUs that were not seen by the run are forgotten.
+func (t *unknownSkuTracker) observe(skuIds []uint64) map[uint64]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[uint64]int, len(skuIds))
+	for _, skuId := range skuIds {
+		counts[skuId] = t.counts[skuId] + 1
+	}
+
+	t.counts = counts
+
+	res := make(map[uint64]int, len(counts))
+	for skuId, count := range counts {
+		res[skuId] = count
+	}
+
+	return res
+}
+
+// has returns true if the SKU was unknown in the last run
+func (t *unknownSkuTracker) has(skuId uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.counts[skuId]
+	return ok
+}
+
+// escalateUnknownSkus logs unknown SKUs with increasing severity the longer they persist, as a persistent unknown
+// SKU means that paying customers are not receiving premium. A notification is sent once an unknown SKU has
+// persisted for UNKNOWN_SKU_NOTIFY_AFTER runs.
+func (d *Daemon) escalateUnknownSkus(skuIds []uint64) {
+	escalation := d.config.UnknownSkuEscalation
+
+	for skuId, runs := range d.unknownSkus.observe(skuIds) {
+		fields := append([]zap.Field{zap.Uint64("sku_id", skuId), zap.Int("consecutive_runs", runs)}, d.skuNameFields(skuId)...)
+
+		switch {
+		case runs >= escalation.ErrorAfter:
+			d.logger.Error("Unknown SKU has persisted, entitlements are not being granted", fields...)
+		case runs >= escalation.WarnAfter:
+			d.logger.Warn("Unknown SKU has persisted, entitlements are not being granted", fields...)
+		}
+
+		// Only notify when the threshold is first crossed, rather than on every run
+		if runs == escalation.NotifyAfter {
+			sku := strconv.FormatUint(skuId, 10)
+			notifyFields := []notify.Field{
+				{Name: "SKU ID", Value: sku},
+				{Name: "Consecutive runs", Value: strconv.Itoa(runs)},
+			}
+
+			if name, ok := d.skuMetadata.name(skuId); ok {
+				sku = fmt.Sprintf("%s (%d)", name, skuId)
+				notifyFields = append(notifyFields, notify.Field{Name: "SKU name", Value: name})
+			}
+
+			d.notify(notify.Notification{
+				Severity: notify.SeverityError,
+				Title:    "Unknown SKU has persisted",
+				Text: fmt.Sprintf(
+					"Entitlements for SKU %s have been skipped for %d consecutive runs, as it is not mapped in discord_store_skus. Customers who purchased it are not receiving premium.",
+					sku, runs,
+				),
+				Fields: notifyFields,
+			})
+		}
+	}
+}
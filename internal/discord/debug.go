@@ -0,0 +1,48 @@
+package discord
+
+import (
+	"net/http"
+
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+	"go.uber.org/zap"
+)
+
+// registerDebugHooks logs each request to Discord and its response, for diagnosing pagination or proxy rewriting
+// problems. The Authorization header is never logged, and the logger's redactor scrubs the token from response bodies.
+func registerDebugHooks(logger *zap.Logger, bodyLimit int) {
+	request.RegisterPreRequestHook(func(_ string, req *http.Request) {
+		logger.Info("Sending Discord request", zap.String("method", req.Method), zap.String("url", req.URL.String()))
+	})
+
+	request.RegisterPostRequestHook(func(res *http.Response, body []byte) {
+		// res is nil if the request failed before a response was received, in which case the error is returned
+		if res == nil {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.Int("status", res.StatusCode),
+			zap.String("body", truncate(body, bodyLimit)),
+			zap.Int("body_size", len(body)),
+		}
+
+		// The request URL reflects any rewriting by the proxy hook
+		if res.Request != nil {
+			fields = append(fields, zap.String("method", res.Request.Method), zap.String("url", res.Request.URL.String()))
+
+			if requestId := res.Request.Header.Get(RequestIdHeader); len(requestId) > 0 {
+				fields = append(fields, zap.String("request_id", requestId))
+			}
+		}
+
+		logger.Info("Received Discord response", fields...)
+	})
+}
+
+func truncate(body []byte, limit int) string {
+	if limit >= 0 && len(body) > limit {
+		return string(body[:limit]) + "...(truncated)"
+	}
+
+	return string(body)
+}
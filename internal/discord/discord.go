@@ -0,0 +1,132 @@
+package discord
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/daemon"
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	RunIdHeader     = "X-Run-Id"
+	RequestIdHeader = "X-Request-Id"
+)
+
+// Configure registers the hooks applied to all outgoing Discord requests
+func Configure(config config.Config, logger *zap.Logger) error {
+	transport := newTransport(config)
+	request.Client.Transport = transport
+	request.Client.Timeout = config.Discord.Http.Timeout
+
+	// Registered first, so that the request is logged before it is rewritten for the proxy
+	if config.HttpDebug {
+		registerDebugHooks(logger, config.HttpDebugBodyLimit)
+	}
+
+	if len(config.Discord.UserAgent) > 0 || len(config.Discord.ExtraHeaders) > 0 {
+		request.RegisterPreRequestHook(func(_ string, req *http.Request) {
+			if len(config.Discord.UserAgent) > 0 {
+				req.Header.Set("User-Agent", config.Discord.UserAgent)
+			}
+
+			for key, value := range config.Discord.ExtraHeaders {
+				req.Header.Set(key, value)
+			}
+		})
+	}
+
+	if len(config.Discord.ProxyHost) > 0 {
+		scheme := "http"
+		if len(config.Discord.ProxyTls.CertFile) > 0 {
+			tlsConfig, err := proxyTlsConfig(config)
+			if err != nil {
+				return err
+			}
+
+			transport.TLSClientConfig = tlsConfig
+			scheme = "https"
+		}
+
+		request.RegisterPreRequestHook(func(_ string, req *http.Request) {
+			req.URL.Scheme = scheme
+			req.URL.Host = config.Discord.ProxyHost
+
+			// Allow the proxy's logs to be correlated with a specific sync run
+			if runId, ok := daemon.RunIdFromContext(req.Context()); ok {
+				req.Header.Set(RunIdHeader, runId.String())
+			}
+
+			req.Header.Set(RequestIdHeader, uuid.NewString())
+		})
+	}
+
+	return nil
+}
+
+// newTransport builds the transport for Discord requests. All requests go to a single host (Discord or the proxy), so
+// keeping enough idle connections to that host lets consecutive pages reuse a connection rather than re-dialing.
+func newTransport(config config.Config) *http.Transport {
+	opts := config.Discord.Http
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: opts.KeepAlive,
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.TlsHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		ForceAttemptHTTP2:     opts.Http2,
+	}
+
+	// A non-nil, empty TLSNextProto disables HTTP/2
+	if !opts.Http2 {
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return transport
+}
+
+// proxyTlsConfig builds the client TLS config for connecting to the proxy, presenting the configured client certificate.
+// If no CA is configured, the proxy's certificate is verified against the system roots.
+func proxyTlsConfig(config config.Config) (*tls.Config, error) {
+	tlsOpts := config.Discord.ProxyTls
+
+	cert, err := tls.LoadX509KeyPair(tlsOpts.CertFile, tlsOpts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load proxy client certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   tlsOpts.ServerName,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if len(tlsOpts.CaFile) > 0 {
+		pem, err := os.ReadFile(tlsOpts.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read proxy CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in proxy CA file %s", tlsOpts.CaFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client evaluates feature flags using the OpenFeature Remote Evaluation Protocol (OFREP), which is supported by
+// flag management systems such as flagd, GO Feature Flag and Flipt
+type Client struct {
+	baseUrl    string
+	authToken  string
+	httpClient *http.Client
+}
+
+// EvaluationContext holds the attributes that flags can be targeted on
+type EvaluationContext map[string]any
+
+// NewClient creates a new Client. baseUrl is the URL of the flag provider, without the /ofrep/v1 path.
+func NewClient(baseUrl, authToken string) *Client {
+	return &Client{
+		baseUrl:   strings.TrimSuffix(baseUrl, "/"),
+		authToken: authToken,
+		httpClient: &http.Client{
+			Timeout: time.Second * 5,
+		},
+	}
+}
+
+type evaluationRequest struct {
+	Context EvaluationContext `json:"context"`
+}
+
+type evaluationResponse struct {
+	Key          string          `json:"key"`
+	Value        json.RawMessage `json:"value"`
+	Reason       string          `json:"reason"`
+	Variant      string          `json:"variant"`
+	ErrorCode    string          `json:"errorCode"`
+	ErrorDetails string          `json:"errorDetails"`
+}
+
+// Bool evaluates a boolean flag, returning defaultValue along with the error if it cannot be evaluated
+func (c *Client) Bool(ctx context.Context, key string, defaultValue bool, evalCtx EvaluationContext) (bool, error) {
+	var value bool
+	if err := c.evaluate(ctx, key, evalCtx, &value); err != nil {
+		return defaultValue, err
+	}
+
+	return value, nil
+}
+
+// Float evaluates a numeric flag, returning defaultValue along with the error if it cannot be evaluated
+func (c *Client) Float(ctx context.Context, key string, defaultValue float64, evalCtx EvaluationContext) (float64, error) {
+	var value float64
+	if err := c.evaluate(ctx, key, evalCtx, &value); err != nil {
+		return defaultValue, err
+	}
+
+	return value, nil
+}
+
+func (c *Client) evaluate(ctx context.Context, key string, evalCtx EvaluationContext, value any) error {
+	encoded, err := json.Marshal(evaluationRequest{Context: evalCtx})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/ofrep/v1/evaluate/flags/%s", c.baseUrl, url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(c.authToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	var parsed evaluationResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("flag %s: provider returned status %d", key, res.StatusCode)
+	}
+
+	if res.StatusCode != http.StatusOK || len(parsed.ErrorCode) > 0 {
+		return fmt.Errorf("flag %s: provider returned status %d: %s: %s", key, res.StatusCode, parsed.ErrorCode, parsed.ErrorDetails)
+	}
+
+	if len(parsed.Value) == 0 {
+		return fmt.Errorf("flag %s: provider returned no value", key)
+	}
+
+	if err := json.Unmarshal(parsed.Value, value); err != nil {
+		return errors.Join(fmt.Errorf("flag %s: unexpected value type", key), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// withLevel returns a logger that only logs entries at or above level. Unlike zap.IncreaseLevel, this does not
+// print an error if the base logger is more verbose.
+func withLevel(logger *zap.Logger, level zapcore.Level) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{
+			Core:  core,
+			level: level,
+		}
+	}))
+}
+
+type levelCore struct {
+	zapcore.Core
+	level zapcore.Level
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) && c.Core.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{
+		Core:  c.Core.With(fields),
+		level: c.level,
+	}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+
+	return c.Core.Check(entry, checked)
+}
+
+func (c *levelCore) Level() zapcore.Level {
+	return c.level
+}
@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const EncodingLogfmt = "logfmt"
+
+var registerOnce sync.Once
+
+func registerLogfmtEncoder() {
+	registerOnce.Do(func() {
+		if err := zap.RegisterEncoder(EncodingLogfmt, func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return newLogfmtEncoder(config), nil
+		}); err != nil {
+			panic(err)
+		}
+	})
+}
+
+var bufferPool = buffer.NewPool()
+
+// logfmtEncoder produces logfmt (key=value) lines. Fields are first encoded by the JSON encoder, so that all zap
+// field types are supported, and then flattened, with nested objects joined by dots (e.g. error.code=1).
+type logfmtEncoder struct {
+	zapcore.Encoder
+}
+
+func newLogfmtEncoder(config zapcore.EncoderConfig) zapcore.Encoder {
+	config.LineEnding = "\n"
+	return &logfmtEncoder{
+		Encoder: zapcore.NewJSONEncoder(config),
+	}
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	return &logfmtEncoder{
+		Encoder: e.Encoder.Clone(),
+	}
+}
+
+func (e *logfmtEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	encoded, err := e.Encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	defer encoded.Free()
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded.Bytes()))
+	decoder.UseNumber()
+
+	out := bufferPool.Get()
+	if err := writeLogfmtObject(out, decoder, ""); err != nil {
+		out.Free()
+		return nil, err
+	}
+
+	out.AppendByte('\n')
+	return out, nil
+}
+
+func writeLogfmtObject(out *buffer.Buffer, decoder *json.Decoder, prefix string) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", token)
+		}
+
+		if err := writeLogfmtValue(out, decoder, prefix+key); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+func writeLogfmtValue(out *buffer.Buffer, decoder *json.Decoder, key string) error {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		inner := json.NewDecoder(bytes.NewReader(trimmed))
+		inner.UseNumber()
+		return writeLogfmtObject(out, inner, key+".")
+	}
+
+	var value string
+	if len(trimmed) > 0 && trimmed[0] == '"' {
+		if err := json.Unmarshal(trimmed, &value); err != nil {
+			return err
+		}
+	} else {
+		// Numbers, booleans, null and arrays are written as their JSON representation
+		value = string(trimmed)
+	}
+
+	if out.Len() > 0 {
+		out.AppendByte(' ')
+	}
+
+	out.AppendString(key)
+	out.AppendByte('=')
+	out.AppendString(quoteLogfmtValue(value))
+	return nil
+}
+
+func quoteLogfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"fmt"
+
+	"github.com/TicketsBot-cloud/common/observability"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FormatConsole = "console"
+	FormatJson    = "json"
+	FormatLogfmt  = "logfmt"
+)
+
+// Format returns the configured log format, falling back to the legacy JSON_LOGS option if LOG_FORMAT is not set
+func Format(config config.Config) string {
+	if len(config.LogFormat) > 0 {
+		return config.LogFormat
+	}
+
+	if config.JsonLogs {
+		return FormatJson
+	}
+
+	return FormatConsole
+}
+
+// Loggers holds the root logger, and a logger for each component, each filtered to its own level
+type Loggers struct {
+	Root       *zap.Logger
+	Fetcher    *zap.Logger
+	Reconciler *zap.Logger
+	// Database is nil unless LOG_LEVEL_DATABASE is set
+	Database *zap.Logger
+	// Redactor scrubs secrets from the output of all the loggers
+	Redactor *Redactor
+}
+
+func Build(config config.Config, redactor *Redactor) (*Loggers, error) {
+	fetcherLevel := componentLevel(config, config.ComponentLogLevels.Fetcher)
+	reconcilerLevel := componentLevel(config, config.ComponentLogLevels.Reconciler)
+	databaseLevel := componentLevel(config, config.ComponentLogLevels.Database)
+
+	// The base logger must let through the most verbose level of any component
+	minLevel := min(config.LogLevel, fetcherLevel, reconcilerLevel, databaseLevel)
+
+	base, err := buildBase(config, redactor, minLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	loggers := &Loggers{
+		Root:       withLevel(base, config.LogLevel),
+		Fetcher:    withLevel(base, fetcherLevel).Named("fetcher"),
+		Reconciler: withLevel(base, reconcilerLevel).Named("reconciler"),
+		Redactor:   redactor,
+	}
+
+	if config.ComponentLogLevels.Database != nil {
+		loggers.Database = withLevel(base, databaseLevel).Named("database")
+	}
+
+	return loggers, nil
+}
+
+// With returns a copy of the loggers with fields added to each of them
+func (l *Loggers) With(fields ...zap.Field) *Loggers {
+	res := &Loggers{
+		Root:       l.Root.With(fields...),
+		Fetcher:    l.Fetcher.With(fields...),
+		Reconciler: l.Reconciler.With(fields...),
+		Redactor:   l.Redactor,
+	}
+
+	if l.Database != nil {
+		res.Database = l.Database.With(fields...)
+	}
+
+	return res
+}
+
+// sentryEnvironment returns the environment to tag Sentry events from the logs with. The adapter sets it on each event,
+// which takes precedence over the client's SENTRY_ENVIRONMENT, so it must be passed through explicitly.
+func sentryEnvironment(config config.Config) observability.Environment {
+	if len(config.SentryEnvironment) == 0 {
+		return observability.EnvironmentProduction
+	}
+
+	return observability.Environment(config.SentryEnvironment)
+}
+
+func componentLevel(config config.Config, level *zapcore.Level) zapcore.Level {
+	if level == nil {
+		return config.LogLevel
+	}
+
+	return *level
+}
+
+func buildBase(config config.Config, redactor *Redactor, level zapcore.Level) (*zap.Logger, error) {
+	switch format := Format(config); format {
+	case FormatConsole:
+		loggerConfig := zap.NewDevelopmentConfig()
+		loggerConfig.Level.SetLevel(level)
+		loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+
+		return loggerConfig.Build(zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel), zap.WrapCore(redactor.wrapCore))
+	case FormatJson, FormatLogfmt:
+		loggerConfig := zap.NewProductionConfig()
+		loggerConfig.Level.SetLevel(level)
+
+		if format == FormatLogfmt {
+			registerLogfmtEncoder()
+			loggerConfig.Encoding = EncodingLogfmt
+		}
+
+		return loggerConfig.Build(
+			zap.AddCaller(),
+			zap.AddStacktrace(zap.ErrorLevel),
+			zap.WrapCore(redactor.wrapCore),
+			zap.WrapCore(observability.ZapSentryAdapter(sentryEnvironment(config))),
+		)
+	default:
+		return nil, fmt.Errorf("unknown log format %s, expected one of: console, json, logfmt", format)
+	}
+}
@@ -0,0 +1,277 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/getsentry/sentry-go"
+	"github.com/jackc/pgconn"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// Redactor scrubs secrets, such as the Discord token, database passwords and webhook URLs, from log lines and Sentry events.
+// pgx and HTTP errors can embed these, so they must not be logged verbatim.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  []string
+	replacer *strings.Replacer
+}
+
+func NewRedactor(config config.Config) *Redactor {
+	var secrets []string
+	if len(config.Discord.Token) > 0 {
+		secrets = append(secrets, config.Discord.Token)
+	}
+
+	if len(config.Discord.ClientSecret) > 0 {
+		secrets = append(secrets, config.Discord.ClientSecret)
+	}
+
+	for _, app := range config.Discord.Applications {
+		secrets = append(secrets, app.Token)
+	}
+
+	if len(config.Flags.AuthToken) > 0 {
+		secrets = append(secrets, config.Flags.AuthToken)
+	}
+
+	for _, key := range []string{config.LogHashKey, config.UserPurge.HashKey, config.ConfigAge.Identity, config.PlanFile.SigningKey} {
+		if len(key) > 0 {
+			secrets = append(secrets, key)
+		}
+	}
+
+	for _, token := range []string{config.ActivationHook.AuthToken, config.ExpiryHook.AuthToken, config.GuildHook.AuthToken, config.AdminAuthToken} {
+		if len(token) > 0 {
+			secrets = append(secrets, token)
+		}
+	}
+
+	for _, uri := range []string{config.DatabaseUri, config.Shadow.DatabaseUri, config.Replica.DatabaseUri} {
+		secrets = append(secrets, databasePassword(uri)...)
+	}
+
+	for _, uri := range []string{config.Redis.Url, config.Queue.Url} {
+		if parsed, err := url.Parse(uri); err == nil {
+			if password, ok := parsed.User.Password(); ok && len(password) > 0 {
+				secrets = append(secrets, withEncodings(password)...)
+			}
+		}
+	}
+
+	// Webhook URLs contain the credential in their path
+	for _, url := range []string{config.Slack.WebhookUrl, config.Teams.WebhookUrl, config.NotifyWebhook.Url} {
+		if len(url) > 0 {
+			secrets = append(secrets, url)
+		}
+	}
+
+	r := &Redactor{
+		secrets: secrets,
+	}
+
+	r.buildReplacer()
+	return r
+}
+
+// AddSecret adds a secret to be redacted, e.g. a token that has been rotated
+func (r *Redactor) AddSecret(secret string) {
+	if len(secret) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.secrets = append(r.secrets, secret)
+	r.buildReplacer()
+}
+
+func (r *Redactor) buildReplacer() {
+	oldnew := make([]string, 0, len(r.secrets)*2)
+	for _, secret := range r.secrets {
+		oldnew = append(oldnew, secret, redacted)
+	}
+
+	r.replacer = strings.NewReplacer(oldnew...)
+}
+
+func databasePassword(uri string) []string {
+	if len(uri) == 0 {
+		return nil
+	}
+
+	parsed, err := pgconn.ParseConfig(uri)
+	if err != nil {
+		return nil
+	}
+
+	// All hosts in a multi-host URI share the same password
+	if len(parsed.Password) == 0 {
+		return nil
+	}
+
+	return withEncodings(parsed.Password)
+}
+
+// withEncodings returns the password parsed from a URI, along with the forms it may take when the URI is quoted
+// verbatim, e.g. in a connection error
+func withEncodings(password string) []string {
+	res := []string{password}
+	for _, encoded := range []string{url.PathEscape(password), url.QueryEscape(password), url.UserPassword("", password).String()[1:]} {
+		if !slices.Contains(res, encoded) {
+			res = append(res, encoded)
+		}
+	}
+
+	return res
+}
+
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.replacer.Replace(s)
+}
+
+// RedactError returns an error with the same message as err, but with any secrets removed
+func (r *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return errors.New(r.Redact(err.Error()))
+}
+
+// BeforeSend can be used as sentry.ClientOptions.BeforeSend to scrub secrets from Sentry events
+func (r *Redactor) BeforeSend(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	event.Message = r.Redact(event.Message)
+
+	for i := range event.Exception {
+		event.Exception[i].Value = r.Redact(event.Exception[i].Value)
+	}
+
+	for key, value := range event.Extra {
+		if s, ok := value.(string); ok {
+			event.Extra[key] = r.Redact(s)
+		}
+	}
+
+	for _, breadcrumb := range event.Breadcrumbs {
+		breadcrumb.Message = r.Redact(breadcrumb.Message)
+
+		for key, value := range breadcrumb.Data {
+			if s, ok := value.(string); ok {
+				breadcrumb.Data[key] = r.Redact(s)
+			}
+		}
+	}
+
+	return event
+}
+
+func (r *Redactor) wrapCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{
+		Core:     core,
+		redactor: r,
+	}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{
+		Core:     c.Core.With(c.redactFields(fields)),
+		redactor: c.redactor,
+	}
+}
+
+// Check defers to the wrapped core (e.g. for sampling), but registers this core to perform the write, so that
+// redaction happens before encoding. The wrapped core must write in its Write method, so the redacting core must be
+// installed beneath any hook-based cores.
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Check(entry, nil) != nil {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.Redact(entry.Message)
+	return c.Core.Write(entry, c.redactFields(fields))
+}
+
+func (c *redactingCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	res := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = c.redactor.Redact(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok {
+				field = zap.NamedError(field.Key, c.redactor.RedactError(err))
+			}
+		case zapcore.BoolType, zapcore.DurationType, zapcore.Float64Type, zapcore.Float32Type, zapcore.Int64Type,
+			zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type, zapcore.Uint64Type, zapcore.Uint32Type,
+			zapcore.Uint16Type, zapcore.Uint8Type, zapcore.UintptrType, zapcore.TimeType, zapcore.TimeFullType,
+			zapcore.Complex128Type, zapcore.Complex64Type, zapcore.NamespaceType, zapcore.SkipType:
+		default:
+			// Stringers, byte strings, arrays, objects and reflected values can all embed secrets, e.g. a pgx config
+			// with its connection string, so they are redacted as they would be encoded
+			field = c.redactEncoded(field)
+		}
+
+		res[i] = field
+	}
+
+	return res
+}
+
+// redactEncoded encodes field as JSON, and if the encoded value contains a secret, replaces the field with a string
+// of the redacted value
+func (c *redactingCore) redactEncoded(field zapcore.Field) zapcore.Field {
+	buf, err := fieldEncoder.EncodeEntry(zapcore.Entry{}, []zapcore.Field{field})
+	if err != nil {
+		return zap.String(field.Key, redacted)
+	}
+	defer buf.Free()
+
+	encoded := strings.TrimSpace(buf.String())
+	redactedEncoded := c.redactor.Redact(encoded)
+	if redactedEncoded == encoded {
+		return field
+	}
+
+	// Inline objects are encoded without their key, so are kept as the whole redacted object
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(redactedEncoded), &object); err != nil {
+		return zap.String(field.Key, redacted)
+	}
+
+	value, ok := object[field.Key]
+	if !ok {
+		return zap.String(field.Key, redactedEncoded)
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return zap.String(field.Key, s)
+	}
+
+	return zap.String(field.Key, string(value))
+}
+
+// fieldEncoder encodes only the fields of an entry
+var fieldEncoder = zapcore.NewJSONEncoder(zapcore.EncoderConfig{})
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Push pushes all registered metrics to a Prometheus Pushgateway under job, replacing any previously pushed for
+// the job, for processes that do not live long enough to be scraped
+func Push(url, job string) error {
+	return push.New(url, job).Gatherer(prometheus.DefaultGatherer).Push()
+}
+
+// WriteFile writes all registered metrics to path in the OpenMetrics text format. The file is written to a
+// temporary file first and then renamed, so that a collector reading it never sees a partial write.
+func WriteFile(path string) error {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	encoder := expfmt.NewEncoder(f, expfmt.NewFormat(expfmt.TypeOpenMetrics))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to encode %s: %w", family.GetName(), err)
+		}
+	}
+
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
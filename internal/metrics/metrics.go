@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "entitlements_sync"
+
+// Each metric is labelled with the ID of the application that recorded it, as every application in
+// DISCORD_APPLICATIONS is synced by its own daemon
+var (
+	Errors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "The number of errors encountered, by class",
+	}, []string{"application", "class"})
+
+	Skipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entitlements_skipped_total",
+		Help:      "The number of listed entitlements that were not synced, by reason",
+	}, []string{"application", "reason"})
+
+	PhaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "The time taken by each phase of a run",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"application", "phase"})
+
+	FetchPageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fetch_page_duration_seconds",
+		Help:      "The time taken to fetch each page of entitlements from Discord",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 8),
+	}, []string{"application"})
+
+	DbRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_retries_total",
+		Help:      "The number of times the database phase of a run was retried after a transient error",
+	}, []string{"application"})
+
+	Renewals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "renewals_total",
+		Help:      "The number of existing entitlements whose expiry was extended by Discord",
+	}, []string{"application"})
+
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "The number of entitlements that could not be written due to a constraint violation and were dead-lettered",
+	}, []string{"application"})
+
+	ActivationHookFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "activation_hook_failures_total",
+		Help:      "The number of newly created entitlements for which the activation hook could not be called",
+	}, []string{"application"})
+
+	GatewayEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gateway_events_total",
+		Help:      "The number of entitlement events received from the gateway, by type",
+	}, []string{"application", "type"})
+
+	PaginationRefetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pagination_refetches_total",
+		Help:      "The number of times entitlements were listed again because the pages were inconsistent",
+	}, []string{"application"})
+
+	ExpiryHookFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expiry_hook_failures_total",
+		Help:      "The number of expiring entitlements for which the expiry hook could not be called",
+	}, []string{"application"})
+
+	GuildHookFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "guild_hook_failures_total",
+		Help:      "The number of guild changes for which the guild hook could not be called",
+	}, []string{"application"})
+
+	RunsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_skipped_total",
+		Help:      "The number of runs skipped because another instance was running, by the lock that was held",
+	}, []string{"application", "lock"})
+
+	DiscordRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_retries_total",
+		Help:      "The number of Discord requests retried after a transient error, by the HTTP status, or error if no response was received",
+	}, []string{"application", "status"})
+
+	WriteThrottleSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "write_throttle_seconds_total",
+		Help:      "The total time spent waiting for WRITE_RATE_LIMIT before writing to the database",
+	}, []string{"application"})
+
+	RunInterval = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_interval_seconds",
+		Help:      "The interval between scheduled runs in daemon mode, after stretching for slow runs",
+	}, []string{"application"})
+
+	RunAllocatedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_allocated_bytes",
+		Help:      "The number of bytes allocated on the heap during the most recent run",
+	}, []string{"application"})
+
+	RunHeapBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_heap_bytes",
+		Help:      "The number of bytes of live heap objects at the end of the most recent run",
+	}, []string{"application"})
+
+	RunHeapSysBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_heap_sys_bytes",
+		Help:      "The number of bytes of heap memory obtained from the OS at the end of the most recent run",
+	}, []string{"application"})
+
+	RunGcCycles = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_gc_cycles",
+		Help:      "The number of garbage collection cycles completed during the most recent run",
+	}, []string{"application"})
+
+	RunGcPauseSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_gc_pause_seconds",
+		Help:      "The total time the most recent run spent paused for garbage collection",
+	}, []string{"application"})
+)
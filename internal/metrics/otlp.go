@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const serviceName = "discord-entitlements-db-sync"
+
+// StartOtlp periodically exports all registered metrics to an OpenTelemetry collector over OTLP/gRPC. The metrics
+// are read from the Prometheus registry, so the same counters and histograms are exported under the same names.
+// The returned function exports the final values and stops the exporter.
+func StartOtlp(ctx context.Context, endpoint string, insecure bool, interval time.Duration) (func(context.Context) error, error) {
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(
+		exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(otelprometheus.NewMetricProducer()),
+	)
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// UnmarshalText parses a severity from its name, allowing it to be used in the config
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "info":
+		*s = SeverityInfo
+	case "warning", "warn":
+		*s = SeverityWarning
+	case "error":
+		*s = SeverityError
+	default:
+		return fmt.Errorf("unknown severity %s, expected one of: info, warning, error", text)
+	}
+
+	return nil
+}
+
+// Notification is a message about a run or an alert to be sent to a chat service
+type Notification struct {
+	Severity Severity
+	Title    string
+	Text     string
+	Fields   []Field
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
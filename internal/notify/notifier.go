@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Notifier sends notifications to a chat service
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// WithMinSeverity returns a Notifier that drops notifications below minSeverity
+func WithMinSeverity(notifier Notifier, minSeverity Severity) Notifier {
+	return &severityFilter{
+		Notifier:    notifier,
+		minSeverity: minSeverity,
+	}
+}
+
+type severityFilter struct {
+	Notifier
+	minSeverity Severity
+}
+
+func (f *severityFilter) Notify(ctx context.Context, notification Notification) error {
+	if notification.Severity < f.minSeverity {
+		return nil
+	}
+
+	return f.Notifier.Notify(ctx, notification)
+}
+
+// Multi is a Notifier that sends each notification to all of the notifiers
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, notification Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func newHttpClient() *http.Client {
+	return &http.Client{
+		Timeout: time.Second * 10,
+	}
+}
+
+// postJson sends body as JSON to a webhook, returning an error if it does not respond with a 2xx status
+func postJson(ctx context.Context, httpClient *http.Client, service, url string, body any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s webhook returned status %d: %s", service, res.StatusCode, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Slack sends notifications to a Slack incoming webhook
+type Slack struct {
+	webhookUrl string
+	httpClient *http.Client
+}
+
+var _ Notifier = (*Slack)(nil)
+
+func NewSlack(webhookUrl string) *Slack {
+	return &Slack{
+		webhookUrl: webhookUrl,
+		httpClient: newHttpClient(),
+	}
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Text   string       `json:"text,omitempty"`
+	Fields []slackField `json:"fields,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+var slackColors = map[Severity]string{
+	SeverityInfo:    "#2eb67d",
+	SeverityWarning: "#ecb22e",
+	SeverityError:   "#e01e5a",
+}
+
+func (s *Slack) Notify(ctx context.Context, notification Notification) error {
+	attachment := slackAttachment{
+		Color: slackColors[notification.Severity],
+		Text:  notification.Text,
+	}
+
+	for _, field := range notification.Fields {
+		attachment.Fields = append(attachment.Fields, slackField{
+			Title: field.Name,
+			Value: field.Value,
+			Short: true,
+		})
+	}
+
+	return postJson(ctx, s.httpClient, "slack", s.webhookUrl, slackMessage{
+		Text:        fmt.Sprintf("*[%s]* %s", notification.Severity, notification.Title),
+		Attachments: []slackAttachment{attachment},
+	})
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Teams sends notifications to a Microsoft Teams incoming webhook, as a legacy actionable message card
+type Teams struct {
+	webhookUrl string
+	httpClient *http.Client
+}
+
+var _ Notifier = (*Teams)(nil)
+
+func NewTeams(webhookUrl string) *Teams {
+	return &Teams{
+		webhookUrl: webhookUrl,
+		httpClient: newHttpClient(),
+	}
+}
+
+type teamsMessageCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Text       string         `json:"text,omitempty"`
+	Sections   []teamsSection `json:"sections,omitempty"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (t *Teams) Notify(ctx context.Context, notification Notification) error {
+	title := fmt.Sprintf("[%s] %s", notification.Severity, notification.Title)
+
+	card := teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: strings.TrimPrefix(slackColors[notification.Severity], "#"),
+		Summary:    title,
+		Title:      title,
+		// Teams renders text as markdown, in which single line breaks are ignored
+		Text: strings.ReplaceAll(notification.Text, "\n", "\n\n"),
+	}
+
+	if len(notification.Fields) > 0 {
+		facts := make([]teamsFact, len(notification.Fields))
+		for i, field := range notification.Fields {
+			facts[i] = teamsFact{Name: field.Name, Value: field.Value}
+		}
+
+		card.Sections = []teamsSection{{Facts: facts}}
+	}
+
+	return postJson(ctx, t.httpClient, "teams", t.webhookUrl, card)
+}
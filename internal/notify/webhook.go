@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+)
+
+// Webhook sends notifications as JSON to an arbitrary URL, for integrating with chat tooling that is not
+// supported directly
+type Webhook struct {
+	url        string
+	httpClient *http.Client
+}
+
+var _ Notifier = (*Webhook)(nil)
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:        url,
+		httpClient: newHttpClient(),
+	}
+}
+
+type webhookPayload struct {
+	Severity string         `json:"severity"`
+	Title    string         `json:"title"`
+	Text     string         `json:"text"`
+	Fields   []webhookField `json:"fields"`
+}
+
+type webhookField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (w *Webhook) Notify(ctx context.Context, notification Notification) error {
+	fields := make([]webhookField, len(notification.Fields))
+	for i, field := range notification.Fields {
+		fields[i] = webhookField{Name: field.Name, Value: field.Value}
+	}
+
+	return postJson(ctx, w.httpClient, "generic", w.url, webhookPayload{
+		Severity: notification.Severity.String(),
+		Title:    notification.Title,
+		Text:     notification.Text,
+		Fields:   fields,
+	})
+}
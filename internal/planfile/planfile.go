@@ -0,0 +1,95 @@
+package planfile
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Version is the version of the plan file format
+const Version = 1
+
+var ErrInvalidSignature = errors.New("plan file signature is invalid")
+
+// File is a reviewable set of changes computed by a run, to be applied later exactly as written. It is signed with
+// PLAN_SIGNING_KEY, so that a plan cannot be edited between review and apply.
+type File struct {
+	Version       int       `json:"version"`
+	ApplicationId uint64    `json:"application_id,string"`
+	CreatedAt     time.Time `json:"created_at"`
+	Changes       Changes   `json:"changes"`
+	Signature     string    `json:"signature"`
+}
+
+// Changes are the writes that a run would make, each sorted by Discord ID
+type Changes struct {
+	Creations        []Creation `json:"creations"`
+	Deletions        []Deletion `json:"deletions"`
+	MissingDeletions []Deletion `json:"missing_deletions"`
+}
+
+// Creation is an entitlement to create, or to refresh the expiry of if EntitlementId is set
+type Creation struct {
+	DiscordId     uint64     `json:"discord_id,string"`
+	GuildId       *uint64    `json:"guild_id,string"`
+	UserId        *uint64    `json:"user_id,string"`
+	SkuId         uuid.UUID  `json:"sku_id"`
+	SkuLabel      string     `json:"sku_label"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	EntitlementId *uuid.UUID `json:"entitlement_id,omitempty"`
+}
+
+type Deletion struct {
+	DiscordId     uint64    `json:"discord_id,string"`
+	EntitlementId uuid.UUID `json:"entitlement_id"`
+}
+
+// Equal returns true if both sets of changes would make the same writes
+func (c Changes) Equal(other Changes) bool {
+	a, errA := json.Marshal(c)
+	b, errB := json.Marshal(other)
+	return errA == nil && errB == nil && string(a) == string(b)
+}
+
+// Sign sets the signature of the file, computed over all its other fields
+func (f *File) Sign(key []byte) error {
+	signature, err := f.signature(key)
+	if err != nil {
+		return err
+	}
+
+	f.Signature = hex.EncodeToString(signature)
+	return nil
+}
+
+// Verify returns ErrInvalidSignature if the file was not signed with key, or has been modified since
+func (f File) Verify(key []byte) error {
+	expected, err := f.signature(key)
+	if err != nil {
+		return err
+	}
+
+	actual, err := hex.DecodeString(f.Signature)
+	if err != nil || !hmac.Equal(actual, expected) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func (f File) signature(key []byte) ([]byte, error) {
+	f.Signature = ""
+	encoded, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(encoded)
+	return mac.Sum(nil), nil
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const ApplicationName = "entitlements-sync"
+
+// runIdSetting is the custom setting that holds the ID of the run a transaction belongs to
+const runIdSetting = "entitlements_sync.run_id"
+
+// queryAnnotation prefixes every query made in a run's transaction. It is the same for every run, as pgx caches
+// prepared statements by their SQL, and so a different annotation on each run would prepare every statement again.
+const queryAnnotation = "/* " + ApplicationName + " */ "
+
+// SetRunApplicationName sets application_name, and the entitlements_sync.run_id setting, for the remainder of the
+// transaction to identify the run, so that load and lock contention in pg_stat_activity can be attributed to it.
+// application_name can also be included in the server logs with %a in log_line_prefix.
+func SetRunApplicationName(ctx context.Context, tx pgx.Tx, runId string) error {
+	_, err := tx.Exec(
+		ctx,
+		"SELECT set_config('application_name', $1, true), set_config('"+runIdSetting+"', $2, true);",
+		fmt.Sprintf("%s/%s", ApplicationName, runId),
+		runId,
+	)
+	return err
+}
+
+// AnnotateTx returns a transaction that prefixes every query with a comment identifying it as made by the sync,
+// which is visible in pg_stat_activity, pg_stat_statements and the server logs. The run that made a query is
+// identified by the application_name set with SetRunApplicationName.
+func AnnotateTx(tx pgx.Tx) pgx.Tx {
+	return &annotatedTx{Tx: tx}
+}
+
+type annotatedTx struct {
+	pgx.Tx
+}
+
+// Unwrap returns the transaction that queries are made in
+func (t *annotatedTx) Unwrap() pgx.Tx {
+	return t.Tx
+}
+
+func (t *annotatedTx) Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+	return t.Tx.Exec(ctx, queryAnnotation+sql, arguments...)
+}
+
+func (t *annotatedTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return t.Tx.Query(ctx, queryAnnotation+sql, args...)
+}
+
+func (t *annotatedTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return t.Tx.QueryRow(ctx, queryAnnotation+sql, args...)
+}
+
+func (t *annotatedTx) QueryFunc(ctx context.Context, sql string, args []interface{}, scans []interface{}, f func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	return t.Tx.QueryFunc(ctx, queryAnnotation+sql, args, scans, f)
+}
@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// recordingTx records the SQL of the queries made through it
+type recordingTx struct {
+	pgx.Tx
+	sql []string
+}
+
+func (t *recordingTx) Exec(_ context.Context, sql string, _ ...interface{}) (pgconn.CommandTag, error) {
+	t.sql = append(t.sql, sql)
+	return nil, nil
+}
+
+func TestAnnotateTx(t *testing.T) {
+	const query = "DELETE FROM discord_entitlements WHERE entitlement_id = ANY($1);"
+
+	var seen []string
+	for range 2 {
+		inner := &recordingTx{}
+		if _, err := AnnotateTx(inner).Exec(context.Background(), query); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(inner.sql) != 1 {
+			t.Fatalf("expected 1 query, got %d", len(inner.sql))
+		}
+
+		if !strings.HasPrefix(inner.sql[0], "/* "+ApplicationName+" */") || !strings.HasSuffix(inner.sql[0], query) {
+			t.Errorf("query was not annotated: %q", inner.sql[0])
+		}
+
+		seen = append(seen, inner.sql[0])
+	}
+
+	// The statement cache is keyed by SQL, so every run must send the same text
+	if seen[0] != seen[1] {
+		t.Errorf("annotation differs between transactions: %q and %q", seen[0], seen[1])
+	}
+}
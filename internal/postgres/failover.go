@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// IsFailoverError returns true if the error indicates that the server we are connected to is no longer the
+// primary, or has gone away, such that reconnecting may reach the new primary.
+func IsFailoverError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "25006", // read_only_sql_transaction
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || pgconn.SafeToRetry(err)
+}
+
+// CloseIdleConns closes all idle connections in the pool, so that new connections are established against the
+// current primary.
+func CloseIdleConns(ctx context.Context, pool *pgxpool.Pool) int {
+	conns := pool.AcquireAllIdle(ctx)
+	for _, conn := range conns {
+		_ = conn.Conn().Close(ctx)
+		conn.Release()
+	}
+
+	return len(conns)
+}
+
+// IsReadOnly returns true if the transaction cannot perform writes, e.g. because the server is a hot standby
+func IsReadOnly(ctx context.Context, tx pgx.Tx) (bool, error) {
+	var readOnly string
+	if err := tx.QueryRow(ctx, "SELECT current_setting('transaction_read_only');").Scan(&readOnly); err != nil {
+		return false, err
+	}
+
+	return readOnly == "on", nil
+}
+
+// IsReadOnlyError returns true if the error was caused by attempting to write in a read-only transaction
+func IsReadOnlyError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "25006" // read_only_sql_transaction
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/log/zapadapter"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const connectTimeout = 15 * time.Second
+
+// Connect creates a new connection pool. The URI may list multiple hosts (e.g. postgres://a,b/db), in which case
+// each host is tried in turn until one satisfying the target_session_attrs in the URI, or
+// DATABASE_TARGET_SESSION_ATTRS, is found.
+// If logger is not nil, pgx's own logs are written to it, at a verbosity matching the logger's level.
+func Connect(config config.Config, uri string, logger *zap.Logger) (*pgxpool.Pool, error) {
+	// A target_session_attrs set in the URI takes precedence
+	if len(config.DatabaseTargetSessionAttrs) > 0 && !strings.Contains(uri, "target_session_attrs") {
+		uri = withParam(uri, "target_session_attrs", config.DatabaseTargetSessionAttrs)
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := poolConfig.ConnConfig.RuntimeParams["application_name"]; !ok {
+		poolConfig.ConnConfig.RuntimeParams["application_name"] = ApplicationName
+	}
+
+	// Leave room for the RECONCILE_CONCURRENCY workers once every run holds its connections, or the runs would wait on
+	// each other for a connection until they time out. A pool_max_conns set in the URI takes precedence.
+	if !strings.Contains(uri, "pool_max_conns") {
+		poolConfig.MaxConns = max(poolConfig.MaxConns, int32(config.RunConnections()+max(config.ReconcileConcurrency, 1)))
+	}
+
+	// Check connections regularly, so that connections to a demoted primary are dropped promptly after failover
+	poolConfig.HealthCheckPeriod = config.DatabaseHealthCheckPeriod
+
+	if logger != nil {
+		poolConfig.ConnConfig.Logger = zapadapter.NewLogger(logger)
+		poolConfig.ConnConfig.LogLevel = pgxLogLevel(logger.Level())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	return pgxpool.ConnectConfig(ctx, poolConfig)
+}
+
+// pgxLogLevel maps a zap level onto a pgx level. pgx logs every query at info, so that is reserved for debug.
+func pgxLogLevel(level zapcore.Level) pgx.LogLevel {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return pgx.LogLevelDebug
+	case level <= zapcore.WarnLevel:
+		return pgx.LogLevelWarn
+	default:
+		return pgx.LogLevelError
+	}
+}
+
+// withParam adds a connection parameter to uri, which may be either a URL or a keyword/value connection string, for
+// pgconn to parse along with the rest
+func withParam(uri, key, value string) string {
+	if !strings.Contains(uri, "://") {
+		return fmt.Sprintf("%s %s=%s", uri, key, value)
+	}
+
+	if strings.Contains(uri, "?") {
+		return fmt.Sprintf("%s&%s=%s", uri, key, url.QueryEscape(value))
+	}
+
+	return fmt.Sprintf("%s?%s=%s", uri, key, url.QueryEscape(value))
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// ConnectReplica creates a new connection pool to a read replica. The replica is a standby, so would be rejected by
+// DATABASE_TARGET_SESSION_ATTRS, which is therefore not applied.
+func ConnectReplica(config config.Config, uri string, logger *zap.Logger) (*pgxpool.Pool, error) {
+	config.DatabaseTargetSessionAttrs = ""
+	return Connect(config, uri, logger)
+}
+
+// ReplicationLag returns how far a hot standby is behind its primary. A standby that has replayed all the WAL it has
+// received is not considered to be lagging, even if the primary has not written anything recently.
+func ReplicationLag(ctx context.Context, pool *pgxpool.Pool) (time.Duration, error) {
+	var seconds float64
+	err := pool.QueryRow(ctx, `
+SELECT CASE
+    WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+END;`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+// IsTransientError returns true if the error is likely to succeed if retried shortly after, e.g. a serialization
+// failure, deadlock, or dropped connection.
+func IsTransientError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+
+		// Class 08 - connection exceptions
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// SlowQueryOptions configures LogSlowQueries
+type SlowQueryOptions struct {
+	// Threshold is the duration above which a query is considered slow. Slow queries are not logged if it is 0.
+	Threshold time.Duration
+	// Explain enables logging the plan of slow queries, obtained by running EXPLAIN on a separate connection
+	Explain bool
+}
+
+// LogSlowQueries returns a transaction that logs queries taking longer than the threshold. For Query, the duration
+// is measured until the first response is received, rather than until every row has been read.
+func LogSlowQueries(tx pgx.Tx, pool *pgxpool.Pool, opts SlowQueryOptions, logger *zap.Logger) pgx.Tx {
+	if opts.Threshold <= 0 {
+		return tx
+	}
+
+	return &slowQueryTx{
+		Tx:     tx,
+		pool:   pool,
+		opts:   opts,
+		logger: logger,
+	}
+}
+
+type slowQueryTx struct {
+	pgx.Tx
+	pool   *pgxpool.Pool
+	opts   SlowQueryOptions
+	logger *zap.Logger
+}
+
+// Unwrap returns the transaction that queries are made in
+func (t *slowQueryTx) Unwrap() pgx.Tx {
+	return t.Tx
+}
+
+func (t *slowQueryTx) Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+	start := time.Now()
+	tag, err := t.Tx.Exec(ctx, sql, arguments...)
+	t.observe(ctx, start, sql, arguments)
+	return tag, err
+}
+
+func (t *slowQueryTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	start := time.Now()
+	rows, err := t.Tx.Query(ctx, sql, args...)
+	t.observe(ctx, start, sql, args)
+	return rows, err
+}
+
+func (t *slowQueryTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return &slowQueryRow{
+		Row:   t.Tx.QueryRow(ctx, sql, args...),
+		ctx:   ctx,
+		tx:    t,
+		start: time.Now(),
+		sql:   sql,
+		args:  args,
+	}
+}
+
+func (t *slowQueryTx) QueryFunc(ctx context.Context, sql string, args []interface{}, scans []interface{}, f func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	start := time.Now()
+	tag, err := t.Tx.QueryFunc(ctx, sql, args, scans, f)
+	t.observe(ctx, start, sql, args)
+	return tag, err
+}
+
+// slowQueryRow measures the duration of QueryRow until Scan, as the query is not sent until then
+type slowQueryRow struct {
+	pgx.Row
+	ctx   context.Context
+	tx    *slowQueryTx
+	start time.Time
+	sql   string
+	args  []interface{}
+}
+
+func (r *slowQueryRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	r.tx.observe(r.ctx, r.start, r.sql, r.args)
+	return err
+}
+
+func (t *slowQueryTx) observe(ctx context.Context, start time.Time, sql string, args []interface{}) {
+	duration := time.Since(start)
+	if duration < t.opts.Threshold {
+		return
+	}
+
+	fields := []zap.Field{zap.String("sql", sql), zap.Duration("duration", duration)}
+	if t.opts.Explain {
+		plan, err := t.explain(ctx, sql, args)
+		if err != nil {
+			t.logger.Debug("Failed to explain slow query", zap.String("sql", sql), zap.Error(err))
+		} else {
+			fields = append(fields, zap.String("plan", plan))
+		}
+	}
+
+	t.logger.Warn("Slow query", fields...)
+}
+
+// explain obtains the plan for the query in a separate read-only transaction. The query is not executed, so the
+// plan is only an estimate, and it cannot be obtained for queries that reference temporary tables.
+func (t *slowQueryTx) explain(ctx context.Context, sql string, args []interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second*10)
+	defer cancel()
+
+	tx, err := t.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "EXPLAIN "+sql, args...)
+	if err != nil {
+		return "", err
+	}
+
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Request is a run request, published as JSON to the queue, e.g. by the purchase webhook pipeline
+type Request struct {
+	Scope   Scope  `json:"scope"`
+	GuildId uint64 `json:"guild_id,string,omitempty"`
+	UserId  uint64 `json:"user_id,string,omitempty"`
+}
+
+type Scope string
+
+const (
+	ScopeFull  Scope = "full"
+	ScopeGuild Scope = "guild"
+	ScopeUser  Scope = "user"
+)
+
+// Validate returns an error if the request does not specify the ID that its scope requires
+func (r Request) Validate() error {
+	switch r.Scope {
+	case ScopeFull:
+		return nil
+	case ScopeGuild:
+		if r.GuildId == 0 {
+			return errors.New("guild_id is required for guild scope")
+		}
+	case ScopeUser:
+		if r.UserId == 0 {
+			return errors.New("user_id is required for user scope")
+		}
+	default:
+		return fmt.Errorf("unknown scope %q, expected one of: full, guild, user", r.Scope)
+	}
+
+	return nil
+}
+
+// Consumer consumes run requests from a RabbitMQ queue
+type Consumer struct {
+	url   string
+	queue string
+}
+
+func NewConsumer(url, queue string) *Consumer {
+	return &Consumer{
+		url:   url,
+		queue: queue,
+	}
+}
+
+// Queue returns the name of the queue that requests are consumed from
+func (c *Consumer) Queue() string {
+	return c.queue
+}
+
+// Run connects to RabbitMQ and calls handle for each request, one at a time, until the connection is lost or ctx is
+// cancelled. A request is acknowledged once handle returns successfully. If handle fails, the request is requeued
+// once, and rejected if it fails again, so that it is dead-lettered if the queue has a dead letter exchange.
+// Messages that are not valid requests are passed to onInvalid and rejected.
+func (c *Consumer) Run(ctx context.Context, handle func(context.Context, Request) error, onInvalid func(payload []byte, err error)) error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	defer ch.Close()
+
+	// Runs are serialised, so there is no benefit to holding more than one request at a time
+	if err := ch.Qos(1, 0, false); err != nil {
+		return err
+	}
+
+	deliveries, err := ch.ConsumeWithContext(ctx, c.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			var request Request
+			if err := json.Unmarshal(delivery.Body, &request); err == nil {
+				err = request.Validate()
+			}
+
+			if err != nil {
+				onInvalid(delivery.Body, err)
+				if err := delivery.Reject(false); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := handle(ctx, request); err != nil {
+				if err := delivery.Nack(false, !delivery.Redelivered); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := delivery.Ack(false); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
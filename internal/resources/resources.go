@@ -0,0 +1,81 @@
+package resources
+
+import (
+	"errors"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.uber.org/automaxprocs/maxprocs"
+	"go.uber.org/zap"
+)
+
+// memoryLimitRatio is the proportion of the container memory limit used as the Go runtime's soft memory limit,
+// leaving headroom for memory not managed by the runtime
+const memoryLimitRatio = 0.9
+
+var cgroupMemoryLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",                   // cgroup v2
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes", // cgroup v1
+}
+
+// Configure sizes GOMAXPROCS to the container's CPU quota and, unless GOMEMLIMIT is set, sets the runtime's soft
+// memory limit from the container's memory limit, so that the GC works harder before the pod is OOMKilled
+func Configure(logger *zap.Logger) {
+	if _, err := maxprocs.Set(maxprocs.Logger(logger.Sugar().Debugf)); err != nil {
+		logger.Warn("Failed to set GOMAXPROCS from CPU quota", zap.Error(err))
+	}
+
+	memoryLimit, err := readMemoryLimit()
+	if err != nil {
+		logger.Warn("Failed to read container memory limit", zap.Error(err))
+	}
+
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); !ok && memoryLimit > 0 {
+		debug.SetMemoryLimit(int64(float64(memoryLimit) * memoryLimitRatio))
+	}
+
+	logger.Info(
+		"Detected resource limits",
+		zap.Int("cpus", runtime.NumCPU()),
+		zap.Int("gomaxprocs", runtime.GOMAXPROCS(0)),
+		zap.Int64("memory_limit_bytes", memoryLimit),
+		zap.Int64("go_memory_limit_bytes", debug.SetMemoryLimit(-1)),
+	)
+}
+
+// readMemoryLimit returns the memory limit of the cgroup the process is running in, or 0 if there is none
+func readMemoryLimit() (int64, error) {
+	for _, path := range cgroupMemoryLimitFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return 0, err
+		}
+
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, nil
+		}
+
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		// cgroup v1 reports a very large number, rounded down to the page size, when there is no limit
+		if limit >= math.MaxInt64/2 {
+			return 0, nil
+		}
+
+		return limit, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	//go:embed sql/delete_entitlements.sql
+	deleteEntitlementsQuery string
+
+	//go:embed sql/create_entitlement_with_id.sql
+	createEntitlementWithIdQuery string
+
+	//go:embed sql/list_entitlement_expiries.sql
+	listEntitlementExpiriesQuery string
+
+	//go:embed sql/insert_links.sql
+	insertLinksQuery string
+
+	//go:embed sql/tag_applications.sql
+	tagApplicationsQuery string
+
+	//go:embed sql/record_entitlement_ids.sql
+	recordEntitlementIdsQuery string
+
+	//go:embed sql/list_stable_entitlement_ids.sql
+	listStableEntitlementIdsQuery string
+
+	//go:embed sql/list_previous_entitlement_ids.sql
+	listPreviousEntitlementIdsQuery string
+
+	//go:embed sql/insert_undo_log.sql
+	insertUndoLogQuery string
+
+	//go:embed sql/insert_dead_letter.sql
+	insertDeadLetterQuery string
+
+	//go:embed sql/clear_dead_letters.sql
+	clearDeadLettersQuery string
+
+	//go:embed sql/insert_renewal.sql
+	insertRenewalQuery string
+)
+
+// Link maps a Discord entitlement ID to the ID of the entitlement in the entitlements table
+type Link struct {
+	DiscordId     uint64
+	EntitlementId uuid.UUID
+}
+
+// DeadLetter is a Discord entitlement that could not be written, recorded so that it can be investigated without
+// failing the rest of the run
+type DeadLetter struct {
+	DiscordId uint64
+	SkuId     uuid.UUID
+	GuildId   *uint64
+	UserId    *uint64
+	Cause     string
+}
+
+// Renewal is an existing entitlement whose expiry was extended by Discord, e.g. when a subscription renews
+type Renewal struct {
+	DiscordId         uint64
+	EntitlementId     uuid.UUID
+	GuildId           *uint64
+	UserId            *uint64
+	SkuId             uuid.UUID
+	PreviousExpiresAt time.Time
+	ExpiresAt         time.Time
+}
+
+// Bookkeeping is the reconciliation engine's own records, written in the same transaction as the entitlements that
+// they describe, so that they are only kept if the changes to the entitlements are committed
+type Bookkeeping interface {
+	// InsertLinks links the Discord entitlement IDs to their entitlements, updating existing links in place. If a
+	// Discord ID appears more than once, the last link wins.
+	InsertLinks(ctx context.Context, tx pgx.Tx, links []Link) error
+	// TagApplications records that the links were created by the application. Existing tags are left as they are.
+	TagApplications(ctx context.Context, tx pgx.Tx, links []Link, applicationId uint64) error
+	// RecordEntitlementIds records the entitlement ID of each link in the stable ID mapping, which, unlike the links,
+	// is kept after the entitlement is deleted
+	RecordEntitlementIds(ctx context.Context, tx pgx.Tx, links []Link) error
+	// StableEntitlementIds returns the entitlement IDs recorded by RecordEntitlementIds for the Discord IDs, by
+	// Discord ID, omitting IDs that are in use again
+	StableEntitlementIds(ctx context.Context, tx pgx.Tx, discordIds []uint64) (map[uint64]uuid.UUID, error)
+	// DeletedEntitlementIds returns the IDs of the most recently deleted entitlements of the Discord IDs in the undo
+	// log, by Discord ID, omitting IDs that are in use again
+	DeletedEntitlementIds(ctx context.Context, tx pgx.Tx, discordIds []uint64) (map[uint64]uuid.UUID, error)
+	// RecordUndo copies the entitlements that are about to be deleted, along with their links, to the undo log
+	// against the run
+	RecordUndo(ctx context.Context, tx pgx.Tx, runId uuid.UUID, entitlementIds []uuid.UUID) error
+	// InsertDeadLetter records a dead letter, replacing any previous one for the Discord ID
+	InsertDeadLetter(ctx context.Context, tx pgx.Tx, letter DeadLetter) error
+	// ClearDeadLetters removes the dead letters for the Discord IDs
+	ClearDeadLetters(ctx context.Context, tx pgx.Tx, discordIds []uint64) error
+	// InsertRenewal records a renewal made by the run
+	InsertRenewal(ctx context.Context, tx pgx.Tx, runId uuid.UUID, renewal Renewal) error
+}
+
+// engineTables implements the methods of EntitlementStore that are shared by the stores backed by Postgres, whose
+// databases hold the engine's tables alongside the entitlements
+type engineTables struct{}
+
+func (engineTables) DeleteEntitlements(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tag, err := tx.Exec(ctx, deleteEntitlementsQuery, uuidArray(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (engineTables) CreateEntitlementWithId(ctx context.Context, tx pgx.Tx, id uuid.UUID, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error) {
+	if err := tx.QueryRow(
+		ctx,
+		createEntitlementWithIdQuery,
+		id,
+		guildId,
+		userId,
+		skuId,
+		model.EntitlementSourceDiscord,
+		expiresAt,
+	).Scan(&id); err != nil {
+		return model.Entitlement{}, err
+	}
+
+	return model.Entitlement{
+		Id:        id,
+		GuildId:   guildId,
+		UserId:    userId,
+		SkuId:     skuId,
+		Source:    model.EntitlementSourceDiscord,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (engineTables) GetExpiries(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	rows, err := tx.Query(ctx, listEntitlementExpiriesQuery, uuidArray(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	expiries := make(map[uuid.UUID]time.Time, len(ids))
+	for rows.Next() {
+		var (
+			id        uuid.UUID
+			expiresAt *time.Time
+		)
+
+		if err := rows.Scan(&id, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		if expiresAt != nil {
+			expiries[id] = *expiresAt
+		}
+	}
+
+	return expiries, rows.Err()
+}
+
+func (engineTables) InsertLinks(ctx context.Context, tx pgx.Tx, links []Link) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	discordIds, entitlementIds := dedupeLinks(links)
+	_, err := tx.Exec(ctx, insertLinksQuery, discordIds, uuidArray(entitlementIds))
+	return err
+}
+
+func (engineTables) TagApplications(ctx context.Context, tx pgx.Tx, links []Link, applicationId uint64) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	discordIds, _ := dedupeLinks(links)
+	_, err := tx.Exec(ctx, tagApplicationsQuery, discordIds, applicationId)
+	return err
+}
+
+func (engineTables) RecordEntitlementIds(ctx context.Context, tx pgx.Tx, links []Link) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	discordIds, entitlementIds := dedupeLinks(links)
+	_, err := tx.Exec(ctx, recordEntitlementIdsQuery, discordIds, uuidArray(entitlementIds))
+	return err
+}
+
+func (engineTables) StableEntitlementIds(ctx context.Context, tx pgx.Tx, discordIds []uint64) (map[uint64]uuid.UUID, error) {
+	return scanEntitlementIds(ctx, tx, listStableEntitlementIdsQuery, discordIds)
+}
+
+func (engineTables) DeletedEntitlementIds(ctx context.Context, tx pgx.Tx, discordIds []uint64) (map[uint64]uuid.UUID, error) {
+	return scanEntitlementIds(ctx, tx, listPreviousEntitlementIdsQuery, discordIds)
+}
+
+func (engineTables) RecordUndo(ctx context.Context, tx pgx.Tx, runId uuid.UUID, entitlementIds []uuid.UUID) error {
+	if len(entitlementIds) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, insertUndoLogQuery, runId, uuidArray(entitlementIds))
+	return err
+}
+
+func (engineTables) InsertDeadLetter(ctx context.Context, tx pgx.Tx, letter DeadLetter) error {
+	_, err := tx.Exec(ctx, insertDeadLetterQuery, letter.DiscordId, letter.SkuId, letter.GuildId, letter.UserId, letter.Cause)
+	return err
+}
+
+func (engineTables) ClearDeadLetters(ctx context.Context, tx pgx.Tx, discordIds []uint64) error {
+	if len(discordIds) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, clearDeadLettersQuery, discordIds)
+	return err
+}
+
+func (engineTables) InsertRenewal(ctx context.Context, tx pgx.Tx, runId uuid.UUID, renewal Renewal) error {
+	_, err := tx.Exec(
+		ctx,
+		insertRenewalQuery,
+		runId,
+		renewal.EntitlementId,
+		renewal.DiscordId,
+		renewal.GuildId,
+		renewal.UserId,
+		renewal.SkuId,
+		renewal.PreviousExpiresAt,
+		renewal.ExpiresAt,
+	)
+	return err
+}
+
+// scanEntitlementIds runs a query returning Discord ID and entitlement ID pairs for the given Discord IDs
+func scanEntitlementIds(ctx context.Context, tx pgx.Tx, query string, discordIds []uint64) (map[uint64]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, query, discordIds)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := make(map[uint64]uuid.UUID)
+	for rows.Next() {
+		var (
+			discordId     uint64
+			entitlementId uuid.UUID
+		)
+
+		if err := rows.Scan(&discordId, &entitlementId); err != nil {
+			return nil, err
+		}
+
+		ids[discordId] = entitlementId
+	}
+
+	return ids, rows.Err()
+}
+
+// dedupeLinks splits links into parallel slices of Discord IDs and entitlement IDs, keeping only the last link for
+// each Discord ID, as an upsert cannot affect the same row twice in one statement
+func dedupeLinks(links []Link) ([]uint64, []uuid.UUID) {
+	indexes := make(map[uint64]int, len(links))
+	discordIds := make([]uint64, 0, len(links))
+	entitlementIds := make([]uuid.UUID, 0, len(links))
+	for _, link := range links {
+		if i, ok := indexes[link.DiscordId]; ok {
+			entitlementIds[i] = link.EntitlementId
+			continue
+		}
+
+		indexes[link.DiscordId] = len(discordIds)
+		discordIds = append(discordIds, link.DiscordId)
+		entitlementIds = append(entitlementIds, link.EntitlementId)
+	}
+
+	return discordIds, entitlementIds
+}
+
+// uuidArray converts ids into a form that can be encoded as a uuid[] parameter. pgtype treats uuid.UUID as a
+// nested array when encoding a slice of them, so the raw bytes must be passed instead.
+func uuidArray(ids []uuid.UUID) [][16]byte {
+	raw := make([][16]byte, len(ids))
+	for i, id := range ids {
+		raw[i] = id
+	}
+
+	return raw
+}
@@ -0,0 +1,601 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrSqlUnsupported is returned when SQL is run in a transaction of the Memory store
+var ErrSqlUnsupported = errors.New("SQL is not supported by the memory store")
+
+// UndoEntry is an entitlement recorded in the undo log of the Memory store
+type UndoEntry struct {
+	RunId       uuid.UUID
+	DiscordId   uint64
+	Entitlement model.Entitlement
+}
+
+// Memory is an EntitlementStore that holds everything in memory, so that the reconciliation engine can be tested
+// without a database. The changes made in a transaction are only visible to it until it is committed, when they are
+// applied to the store in the order they were made, and savepoints started with Begin can be rolled back on their
+// own. As in Postgres, creating an entitlement for a SKU that has not been added with AddSku fails with a foreign key
+// violation. SQL cannot be run in its transactions, other than to set the transaction's settings.
+type Memory struct {
+	mu    sync.Mutex
+	state memoryState
+}
+
+var _ EntitlementStore = (*Memory)(nil)
+
+type memoryState struct {
+	// skus are the internal SKUs by Discord SKU ID
+	skus         map[uint64]model.Sku
+	entitlements map[uuid.UUID]model.Entitlement
+	links        map[uint64]uuid.UUID
+	applications map[uint64]uint64
+	stableIds    map[uint64]uuid.UUID
+	undoLog      []UndoEntry
+	deadLetters  map[uint64]DeadLetter
+	renewals     []Renewal
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		state: memoryState{
+			skus:         make(map[uint64]model.Sku),
+			entitlements: make(map[uuid.UUID]model.Entitlement),
+			links:        make(map[uint64]uuid.UUID),
+			applications: make(map[uint64]uint64),
+			stableIds:    make(map[uint64]uuid.UUID),
+			deadLetters:  make(map[uint64]DeadLetter),
+		},
+	}
+}
+
+// AddSku maps a Discord SKU to an internal SKU
+func (m *Memory) AddSku(discordSkuId uint64, sku model.Sku) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.skus[discordSkuId] = sku
+}
+
+// AddEntitlement stores an entitlement linked to a Discord entitlement, as if it had been synced by a previous run
+func (m *Memory) AddEntitlement(discordId uint64, entitlement model.Entitlement) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.entitlements[entitlement.Id] = entitlement
+	m.state.links[discordId] = entitlement.Id
+}
+
+// Entitlements returns the committed entitlements, by ID
+func (m *Memory) Entitlements() map[uuid.UUID]model.Entitlement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return maps.Clone(m.state.entitlements)
+}
+
+// Links returns the committed links, from Discord entitlement ID to entitlement ID
+func (m *Memory) Links() map[uint64]uuid.UUID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return maps.Clone(m.state.links)
+}
+
+// DeadLetters returns the committed dead letters, by Discord entitlement ID
+func (m *Memory) DeadLetters() map[uint64]DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return maps.Clone(m.state.deadLetters)
+}
+
+// UndoLog returns the committed undo log, oldest first
+func (m *Memory) UndoLog() []UndoEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.state.undoLog)
+}
+
+// Renewals returns the committed renewals, oldest first
+func (m *Memory) Renewals() []Renewal {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.state.renewals)
+}
+
+func (m *Memory) BeginTx(ctx context.Context) (pgx.Tx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return &memoryTx{store: m, state: m.state.clone()}, nil
+}
+
+func (m *Memory) CreateEntitlement(ctx context.Context, tx pgx.Tx, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error) {
+	return m.CreateEntitlementWithId(ctx, tx, uuid.New(), guildId, userId, skuId, expiresAt)
+}
+
+func (m *Memory) CreateEntitlementWithId(ctx context.Context, tx pgx.Tx, id uuid.UUID, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error) {
+	var created model.Entitlement
+	err := m.apply(tx, func(state *memoryState) error {
+		if !state.hasSku(skuId) {
+			return &pgconn.PgError{
+				Code:    "23503",
+				Message: fmt.Sprintf("insert or update on table \"entitlements\" violates foreign key constraint: sku %s does not exist", skuId),
+			}
+		}
+
+		for existingId, existing := range state.entitlements {
+			if sameOwners(existing, guildId, userId, skuId) {
+				existing.ExpiresAt = expiresAt
+				state.entitlements[existingId] = existing
+				created = existing
+				return nil
+			}
+		}
+
+		created = model.Entitlement{
+			Id:        id,
+			GuildId:   guildId,
+			UserId:    userId,
+			SkuId:     skuId,
+			Source:    model.EntitlementSourceDiscord,
+			ExpiresAt: expiresAt,
+		}
+		state.entitlements[id] = created
+		return nil
+	})
+
+	return created, err
+}
+
+func (m *Memory) DeleteEntitlement(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	_, err := m.DeleteEntitlements(ctx, tx, []uuid.UUID{id})
+	return err
+}
+
+func (m *Memory) DeleteEntitlements(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (int64, error) {
+	var deleted int64
+	err := m.apply(tx, func(state *memoryState) error {
+		deleted = 0
+		for _, id := range ids {
+			if _, ok := state.entitlements[id]; !ok {
+				continue
+			}
+
+			delete(state.entitlements, id)
+			deleted++
+
+			// Links are removed by ON DELETE CASCADE in Postgres
+			maps.DeleteFunc(state.links, func(_ uint64, entitlementId uuid.UUID) bool {
+				return entitlementId == id
+			})
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+func (m *Memory) GetExpiries(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	state, err := m.read(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	expiries := make(map[uuid.UUID]time.Time, len(ids))
+	for _, id := range ids {
+		if entitlement, ok := state.entitlements[id]; ok && entitlement.ExpiresAt != nil {
+			expiries[id] = *entitlement.ExpiresAt
+		}
+	}
+
+	return expiries, nil
+}
+
+func (m *Memory) GetSku(ctx context.Context, discordSkuId uint64) (*model.Sku, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sku, ok := m.state.skus[discordSkuId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &sku, nil
+}
+
+func (m *Memory) GetSkus(ctx context.Context, discordSkuIds []uint64) (map[uint64]model.Sku, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	skus := make(map[uint64]model.Sku)
+	for _, discordSkuId := range discordSkuIds {
+		if sku, ok := m.state.skus[discordSkuId]; ok {
+			skus[discordSkuId] = sku
+		}
+	}
+
+	return skus, nil
+}
+
+func (m *Memory) InsertLinks(ctx context.Context, tx pgx.Tx, links []Link) error {
+	return m.apply(tx, func(state *memoryState) error {
+		for _, link := range links {
+			state.links[link.DiscordId] = link.EntitlementId
+		}
+
+		return nil
+	})
+}
+
+func (m *Memory) TagApplications(ctx context.Context, tx pgx.Tx, links []Link, applicationId uint64) error {
+	return m.apply(tx, func(state *memoryState) error {
+		for _, link := range links {
+			if _, ok := state.applications[link.DiscordId]; !ok {
+				state.applications[link.DiscordId] = applicationId
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Memory) RecordEntitlementIds(ctx context.Context, tx pgx.Tx, links []Link) error {
+	return m.apply(tx, func(state *memoryState) error {
+		for _, link := range links {
+			state.stableIds[link.DiscordId] = link.EntitlementId
+		}
+
+		return nil
+	})
+}
+
+func (m *Memory) StableEntitlementIds(ctx context.Context, tx pgx.Tx, discordIds []uint64) (map[uint64]uuid.UUID, error) {
+	state, err := m.read(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[uint64]uuid.UUID)
+	for _, discordId := range discordIds {
+		if id, ok := state.stableIds[discordId]; ok && !state.inUse(id) {
+			ids[discordId] = id
+		}
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) DeletedEntitlementIds(ctx context.Context, tx pgx.Tx, discordIds []uint64) (map[uint64]uuid.UUID, error) {
+	state, err := m.read(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[uint64]uuid.UUID)
+	for _, entry := range state.undoLog {
+		if slices.Contains(discordIds, entry.DiscordId) && !state.inUse(entry.Entitlement.Id) {
+			ids[entry.DiscordId] = entry.Entitlement.Id
+		}
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) RecordUndo(ctx context.Context, tx pgx.Tx, runId uuid.UUID, entitlementIds []uuid.UUID) error {
+	return m.apply(tx, func(state *memoryState) error {
+		for _, id := range entitlementIds {
+			entitlement, ok := state.entitlements[id]
+			if !ok {
+				continue
+			}
+
+			alreadyRecorded := slices.ContainsFunc(state.undoLog, func(entry UndoEntry) bool {
+				return entry.RunId == runId && entry.Entitlement.Id == id
+			})
+			if alreadyRecorded {
+				continue
+			}
+
+			entry := UndoEntry{RunId: runId, Entitlement: entitlement}
+			for discordId, entitlementId := range state.links {
+				if entitlementId == id {
+					entry.DiscordId = discordId
+				}
+			}
+
+			state.undoLog = append(state.undoLog, entry)
+		}
+
+		return nil
+	})
+}
+
+func (m *Memory) InsertDeadLetter(ctx context.Context, tx pgx.Tx, letter DeadLetter) error {
+	return m.apply(tx, func(state *memoryState) error {
+		state.deadLetters[letter.DiscordId] = letter
+		return nil
+	})
+}
+
+func (m *Memory) ClearDeadLetters(ctx context.Context, tx pgx.Tx, discordIds []uint64) error {
+	return m.apply(tx, func(state *memoryState) error {
+		for _, discordId := range discordIds {
+			delete(state.deadLetters, discordId)
+		}
+
+		return nil
+	})
+}
+
+func (m *Memory) InsertRenewal(ctx context.Context, tx pgx.Tx, runId uuid.UUID, renewal Renewal) error {
+	return m.apply(tx, func(state *memoryState) error {
+		state.renewals = append(state.renewals, renewal)
+		return nil
+	})
+}
+
+// apply makes a change in tx, which is recorded so that it can be made again against the store on commit
+func (m *Memory) apply(tx pgx.Tx, change func(state *memoryState) error) error {
+	memTx, err := m.unwrap(tx)
+	if err != nil {
+		return err
+	}
+
+	return memTx.apply(change)
+}
+
+// read returns the state seen by tx
+func (m *Memory) read(tx pgx.Tx) (*memoryState, error) {
+	memTx, err := m.unwrap(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if memTx.closed {
+		return nil, pgx.ErrTxClosed
+	}
+
+	return &memTx.state, nil
+}
+
+// unwrap finds the memoryTx that tx wraps, e.g. when it has been wrapped by postgres.AnnotateTx
+func (m *Memory) unwrap(tx pgx.Tx) (*memoryTx, error) {
+	for {
+		if memTx, ok := tx.(*memoryTx); ok && memTx.store == m {
+			return memTx, nil
+		}
+
+		wrapper, ok := tx.(interface{ Unwrap() pgx.Tx })
+		if !ok {
+			return nil, errors.New("transaction was not started by this memory store")
+		}
+
+		tx = wrapper.Unwrap()
+	}
+}
+
+func (s memoryState) clone() memoryState {
+	return memoryState{
+		skus:         maps.Clone(s.skus),
+		entitlements: maps.Clone(s.entitlements),
+		links:        maps.Clone(s.links),
+		applications: maps.Clone(s.applications),
+		stableIds:    maps.Clone(s.stableIds),
+		undoLog:      slices.Clone(s.undoLog),
+		deadLetters:  maps.Clone(s.deadLetters),
+		renewals:     slices.Clone(s.renewals),
+	}
+}
+
+func (s *memoryState) hasSku(skuId uuid.UUID) bool {
+	for _, sku := range s.skus {
+		if sku.Id == skuId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *memoryState) inUse(entitlementId uuid.UUID) bool {
+	_, ok := s.entitlements[entitlementId]
+	return ok
+}
+
+// sameOwners returns true if the entitlement conflicts with a Discord entitlement with the given owners and SKU, on
+// the entitlements table's unique constraint
+func sameOwners(entitlement model.Entitlement, guildId, userId *uint64, skuId uuid.UUID) bool {
+	return entitlement.Source == model.EntitlementSourceDiscord &&
+		entitlement.SkuId == skuId &&
+		equalIds(entitlement.GuildId, guildId) &&
+		equalIds(entitlement.UserId, userId)
+}
+
+func equalIds(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// memoryTx is a transaction, or savepoint if parent is set, of the Memory store. It works on a copy of the state,
+// and records the changes it makes so that they can be made against the parent or the store when it is committed.
+type memoryTx struct {
+	store   *Memory
+	parent  *memoryTx
+	state   memoryState
+	changes []func(state *memoryState) error
+	closed  bool
+}
+
+var _ pgx.Tx = (*memoryTx)(nil)
+
+func (t *memoryTx) apply(change func(state *memoryState) error) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+
+	if err := change(&t.state); err != nil {
+		return err
+	}
+
+	t.changes = append(t.changes, change)
+	return nil
+}
+
+func (t *memoryTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	if t.closed {
+		return nil, pgx.ErrTxClosed
+	}
+
+	return &memoryTx{store: t.store, parent: t, state: t.state.clone()}, nil
+}
+
+func (t *memoryTx) BeginFunc(ctx context.Context, f func(pgx.Tx) error) error {
+	savepoint, err := t.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer savepoint.Rollback(ctx)
+
+	if err := f(savepoint); err != nil {
+		return err
+	}
+
+	return savepoint.Commit(ctx)
+}
+
+func (t *memoryTx) Commit(ctx context.Context) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+
+	t.closed = true
+
+	if t.parent != nil {
+		for _, change := range t.changes {
+			if err := t.parent.apply(change); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	// Changes are made against a copy, so that the store is left as it was if one fails
+	state := t.store.state.clone()
+	for _, change := range t.changes {
+		if err := change(&state); err != nil {
+			return err
+		}
+	}
+
+	t.store.state = state
+	return nil
+}
+
+func (t *memoryTx) Rollback(ctx context.Context) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+
+	t.closed = true
+	return nil
+}
+
+func (t *memoryTx) Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error) {
+	// Transactions are tagged with the run through their settings, which have no effect on the store
+	if strings.Contains(sql, "SELECT set_config(") {
+		return pgconn.CommandTag("SELECT 1"), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrSqlUnsupported, sql)
+}
+
+func (t *memoryTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return nil, fmt.Errorf("%w: %s", ErrSqlUnsupported, sql)
+}
+
+func (t *memoryTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return errRow{err: fmt.Errorf("%w: %s", ErrSqlUnsupported, sql)}
+}
+
+func (t *memoryTx) QueryFunc(ctx context.Context, sql string, args []interface{}, scans []interface{}, f func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	return nil, fmt.Errorf("%w: %s", ErrSqlUnsupported, sql)
+}
+
+func (t *memoryTx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return 0, ErrSqlUnsupported
+}
+
+func (t *memoryTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return errBatchResults{err: ErrSqlUnsupported}
+}
+
+func (t *memoryTx) LargeObjects() pgx.LargeObjects {
+	return pgx.LargeObjects{}
+}
+
+func (t *memoryTx) Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	return nil, fmt.Errorf("%w: %s", ErrSqlUnsupported, sql)
+}
+
+func (t *memoryTx) Conn() *pgx.Conn {
+	return nil
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+type errBatchResults struct {
+	err error
+}
+
+func (r errBatchResults) Exec() (pgconn.CommandTag, error) {
+	return nil, r.err
+}
+
+func (r errBatchResults) Query() (pgx.Rows, error) {
+	return nil, r.err
+}
+
+func (r errBatchResults) QueryRow() pgx.Row {
+	return errRow{err: r.err}
+}
+
+func (r errBatchResults) QueryFunc(scans []interface{}, f func(pgx.QueryFuncRow) error) (pgconn.CommandTag, error) {
+	return nil, r.err
+}
+
+func (r errBatchResults) Close() error {
+	return r.err
+}
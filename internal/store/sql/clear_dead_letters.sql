@@ -0,0 +1 @@
+DELETE FROM entitlement_dead_letters WHERE discord_id = ANY($1);
\ No newline at end of file
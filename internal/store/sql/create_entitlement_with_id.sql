@@ -0,0 +1,5 @@
+INSERT INTO entitlements(id, guild_id, user_id, sku_id, source, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (guild_id, user_id, sku_id, source)
+DO UPDATE SET expires_at = $6
+RETURNING "id";
\ No newline at end of file
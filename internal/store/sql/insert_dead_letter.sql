@@ -0,0 +1,8 @@
+INSERT INTO entitlement_dead_letters(discord_id, sku_id, guild_id, user_id, error)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT ("discord_id") DO UPDATE SET "sku_id"    = EXCLUDED."sku_id",
+                                         "guild_id"  = EXCLUDED."guild_id",
+                                         "user_id"   = EXCLUDED."user_id",
+                                         "error"     = EXCLUDED."error",
+                                         "attempts"  = entitlement_dead_letters."attempts" + 1,
+                                         "failed_at" = NOW();
\ No newline at end of file
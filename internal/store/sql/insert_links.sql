@@ -0,0 +1,4 @@
+INSERT INTO discord_entitlements(discord_id, entitlement_id)
+SELECT * FROM unnest($1::int8[], $2::uuid[])
+ON CONFLICT ("discord_id") DO UPDATE SET "entitlement_id" = EXCLUDED."entitlement_id"
+WHERE discord_entitlements."entitlement_id" IS DISTINCT FROM EXCLUDED."entitlement_id";
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO entitlement_renewals(run_id, entitlement_id, discord_id, guild_id, user_id, sku_id, previous_expires_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
\ No newline at end of file
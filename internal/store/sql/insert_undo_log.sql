@@ -0,0 +1,6 @@
+INSERT INTO entitlement_undo_log(run_id, entitlement_id, discord_id, guild_id, user_id, sku_id, source, expires_at)
+SELECT $1, entitlements.id, discord_entitlements.discord_id, entitlements.guild_id, entitlements.user_id, entitlements.sku_id, entitlements.source, entitlements.expires_at
+FROM entitlements
+LEFT JOIN discord_entitlements ON discord_entitlements.entitlement_id = entitlements.id
+WHERE entitlements.id = ANY($2)
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT "id", "expires_at"
+FROM entitlements
+WHERE "id" = ANY($1);
\ No newline at end of file
@@ -0,0 +1,9 @@
+SELECT DISTINCT ON (entitlement_undo_log.discord_id) entitlement_undo_log.discord_id, entitlement_undo_log.entitlement_id
+FROM entitlement_undo_log
+WHERE entitlement_undo_log.discord_id = ANY($1)
+AND NOT EXISTS (
+    SELECT 1
+    FROM entitlements
+    WHERE entitlements.id = entitlement_undo_log.entitlement_id
+)
+ORDER BY entitlement_undo_log.discord_id, entitlement_undo_log.deleted_at DESC;
\ No newline at end of file
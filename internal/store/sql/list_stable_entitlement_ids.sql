@@ -0,0 +1,8 @@
+SELECT entitlement_ids.discord_id, entitlement_ids.entitlement_id
+FROM entitlement_ids
+WHERE entitlement_ids.discord_id = ANY($1)
+AND NOT EXISTS (
+    SELECT 1
+    FROM entitlements
+    WHERE entitlements.id = entitlement_ids.entitlement_id
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+INSERT INTO entitlement_ids(discord_id, entitlement_id)
+SELECT * FROM unnest($1::int8[], $2::uuid[])
+ON CONFLICT ("discord_id") DO UPDATE SET "entitlement_id" = EXCLUDED."entitlement_id", "updated_at" = NOW()
+WHERE entitlement_ids."entitlement_id" IS DISTINCT FROM EXCLUDED."entitlement_id";
\ No newline at end of file
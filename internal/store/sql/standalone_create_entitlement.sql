@@ -0,0 +1,5 @@
+INSERT INTO entitlements(guild_id, user_id, sku_id, source, expires_at)
+VALUES ($1, $2, $3, 'discord', $4)
+ON CONFLICT (guild_id, user_id, sku_id, source)
+DO UPDATE SET expires_at = EXCLUDED.expires_at
+RETURNING id
\ No newline at end of file
@@ -0,0 +1,52 @@
+DO $$
+BEGIN
+    CREATE TYPE sku_type AS ENUM ('subscription', 'consumable', 'durable');
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END
+$$;
+
+DO $$
+BEGIN
+    CREATE TYPE premium_source AS ENUM ('discord', 'patreon', 'voting', 'key');
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS skus
+(
+    id    UUID DEFAULT gen_random_uuid(),
+    label VARCHAR(255) NOT NULL,
+    type  sku_type     NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS entitlements
+(
+    id         UUID DEFAULT gen_random_uuid(),
+    guild_id   int8 DEFAULT NULL,
+    user_id    int8,
+    sku_id     UUID           NOT NULL,
+    source     premium_source NOT NULL,
+    expires_at timestamptz,
+    PRIMARY KEY (id),
+    UNIQUE NULLS NOT DISTINCT (guild_id, user_id, sku_id, source),
+    FOREIGN KEY (sku_id) REFERENCES skus (id)
+);
+
+CREATE TABLE IF NOT EXISTS discord_store_skus
+(
+    discord_id int8 NOT NULL,
+    sku_id     UUID NOT NULL,
+    PRIMARY KEY (discord_id),
+    FOREIGN KEY (sku_id) REFERENCES skus (id)
+);
+
+CREATE TABLE IF NOT EXISTS discord_entitlements
+(
+    discord_id     int8 NOT NULL,
+    entitlement_id UUID NOT NULL,
+    PRIMARY KEY (discord_id),
+    FOREIGN KEY (entitlement_id) REFERENCES entitlements (id) ON DELETE CASCADE
+);
\ No newline at end of file
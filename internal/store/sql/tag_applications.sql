@@ -0,0 +1,3 @@
+INSERT INTO discord_entitlement_applications(discord_id, application_id)
+SELECT discord_id, $2 FROM unnest($1::int8[]) AS discord_id
+ON CONFLICT ("discord_id") DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var (
+	//go:embed sql/standalone_schema.sql
+	standaloneSchema string
+
+	//go:embed sql/standalone_create_entitlement.sql
+	standaloneCreateEntitlementQuery string
+
+	//go:embed sql/standalone_delete_entitlement.sql
+	standaloneDeleteEntitlementQuery string
+
+	//go:embed sql/standalone_get_sku.sql
+	standaloneGetSkuQuery string
+)
+
+// Standalone is an EntitlementStore that does not depend on the TicketsBot database. It creates the skus,
+// entitlements, discord_store_skus and discord_entitlements tables if they do not exist, with the same layout as
+// the TicketsBot tables, so that the sync can be run against an otherwise empty database.
+type Standalone struct {
+	engineTables
+
+	pool *pgxpool.Pool
+}
+
+var (
+	_ EntitlementStore = (*Standalone)(nil)
+	_ SchemaCreator    = (*Standalone)(nil)
+)
+
+func NewStandalone(pool *pgxpool.Pool) *Standalone {
+	return &Standalone{
+		pool: pool,
+	}
+}
+
+func (s *Standalone) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, standaloneSchema)
+	return err
+}
+
+func (s *Standalone) BeginTx(ctx context.Context) (pgx.Tx, error) {
+	return s.pool.Begin(ctx)
+}
+
+func (s *Standalone) CreateEntitlement(ctx context.Context, tx pgx.Tx, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error) {
+	var id uuid.UUID
+	if err := tx.QueryRow(ctx, standaloneCreateEntitlementQuery, guildId, userId, skuId, expiresAt).Scan(&id); err != nil {
+		return model.Entitlement{}, err
+	}
+
+	return model.Entitlement{
+		Id:        id,
+		GuildId:   guildId,
+		UserId:    userId,
+		SkuId:     skuId,
+		Source:    model.EntitlementSourceDiscord,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *Standalone) DeleteEntitlement(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	_, err := tx.Exec(ctx, standaloneDeleteEntitlementQuery, id)
+	return err
+}
+
+func (s *Standalone) GetSku(ctx context.Context, discordSkuId uint64) (*model.Sku, error) {
+	var sku model.Sku
+	if err := s.pool.QueryRow(ctx, standaloneGetSkuQuery, discordSkuId).Scan(&sku.Id, &sku.Label, &sku.SkuType); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &sku, nil
+}
+
+func (s *Standalone) GetSkus(ctx context.Context, discordSkuIds []uint64) (map[uint64]model.Sku, error) {
+	return getSkus(ctx, s.pool, discordSkuIds)
+}
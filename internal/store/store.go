@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/TicketsBot-cloud/common/model"
+	"github.com/TicketsBot-cloud/database"
+	"github.com/TicketsBot-cloud/discord-entitlements-db-sync/internal/config"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// EntitlementStore is the store of TicketsBot entitlements that Discord entitlements are synced into. Writes are made
+// in a transaction started by BeginTx, which is passed back to the store's methods rather than queried directly, so
+// that the changes made while applying a run, including the engine's Bookkeeping, can be made against any store.
+// The engine's other tables, such as the quarantine, the run history and the tables used by the admin API, are still
+// queried directly, so every implementation used by the daemon must be backed by a Postgres database holding them.
+type EntitlementStore interface {
+	Bookkeeping
+
+	// BeginTx starts a transaction
+	BeginTx(ctx context.Context) (pgx.Tx, error)
+	// CreateEntitlement upserts an entitlement synced from Discord, returning the entitlement as stored
+	CreateEntitlement(ctx context.Context, tx pgx.Tx, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error)
+	// CreateEntitlementWithId upserts an entitlement as CreateEntitlement does, using id as its ID if it is created
+	CreateEntitlementWithId(ctx context.Context, tx pgx.Tx, id uuid.UUID, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error)
+	// DeleteEntitlement deletes the entitlement with the given ID, if it exists
+	DeleteEntitlement(ctx context.Context, tx pgx.Tx, id uuid.UUID) error
+	// DeleteEntitlements deletes all the given entitlements at once, returning the number deleted. Their links are
+	// removed with them.
+	DeleteEntitlements(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (int64, error)
+	// GetExpiries returns the expiry of each of the entitlements, by ID. Entitlements that never expire are omitted.
+	GetExpiries(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (map[uuid.UUID]time.Time, error)
+	// GetSku returns the internal SKU that a Discord SKU is mapped to, or nil if it is not mapped
+	GetSku(ctx context.Context, discordSkuId uint64) (*model.Sku, error)
+	// GetSkus returns the internal SKUs that the Discord SKUs are mapped to in a single query. Discord SKUs that are
+	// not mapped are omitted.
+	GetSkus(ctx context.Context, discordSkuIds []uint64) (map[uint64]model.Sku, error)
+}
+
+//go:embed sql/get_skus.sql
+var getSkusQuery string
+
+// SchemaCreator is implemented by stores that create their own tables, which EnsureSchema must be called for before
+// the store is used
+type SchemaCreator interface {
+	EnsureSchema(ctx context.Context) error
+}
+
+// New creates the EntitlementStore for the configured STORE_BACKEND
+func New(backend config.StoreBackend, pool *pgxpool.Pool) EntitlementStore {
+	if backend == config.StoreBackendStandalone {
+		return NewStandalone(pool)
+	}
+
+	return NewPostgres(pool)
+}
+
+// Postgres is an EntitlementStore backed by the TicketsBot database
+type Postgres struct {
+	engineTables
+
+	pool *pgxpool.Pool
+	db   *database.Database
+}
+
+var _ EntitlementStore = (*Postgres)(nil)
+
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{
+		pool: pool,
+		db:   database.NewDatabase(pool),
+	}
+}
+
+func (p *Postgres) BeginTx(ctx context.Context) (pgx.Tx, error) {
+	return p.db.BeginTx(ctx)
+}
+
+func (p *Postgres) CreateEntitlement(ctx context.Context, tx pgx.Tx, guildId, userId *uint64, skuId uuid.UUID, expiresAt *time.Time) (model.Entitlement, error) {
+	return p.db.Entitlements.Create(ctx, tx, guildId, userId, skuId, model.EntitlementSourceDiscord, expiresAt)
+}
+
+func (p *Postgres) DeleteEntitlement(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	return p.db.Entitlements.DeleteById(ctx, tx, id)
+}
+
+func (p *Postgres) GetSku(ctx context.Context, discordSkuId uint64) (*model.Sku, error) {
+	return p.db.DiscordStoreSkus.GetSku(ctx, discordSkuId)
+}
+
+func (p *Postgres) GetSkus(ctx context.Context, discordSkuIds []uint64) (map[uint64]model.Sku, error) {
+	return getSkus(ctx, p.pool, discordSkuIds)
+}
+
+func getSkus(ctx context.Context, pool *pgxpool.Pool, discordSkuIds []uint64) (map[uint64]model.Sku, error) {
+	rows, err := pool.Query(ctx, getSkusQuery, discordSkuIds)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	skus := make(map[uint64]model.Sku)
+	for rows.Next() {
+		var discordId uint64
+		var sku model.Sku
+		if err := rows.Scan(&discordId, &sku.Id, &sku.Label, &sku.SkuType); err != nil {
+			return nil, err
+		}
+
+		skus[discordId] = sku
+	}
+
+	return skus, rows.Err()
+}
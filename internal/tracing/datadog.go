@@ -0,0 +1,28 @@
+//go:build datadog
+
+package tracing
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Available reports whether the binary was built with Datadog tracing support
+const Available = true
+
+// Start starts the Datadog tracer, which is configured by the standard DD_* environment variables, e.g.
+// DD_AGENT_HOST and DD_ENV. The returned function flushes and stops the tracer.
+func Start(serviceName string) func() {
+	tracer.Start(tracer.WithService(serviceName))
+	return tracer.Stop
+}
+
+// StartSpan starts a Datadog span as a child of any span in ctx. The returned function finishes the span, marking it
+// as failed if err is not nil.
+func StartSpan(ctx context.Context, operation string) (context.Context, func(err error)) {
+	span, ctx := tracer.StartSpanFromContext(ctx, operation)
+	return ctx, func(err error) {
+		span.Finish(tracer.WithError(err))
+	}
+}
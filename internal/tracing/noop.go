@@ -0,0 +1,19 @@
+//go:build !datadog
+
+package tracing
+
+import (
+	"context"
+)
+
+// Available reports whether the binary was built with Datadog tracing support. The tracer is only compiled in when
+// building with the datadog tag, so that it is not a dependency of the default build.
+const Available = false
+
+func Start(serviceName string) func() {
+	return func() {}
+}
+
+func StartSpan(ctx context.Context, operation string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}